@@ -11,6 +11,7 @@ import (
 
 	"debtster_import/internal/config"
 	"debtster_import/internal/handlers"
+	"debtster_import/internal/repository/cache"
 	"debtster_import/internal/server"
 )
 
@@ -29,7 +30,9 @@ func main() {
 	}
 	fmt.Println("🟢 All connections OK")
 
-	h := handlers.New(cfg.Postgres, cfg.Mongo, cfg.S3)
+	cache.Configure(cfg.Cache)
+
+	h := handlers.New(cfg.Postgres, cfg.Mongo, cfg.S3, cfg.Import)
 	srv := server.NewServer(cfg.Port, h)
 
 	if err := srv.Run(runCtx); err != nil {
@@ -2,6 +2,8 @@ package opener
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"log"
@@ -22,7 +24,7 @@ func NewS3Opener(cli S3Client) *S3Opener { return &S3Opener{Client: cli} }
 
 func (s *S3Opener) Open(ctx context.Context, bucket, key string) (io.ReadCloser, ports.Meta, error) {
 	log.Printf("[OPENER][S3][START] bucket=%q key=%q", bucket, key)
-	st, err := s.Client.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+	st, err := s.Client.StatObject(ctx, bucket, key, minio.StatObjectOptions{Checksum: true})
 	if err != nil {
 		log.Printf("[OPENER][S3][ERR] stat: %v", err)
 		return nil, ports.Meta{}, fmt.Errorf("s3 stat: %w", err)
@@ -39,5 +41,19 @@ func (s *S3Opener) Open(ctx context.Context, bucket, key string) (io.ReadCloser,
 		Size:        st.Size,
 		Bucket:      bucket,
 		Key:         key,
+		SHA256:      checksumHex(st.ChecksumSHA256),
 	}, nil
 }
+
+// checksumHex переводит x-amz-checksum-sha256 (base64) в hex. Составные
+// (multipart) суммы вида "<b64>-<parts>" не являются хэшем файла и игнорируются.
+func checksumHex(b64 string) string {
+	if b64 == "" {
+		return ""
+	}
+	raw, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil || len(raw) != 32 {
+		return ""
+	}
+	return hex.EncodeToString(raw)
+}
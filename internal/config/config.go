@@ -5,10 +5,13 @@ import (
 	"debtster_import/internal/config/connections/mongo"
 	"debtster_import/internal/config/connections/postgres"
 	"debtster_import/internal/config/connections/s3"
+	"debtster_import/internal/repository/cache"
 	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -18,12 +21,59 @@ type Config struct {
 	S3       *s3.S3
 	Mongo    *mongo.Mongo
 	Postgres *postgres.Postgres
+	Import   Import
+	// Cache — общие кэши справочных поисков (долги, пользователи, статусы...).
+	Cache cache.Options
+}
+
+// Import — настройки выполнения импортов.
+type Import struct {
+	TmpDir            string
+	MemoryBudgetBytes int64
+	// BatchWorkers — сколько батчей одного импорта обрабатывается параллельно.
+	BatchWorkers int
+	// AgreementGraceDays — сколько дней просрочки платежа по графику
+	// допускается до признания соглашения нарушенным.
+	AgreementGraceDays int
+	// StatusTransitionsFile — JSON-файл графа переходов статусов долга;
+	// пустой — переходы не ограничиваются.
+	StatusTransitionsFile string
 }
 
 func Init(ctx context.Context) *Config {
 	_ = godotenv.Load()
 	port := getenv("SERVER_PORT", "8070")
 
+	budgetMB, err := strconv.ParseInt(getenv("IMPORT_MEMORY_BUDGET_MB", "768"), 10, 64)
+	if err != nil {
+		log.Fatal("IMPORT_MEMORY_BUDGET_MB parse error:", err)
+	}
+
+	batchWorkers, err := strconv.Atoi(getenv("IMPORT_BATCH_WORKERS", "4"))
+	if err != nil {
+		log.Fatal("IMPORT_BATCH_WORKERS parse error:", err)
+	}
+
+	graceDays, err := strconv.Atoi(getenv("AGREEMENT_GRACE_DAYS", "0"))
+	if err != nil {
+		log.Fatal("AGREEMENT_GRACE_DAYS parse error:", err)
+	}
+
+	cacheSize, err := strconv.Atoi(getenv("LOOKUP_CACHE_SIZE", "10000"))
+	if err != nil {
+		log.Fatal("LOOKUP_CACHE_SIZE parse error:", err)
+	}
+
+	cacheTTL, err := time.ParseDuration(getenv("LOOKUP_CACHE_TTL", "10m"))
+	if err != nil {
+		log.Fatal("LOOKUP_CACHE_TTL parse error:", err)
+	}
+
+	cacheNegativeTTL, err := time.ParseDuration(getenv("LOOKUP_CACHE_NEGATIVE_TTL", "30s"))
+	if err != nil {
+		log.Fatal("LOOKUP_CACHE_NEGATIVE_TTL parse error:", err)
+	}
+
 	s3c, err := s3.NewConnection(s3.ConnectionInfo{
 		Endpoint:  getenv("AWS_ENDPOINT", "http://localhost:9000"),
 		AccessKey: getenv("AWS_ACCESS_KEY_ID", "minioadmin"),
@@ -66,6 +116,19 @@ func Init(ctx context.Context) *Config {
 		Mongo:    mg,
 		Postgres: pg,
 		Port:     port,
+		Import: Import{
+			TmpDir:             getenv("IMPORT_TMP_DIR", os.TempDir()),
+			MemoryBudgetBytes:  budgetMB << 20,
+			BatchWorkers:       batchWorkers,
+			AgreementGraceDays: graceDays,
+
+			StatusTransitionsFile: getenv("DEBT_STATUS_TRANSITIONS_FILE", ""),
+		},
+		Cache: cache.Options{
+			Size:        cacheSize,
+			TTL:         cacheTTL,
+			NegativeTTL: cacheNegativeTTL,
+		},
 	}
 }
 
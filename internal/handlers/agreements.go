@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"debtster_import/internal/repository/database"
+)
+
+type complianceRequest struct {
+	// DebtNumbers ограничивает проверку долгами; пусто — все действующие соглашения.
+	DebtNumbers   []string `json:"debt_numbers,omitempty"`
+	CreateActions bool     `json:"create_actions,omitempty"`
+	// AsOf — дата проверки (YYYY-MM-DD), по умолчанию сегодня.
+	AsOf string `json:"as_of,omitempty"`
+}
+
+// AgreementsCompliance — POST /agreements/compliance: сверка графиков
+// действующих соглашений с платежами по требованию.
+func (h *Handlers) AgreementsCompliance(w http.ResponseWriter, r *http.Request) {
+	var req complianceRequest
+	if r.ContentLength != 0 {
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err := dec.Decode(&req); err != nil {
+			h.JSON(w, http.StatusBadRequest, map[string]string{"error": "bad JSON: " + err.Error()})
+			return
+		}
+	}
+
+	asOf := time.Now()
+	if req.AsOf != "" {
+		t, err := time.Parse("2006-01-02", req.AsOf)
+		if err != nil {
+			h.JSON(w, http.StatusBadRequest, map[string]string{"error": "bad as_of: " + err.Error()})
+			return
+		}
+		asOf = t
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Minute)
+	defer cancel()
+
+	var debtIDs []string
+	if len(req.DebtNumbers) > 0 {
+		found, err := database.NewDebtsRepo(h.Postgres).ResolveDebtIDs(ctx, req.DebtNumbers)
+		if err != nil {
+			h.JSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		for _, id := range found {
+			debtIDs = append(debtIDs, id)
+		}
+		if len(debtIDs) == 0 {
+			h.JSON(w, http.StatusNotFound, map[string]string{"error": "no debts found"})
+			return
+		}
+	}
+
+	chk := *h.Compliance
+	chk.CreateActions = req.CreateActions
+
+	rep, err := chk.Run(ctx, debtIDs, asOf)
+	if err != nil {
+		h.Logger.Printf("[AGREEMENTS][COMPLIANCE][ERR] %v", err)
+		h.JSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	h.JSON(w, http.StatusOK, rep)
+}
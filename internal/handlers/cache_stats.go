@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"net/http"
+
+	"debtster_import/internal/repository/cache"
+)
+
+// CacheStats — GET /metrics/cache: размер и попадания общих кэшей
+// справочных поисков.
+func (h *Handlers) CacheStats(w http.ResponseWriter, _ *http.Request) {
+	h.JSON(w, http.StatusOK, map[string]any{
+		"caches": cache.AllStats(),
+	})
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+
+	"debtster_import/internal/repository/database"
+	"debtster_import/internal/validation"
+)
+
+// DebtAssignments — GET /debts/{number}/assignments: история смены
+// ответственного по долгу.
+func (h *Handlers) DebtAssignments(w http.ResponseWriter, r *http.Request) {
+	number := validation.NormalizeDebtNumber(r.PathValue("number"))
+	if number == "" {
+		h.JSON(w, http.StatusBadRequest, map[string]string{"error": "debt number is required"})
+		return
+	}
+
+	items, err := database.NewDebtAssignmentsRepo(h.Postgres).ListByDebtNumber(r.Context(), number)
+	if err != nil {
+		h.Logger.Printf("[ASSIGNMENTS][ERR] number=%s err=%v", number, err)
+		h.JSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to load assignments"})
+		return
+	}
+
+	h.JSON(w, http.StatusOK, map[string]any{
+		"debt_number": number,
+		"assignments": items,
+	})
+}
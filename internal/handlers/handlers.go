@@ -1,7 +1,11 @@
 package handlers
 
 import (
+	"debtster_import/internal/config"
 	"debtster_import/internal/repository/database"
+	"debtster_import/internal/services/agreements"
+	"debtster_import/internal/services/importer"
+	"debtster_import/internal/services/statuses"
 	"encoding/json"
 	"log"
 	"net/http"
@@ -21,13 +25,33 @@ type Handlers struct {
 
 	Registry map[string]ports.Processor
 
+	// TmpDir, Budget и Workers общие для всех фоновых импортов.
+	TmpDir  string
+	Budget  *importer.MemoryBudget
+	Workers int
+
+	// Compliance — сверка графиков соглашений с платежами.
+	Compliance *agreements.Checker
+
 	Logger *log.Logger
 }
 
-func New(pg *postgres.Postgres, mg *mongo.Mongo, s3c *s3.S3) *Handlers {
+func New(pg *postgres.Postgres, mg *mongo.Mongo, s3c *s3.S3, imp config.Import) *Handlers {
 	httpClient := &http.Client{}
 
-	reg := initProcessors(pg, mg)
+	compliance := &agreements.Checker{
+		Agreements: database.NewAgreementRepo(pg),
+		Payments:   database.NewPaymentRepo(pg),
+		Actions:    database.NewActionRepo(pg),
+		GraceDays:  imp.AgreementGraceDays,
+	}
+
+	transitions, err := statuses.LoadGraph(imp.StatusTransitionsFile)
+	if err != nil {
+		log.Fatal("status transitions:", err)
+	}
+
+	reg := initProcessors(pg, mg, compliance, transitions)
 
 	return &Handlers{
 		Postgres: pg,
@@ -35,7 +59,12 @@ func New(pg *postgres.Postgres, mg *mongo.Mongo, s3c *s3.S3) *Handlers {
 		S3:       s3c,
 		HTTP:     httpClient,
 		Registry: reg,
+		TmpDir:   imp.TmpDir,
+		Budget:   importer.NewMemoryBudget(imp.MemoryBudgetBytes),
+		Workers:  imp.BatchWorkers,
 		Logger:   log.Default(),
+
+		Compliance: compliance,
 	}
 }
 
@@ -45,7 +74,12 @@ func (h *Handlers) JSON(w http.ResponseWriter, code int, v any) {
 	_ = json.NewEncoder(w).Encode(v)
 }
 
-func initProcessors(pg *postgres.Postgres, mg *mongo.Mongo) map[string]ports.Processor {
+func initProcessors(
+	pg *postgres.Postgres,
+	mg *mongo.Mongo,
+	compliance *agreements.Checker,
+	transitions *statuses.Graph,
+) map[string]ports.Processor {
 	reg := map[string]ports.Processor{}
 
 	base := processors.NewBaseProcessor(pg, mg)
@@ -58,6 +92,14 @@ func initProcessors(pg *postgres.Postgres, mg *mongo.Mongo) map[string]ports.Pro
 	execDocsRepo := database.NewExecutiveDocumentsRepo(pg)
 	enfProcRepo := database.NewEnforcementProceedingsRepo(pg)
 	agreementRepo := database.NewAgreementRepo(pg)
+	debtorRepo := database.NewDebtorRepo(pg)
+	phoneRepo := database.NewPhoneRepo(pg)
+	workplaceRepo := database.NewWorkplaceRepo(pg, "work_places")
+	addressesRepo := database.NewAddressesRepo(pg)
+	counterpartiesRepo := database.NewCounterpartiesRepo(pg)
+	agreementTypesRepo := database.NewReferenceRepo(pg, "agreement_types")
+	phoneTypesRepo := database.NewReferenceRepo(pg, "phone_types")
+	addressTypesRepo := database.NewReferenceRepo(pg, "address_types")
 
 	reg["import_actions"] = &processors.ActionsProcessor{
 		BaseProcessor:    base,
@@ -65,6 +107,8 @@ func initProcessors(pg *postgres.Postgres, mg *mongo.Mongo) map[string]ports.Pro
 		UserRepo:         usersRepo,
 		DebtStatusesRepo: debtStatusesRepo,
 		ActionsRepo:      actionRepo,
+		Transitions:      transitions,
+		Bulk:             true,
 	}
 
 	reg["import_agreements"] = &processors.AgreementsProcessor{
@@ -72,6 +116,8 @@ func initProcessors(pg *postgres.Postgres, mg *mongo.Mongo) map[string]ports.Pro
 		AgreementsRepo: agreementRepo,
 		DebtsRepo:      debtsRepo,
 		UserRepo:       usersRepo,
+
+		AgreementTypesRepo: agreementTypesRepo,
 	}
 	reg["import_executive_documents"] = &processors.ExecutiveDocumentsProcessor{
 		BaseProcessor: base,
@@ -82,34 +128,130 @@ func initProcessors(pg *postgres.Postgres, mg *mongo.Mongo) map[string]ports.Pro
 		BaseProcessor: base,
 		DebtsRepo:     debtsRepo,
 		EnfProcRepo:   enfProcRepo,
+		ExecDocsRepo:  execDocsRepo,
 	}
 	reg["add_payments"] = &processors.PaymentsProcessor{
 		BaseProcessor: base,
 		DebtsRepo:     debtsRepo,
 		UserRepo:      usersRepo,
 		PayRepo:       payRepo,
+		Compliance:    compliance,
+		Bulk:          true,
+	}
+	reg["confirm_payments"] = &processors.ConfirmPaymentsProcessor{
+		BaseProcessor: base,
+		DebtsRepo:     debtsRepo,
+		UserRepo:      usersRepo,
+		PayRepo:       payRepo,
+	}
+	reg["reverse_payments"] = &processors.ReversePaymentsProcessor{
+		BaseProcessor: base,
+		DebtsRepo:     debtsRepo,
+		UserRepo:      usersRepo,
+		PayRepo:       payRepo,
 	}
 	reg["import_user_plans"] = &processors.UserPlansProcessor{
 		BaseProcessor: base,
 		UserPlansRepo: userPlanRepo,
 		UserRepo:      usersRepo,
 	}
-	reg["distribution_debts"] = &processors.DistributionDebtsProcessor{
+	distributor := &processors.DistributionDebtsProcessor{
 		BaseProcessor: base,
+		DebtsRepo:     debtsRepo,
+	}
+	reg["distribution_debts"] = distributor
+	reg["auto_distribute"] = &processors.AutoDistributeProcessor{
+		BaseProcessor:    base,
+		Distributor:      distributor,
+		DebtStatusesRepo: debtStatusesRepo,
+	}
+
+	reg["close_debts"] = &processors.CloseDebtsProcessor{
+		BaseProcessor:    base,
+		DebtsRepo:        debtsRepo,
+		DebtStatusesRepo: debtStatusesRepo,
+		ActionsRepo:      actionRepo,
+		UserRepo:         usersRepo,
+		Transitions:      transitions,
 	}
 
 	reg["update_debts"] = &processors.UpdateDebtsProcessor{
-		BaseProcessor: base,
+		BaseProcessor:      base,
+		UserRepo:           usersRepo,
+		DebtStatusesRepo:   debtStatusesRepo,
+		CounterpartiesRepo: counterpartiesRepo,
+		ActionsRepo:        actionRepo,
+		Transitions:        transitions,
 	}
 
 	reg["import_debtors"] = &processors.DebtorsProcessor{
 		BaseProcessor: base,
 
-		DebtorsRepo:             database.NewDebtorRepo(pg),
+		DebtorsRepo:             debtorRepo,
 		DebtsRepo:               debtsRepo,
-		AddressesRepo:           database.NewAddressesRepo(pg),
-		PhonesRepo:              database.NewPhoneRepo(pg),
+		AddressesRepo:           addressesRepo,
+		PhonesRepo:              phoneRepo,
 		ContactPersonPhonesRepo: database.NewContactPersonPhonesRepo(pg),
+		WorkplacesRepo:          workplaceRepo,
+
+		CounterpartiesRepo: counterpartiesRepo,
+		DebtStatusesRepo:   debtStatusesRepo,
+	}
+
+	reg["import_workplaces"] = &processors.WorkplacesProcessor{
+		BaseProcessor:  base,
+		DebtorsRepo:    debtorRepo,
+		DebtsRepo:      debtsRepo,
+		WorkplacesRepo: workplaceRepo,
+		PhonesRepo:     phoneRepo,
+	}
+
+	reg["import_contact_persons"] = &processors.ContactPersonsProcessor{
+		BaseProcessor:      base,
+		DebtorsRepo:        debtorRepo,
+		DebtsRepo:          debtsRepo,
+		ContactPersonsRepo: database.NewContactPersonsRepo(pg),
+		PhonesRepo:         phoneRepo,
+		AddressesRepo:      addressesRepo,
+	}
+
+	reg["import_phones"] = &processors.PhonesProcessor{
+		BaseProcessor: base,
+		DebtorsRepo:   debtorRepo,
+		DebtsRepo:     debtsRepo,
+		PhonesRepo:    phoneRepo,
+
+		PhoneTypesRepo: phoneTypesRepo,
+	}
+
+	reg["import_addresses"] = &processors.AddressesProcessor{
+		BaseProcessor: base,
+		DebtorsRepo:   debtorRepo,
+		DebtsRepo:     debtsRepo,
+		AddressesRepo: addressesRepo,
+
+		AddressTypesRepo: addressTypesRepo,
+	}
+
+	// справочники
+	reg["import_counterparties"] = &processors.CounterpartiesProcessor{
+		BaseProcessor:      base,
+		CounterpartiesRepo: counterpartiesRepo,
+	}
+	reg["import_debt_statuses"] = &processors.DebtStatusesProcessor{
+		BaseProcessor:    base,
+		DebtStatusesRepo: debtStatusesRepo,
+	}
+	for importType, repo := range map[string]*database.ReferenceRepo{
+		"import_agreement_types": agreementTypesRepo,
+		"import_phone_types":     phoneTypesRepo,
+		"import_address_types":   addressTypesRepo,
+	} {
+		reg[importType] = &processors.ReferenceProcessor{
+			BaseProcessor: base,
+			ImportType:    importType,
+			Repo:          repo,
+		}
 	}
 
 	return reg
@@ -17,6 +17,9 @@ type importRequest struct {
 	BatchSize      int    `json:"batch_size"`
 	TimeoutMin     int    `json:"timeout_minutes,omitempty"`
 	ImportRecordID string `json:"import_record_id"`
+	SHA256         string `json:"sha256,omitempty"`
+	// Options — параметры конкретного типа импорта (например strict=true).
+	Options map[string]string `json:"options,omitempty"`
 }
 
 func (h *Handlers) Import(w http.ResponseWriter, r *http.Request) {
@@ -51,6 +54,9 @@ func (h *Handlers) Import(w http.ResponseWriter, r *http.Request) {
 		compound := opener.NewCompoundOpener(httpOp, s3Op, h.S3.Bucket)
 
 		svc := importer.NewService(compound, h.Registry, reqCopy.BatchSize)
+		svc.TmpDir = h.TmpDir
+		svc.Budget = h.Budget
+		svc.Workers = h.Workers
 
 		timeout := 15 * time.Minute
 		if reqCopy.TimeoutMin > 0 {
@@ -64,6 +70,8 @@ func (h *Handlers) Import(w http.ResponseWriter, r *http.Request) {
 			FilePath:       reqCopy.FilePath,
 			BatchSize:      reqCopy.BatchSize,
 			ImportRecordID: reqCopy.ImportRecordID,
+			SHA256:         reqCopy.SHA256,
+			Options:        reqCopy.Options,
 		})
 		if err != nil {
 			h.Logger.Printf("[IMPORT][ERR][BG] type=%q path=%q err=%v took=%s",
@@ -81,5 +89,6 @@ func (h *Handlers) Import(w http.ResponseWriter, r *http.Request) {
 		"file_path":        req.FilePath,
 		"batch_size":       req.BatchSize,
 		"import_record_id": req.ImportRecordID,
+		"options":          req.Options,
 	})
 }
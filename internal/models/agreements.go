@@ -4,6 +4,8 @@ import "time"
 
 type Agreement struct {
 	ID                   string
+	Number               *string
+	Status               string
 	AgreementTypeID      *int64
 	DebtID               *string
 	UserID               *int64
@@ -15,3 +17,31 @@ type Agreement struct {
 	CreatedAt            *time.Time
 	UpdatedAt            *time.Time
 }
+
+// Статусы соглашения.
+const (
+	AgreementActive     = "active"
+	AgreementSuperseded = "superseded"
+	AgreementBroken     = "broken"
+	AgreementCancelled  = "cancelled"
+)
+
+// Статусы платежа по графику.
+const (
+	InstallmentPending = "pending"
+	InstallmentPartial = "partial"
+	InstallmentPaid    = "paid"
+	InstallmentOverdue = "overdue"
+)
+
+// AgreementInstallment — платёж по графику соглашения.
+type AgreementInstallment struct {
+	ID          string
+	AgreementID string
+	No          int
+	DueDate     time.Time
+	Amount      float64
+	PaidAmount  float64
+	Status      string
+	PaidAt      *time.Time
+}
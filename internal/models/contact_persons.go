@@ -0,0 +1,9 @@
+package models
+
+type ContactPerson struct {
+	ID       string
+	DebtorID string
+	FullName string
+	TypeID   *int64
+	Comment  string
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// DebtAssignment — запись истории смены ответственного по долгу.
+type DebtAssignment struct {
+	ID               int64     `json:"id"`
+	DebtID           string    `json:"debt_id"`
+	PreviousUserID   *int64    `json:"previous_user_id"`
+	PreviousUsername *string   `json:"previous_username"`
+	NewUserID        *int64    `json:"new_user_id"`
+	NewUsername      *string   `json:"new_username"`
+	ImportRecordID   *string   `json:"import_record_id"`
+	Reason           *string   `json:"reason"`
+	AssignedAt       time.Time `json:"assigned_at"`
+}
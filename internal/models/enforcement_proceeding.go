@@ -3,12 +3,15 @@ package models
 import "time"
 
 type EnforcementProceeding struct {
+	ID                   string
 	SerialNumber         *string
 	DebtID               *string
+	ExecutiveDocumentID  *string
 	Amount               string
 	PrivateBailiffName   *string
 	PrivateBailiffRegion *string
 	StartDate            *time.Time
 	StatusAISOIP         *string
+	StatusChangedAt      *time.Time
 	CreatedAt            *time.Time
 }
@@ -4,6 +4,7 @@ import "time"
 
 type Payment struct {
 	ID                           string
+	ExternalID                   string
 	DebtID                       string
 	UserID                       string
 	Amount                       string
@@ -19,3 +20,36 @@ type Payment struct {
 	PaymentDate                  *time.Time
 	Confirmed                    bool
 }
+
+// PaymentComponents — составляющие платежа, совпадающие с колонками amount_<name>
+// в payments и debts.
+var PaymentComponents = []string{
+	"government_duty",
+	"representation_expenses",
+	"notary_fees",
+	"postage",
+	"fine",
+	"accrual",
+	"main_debt",
+}
+
+// Component возвращает указатель на поле разбивки платежа по имени составляющей.
+func (p *Payment) Component(name string) *string {
+	switch name {
+	case "government_duty":
+		return &p.AmountGovernmentDuty
+	case "representation_expenses":
+		return &p.AmountRepresentationExpenses
+	case "notary_fees":
+		return &p.AmountNotaryFees
+	case "postage":
+		return &p.AmountPostage
+	case "fine":
+		return &p.AmountFine
+	case "accrual":
+		return &p.AmountAccrual
+	case "main_debt":
+		return &p.AmountMainDebt
+	}
+	return nil
+}
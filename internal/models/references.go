@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Counterparty — контрагент (кредитор), которому принадлежат долги.
+type Counterparty struct {
+	ID             int64
+	Name           string
+	BIN            *string
+	ContractNumber *string
+	ContractDate   *time.Time
+}
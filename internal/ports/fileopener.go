@@ -11,6 +11,8 @@ type Meta struct {
 	Size        int64
 	Bucket      string
 	Key         string
+	// SHA256 — ожидаемая контрольная сумма содержимого (hex), если источник её знает.
+	SHA256 string
 }
 
 type FileOpener interface {
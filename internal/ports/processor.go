@@ -1,12 +1,53 @@
 package ports
 
-import "context"
+import (
+	"context"
+	"strings"
+)
 
 type ctxKey string
 
-const CtxImportRecordID ctxKey = "import_record_id"
+const (
+	CtxImportRecordID ctxKey = "import_record_id"
+	CtxImportOptions  ctxKey = "import_options"
+)
+
+// RowError — служебная колонка строки: источник не смог разобрать запись
+// (например, строку банковской выписки). Процессор пишет такую строку
+// в import_record_items как failed с этим текстом и не обрабатывает её.
+const RowError = "_row_error"
 
 type Processor interface {
 	Type() string
 	ProcessBatch(ctx context.Context, batch []map[string]string) error
 }
+
+// Finisher — процессор, которому нужен весь файл целиком (например, распределение
+// по всему набору долгов). Finish вызывается один раз после последнего батча;
+// readErr != nil означает, что чтение файла прервалось и накопленное состояние
+// нужно только освободить.
+type Finisher interface {
+	Finish(ctx context.Context, readErr error) error
+}
+
+// OrderSensitive — процессор, которому важен порядок строк файла между
+// батчами (последняя строка по ключу побеждает, «найти или создать»).
+// Батчи таких процессоров обрабатываются по одному, остальные — параллельно.
+type OrderSensitive interface {
+	OrderSensitive() bool
+}
+
+// ImportOption возвращает опцию импорта (поле options запроса /import) или "".
+func ImportOption(ctx context.Context, key string) string {
+	opts, _ := ctx.Value(CtxImportOptions).(map[string]string)
+	return strings.TrimSpace(opts[key])
+}
+
+// ImportFlag — булева опция импорта: 1/true/yes/on.
+func ImportFlag(ctx context.Context, key string) bool {
+	switch strings.ToLower(ImportOption(ctx, key)) {
+	case "1", "true", "yes", "y", "on":
+		return true
+	}
+	return false
+}
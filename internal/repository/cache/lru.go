@@ -0,0 +1,186 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Options — размер и сроки жизни записей кэша.
+type Options struct {
+	// Size — максимум записей; при переполнении вытесняется давно не читанная.
+	Size int
+	// TTL — срок жизни найденного значения; 0 — без срока.
+	TTL time.Duration
+	// NegativeTTL — срок жизни записи «не найдено»; 0 — промахи не кэшируются.
+	NegativeTTL time.Duration
+}
+
+// defaultSize — размер кэша, если Options.Size не задан.
+const defaultSize = 10000
+
+// DefaultOptions — настройки кэшей до вызова Configure.
+var DefaultOptions = Options{
+	Size:        defaultSize,
+	TTL:         10 * time.Minute,
+	NegativeTTL: 30 * time.Second,
+}
+
+// Stats — счётчики кэша для метрик.
+type Stats struct {
+	Name         string `json:"name"`
+	Size         int    `json:"size"`
+	Capacity     int    `json:"capacity"`
+	Hits         uint64 `json:"hits"`
+	NegativeHits uint64 `json:"negative_hits"`
+	Misses       uint64 `json:"misses"`
+	Evictions    uint64 `json:"evictions"`
+	Expired      uint64 `json:"expired"`
+}
+
+type entry[K comparable, V any] struct {
+	key     K
+	val     V
+	found   bool
+	expires time.Time
+}
+
+// LRU — потокобезопасный кэш ограниченного размера с TTL и отрицательными
+// записями («ключа нет в базе»), которые живут NegativeTTL.
+type LRU[K comparable, V any] struct {
+	name string
+
+	mu    sync.Mutex
+	opts  Options
+	ll    *list.List
+	items map[K]*list.Element
+	stats Stats
+}
+
+// New создаёт кэш и регистрирует его для Configure и AllStats.
+// Кэши создаются один раз на процесс (переменные пакета), а не на каждый репозиторий.
+func New[K comparable, V any](name string) *LRU[K, V] {
+	c := &LRU[K, V]{
+		name:  name,
+		ll:    list.New(),
+		items: make(map[K]*list.Element),
+	}
+	register(c)
+	return c
+}
+
+// Get возвращает значение по ключу. ok=false — ключа нет в кэше (или запись
+// истекла), ok=true и found=false — закэширован промах.
+func (c *LRU[K, V]) Get(key K) (val V, found, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, hit := c.items[key]
+	if !hit {
+		c.stats.Misses++
+		return val, false, false
+	}
+	e := el.Value.(*entry[K, V])
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		c.removeElement(el)
+		c.stats.Expired++
+		c.stats.Misses++
+		return val, false, false
+	}
+
+	c.ll.MoveToFront(el)
+	if e.found {
+		c.stats.Hits++
+	} else {
+		c.stats.NegativeHits++
+	}
+	return e.val, e.found, true
+}
+
+// Set кладёт найденное значение.
+func (c *LRU[K, V]) Set(key K, val V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.put(key, val, true, c.opts.TTL)
+}
+
+// SetMissing запоминает, что ключа нет в базе. При NegativeTTL=0 ничего не делает.
+func (c *LRU[K, V]) SetMissing(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.opts.NegativeTTL <= 0 {
+		return
+	}
+	var zero V
+	c.put(key, zero, false, c.opts.NegativeTTL)
+}
+
+// Delete убирает ключи из кэша (после создания или изменения записи в базе).
+func (c *LRU[K, V]) Delete(keys ...K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range keys {
+		if el, ok := c.items[k]; ok {
+			c.removeElement(el)
+		}
+	}
+}
+
+// Purge очищает кэш; счётчики сохраняются.
+func (c *LRU[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.items = make(map[K]*list.Element)
+}
+
+// Configure меняет настройки; лишние записи вытесняются сразу.
+func (c *LRU[K, V]) Configure(opts Options) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if opts.Size <= 0 {
+		opts.Size = defaultSize
+	}
+	c.opts = opts
+	c.evict()
+}
+
+// Stats — текущие счётчики.
+func (c *LRU[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Name = c.name
+	s.Size = c.ll.Len()
+	s.Capacity = c.opts.Size
+	return s
+}
+
+func (c *LRU[K, V]) put(key K, val V, found bool, ttl time.Duration) {
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[K, V])
+		e.val, e.found, e.expires = val, found, expires
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(&entry[K, V]{key: key, val: val, found: found, expires: expires})
+	c.evict()
+}
+
+func (c *LRU[K, V]) evict() {
+	for c.ll.Len() > c.opts.Size {
+		c.removeElement(c.ll.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *LRU[K, V]) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*entry[K, V]).key)
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"sort"
+	"sync"
+)
+
+// instance — то, что нужно реестру от кэша любого типа.
+type instance interface {
+	Configure(Options)
+	Stats() Stats
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []instance
+)
+
+// register применяет к кэшу текущие настройки и добавляет его в реестр.
+func register(c instance) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	c.Configure(DefaultOptions)
+	registry = append(registry, c)
+}
+
+// Configure применяет настройки ко всем зарегистрированным кэшам.
+// Вызывается при старте, до начала импортов.
+func Configure(opts Options) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if opts.Size <= 0 {
+		opts.Size = defaultSize
+	}
+	DefaultOptions = opts
+	for _, c := range registry {
+		c.Configure(opts)
+	}
+}
+
+// AllStats — счётчики всех кэшей, по имени.
+func AllStats() []Stats {
+	registryMu.Lock()
+	list := append([]instance(nil), registry...)
+	registryMu.Unlock()
+
+	out := make([]Stats, 0, len(list))
+	for _, c := range list {
+		out = append(out, c.Stats())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
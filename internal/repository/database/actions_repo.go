@@ -4,6 +4,8 @@ import (
 	"context"
 	"debtster_import/internal/config/connections/postgres"
 	"debtster_import/internal/models"
+	"errors"
+	"log"
 
 	"github.com/jackc/pgx/v5"
 )
@@ -21,10 +23,167 @@ func NewActionRepo(pg *postgres.Postgres) *ActionRepo {
 }
 
 func (r *ActionRepo) InsertActions(ctx context.Context, rows []models.Action) error {
-	if len(rows) == 0 {
+	batch, queued := r.queueActions(rows)
+	if queued == 0 {
 		return nil
 	}
 
+	br := r.pg.Pool.SendBatch(ctx, batch)
+	defer br.Close()
+
+	for i := 0; i < queued; i++ {
+		if _, err := br.Exec(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// InsertActionsTx — то же, что InsertActions, но в транзакции вызывающего.
+func (r *ActionRepo) InsertActionsTx(ctx context.Context, tx pgx.Tx, rows []models.Action) error {
+	batch, queued := r.queueActions(rows)
+	if queued == 0 {
+		return nil
+	}
+
+	br := tx.SendBatch(ctx, batch)
+	for i := 0; i < queued; i++ {
+		if _, err := br.Exec(); err != nil {
+			br.Close()
+			return err
+		}
+	}
+	return br.Close()
+}
+
+// actionsStage — временная таблица загрузки действий (CopyActions).
+var actionsStage = Stage{
+	Table: "tmp_actions",
+	Columns: []StageColumn{
+		{"id", "uuid"}, {"debt_id", "uuid"}, {"user_id", "bigint"}, {"debt_status_id", "bigint"},
+		{"type", "text"}, {"comment", "text"}, {"created_at", "timestamp"},
+	},
+}
+
+// ErrActionDebtNotFound — действие не вставлено: нет debt_id или долг не найден.
+var ErrActionDebtNotFound = errors.New("action not inserted: debt not found")
+
+// CopyActions — вставка действий через COPY во временную таблицу и один
+// INSERT … SELECT. Результат по строкам: nil — действие вставлено, иначе
+// причина (ErrActionDebtNotFound или ошибка вставки строки).
+func (r *ActionRepo) CopyActions(ctx context.Context, rows []models.Action) ([]error, error) {
+	tx, err := r.pg.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	errs, err := r.CopyActionsTx(ctx, tx, rows)
+	if err != nil {
+		return nil, err
+	}
+	return errs, tx.Commit(ctx)
+}
+
+// CopyActionsTx — то же, что CopyActions, но в транзакции вызывающего.
+// Слияние идёт в точке сохранения: если оно падает, действия вставляются
+// по одному (каждое в своей точке сохранения), и ошибка одной строки
+// не отменяет остальные.
+func (r *ActionRepo) CopyActionsTx(ctx context.Context, tx pgx.Tx, rows []models.Action) ([]error, error) {
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	src := make([][]any, len(rows))
+	for i, a := range rows {
+		src[i] = []any{a.ID, a.DebtID, a.UserID, a.DebtStatusID, a.Type, a.Comment, a.CreatedAt}
+	}
+
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := r.copyMerge(ctx, sp, src)
+	if err == nil {
+		err = sp.Commit(ctx)
+	}
+	if err != nil {
+		_ = sp.Rollback(ctx)
+		log.Printf("[ACTIONS][COPY][WARN] rows=%d bulk merge failed, retry per row: %v", len(rows), err)
+		return r.insertEachTx(ctx, tx, rows)
+	}
+
+	errs := make([]error, len(rows))
+	for i, ok := range applied {
+		if !ok {
+			errs[i] = ErrActionDebtNotFound
+		}
+	}
+	return errs, nil
+}
+
+func (r *ActionRepo) copyMerge(ctx context.Context, tx pgx.Tx, src [][]any) ([]bool, error) {
+	if err := actionsStage.Load(ctx, tx, src); err != nil {
+		return nil, err
+	}
+
+	return actionsStage.Merge(ctx, tx, len(src), `
+		WITH ins AS (
+		    INSERT INTO `+r.table+` (
+		        id, debt_id, user_id, debt_status_id, type, comment, created_at
+		    )
+		    SELECT s.id, s.debt_id, s.user_id, s.debt_status_id, s.type, s.comment, s.created_at
+		    FROM `+actionsStage.Table+` s
+		    JOIN debts d ON d.id = s.debt_id
+		    ORDER BY s.row_no
+		    ON CONFLICT (id) DO NOTHING
+		    RETURNING id
+		)
+		SELECT s.row_no FROM `+actionsStage.Table+` s JOIN ins ON ins.id = s.id`,
+	)
+}
+
+// insertEachTx вставляет действия по одному, каждое в своей точке сохранения.
+func (r *ActionRepo) insertEachTx(ctx context.Context, tx pgx.Tx, rows []models.Action) ([]error, error) {
+	errs := make([]error, len(rows))
+	for i, a := range rows {
+		if a.DebtID == nil {
+			errs[i] = ErrActionDebtNotFound
+			continue
+		}
+
+		sp, err := tx.Begin(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ct, err := sp.Exec(ctx, `
+			INSERT INTO `+r.table+` (
+				id, debt_id, user_id, debt_status_id, type, comment, created_at
+			)
+			SELECT $1::uuid, d.id, $3::bigint, $4::bigint, $5, $6, $7
+			FROM debts d
+			WHERE d.id = $2::uuid
+			ON CONFLICT (id) DO NOTHING
+		`,
+			a.ID, a.DebtID, a.UserID, a.DebtStatusID, a.Type, a.Comment, a.CreatedAt,
+		)
+		if err != nil {
+			_ = sp.Rollback(ctx)
+			errs[i] = err
+			continue
+		}
+		if err := sp.Commit(ctx); err != nil {
+			return nil, err
+		}
+		if ct.RowsAffected() == 0 {
+			errs[i] = ErrActionDebtNotFound
+		}
+	}
+	return errs, nil
+}
+
+func (r *ActionRepo) queueActions(rows []models.Action) (*pgx.Batch, int) {
 	batch := &pgx.Batch{}
 	queued := 0
 
@@ -45,20 +204,7 @@ func (r *ActionRepo) InsertActions(ctx context.Context, rows []models.Action) er
 		queued++
 	}
 
-	if queued == 0 {
-		return nil
-	}
-
-	br := r.pg.Pool.SendBatch(ctx, batch)
-	defer br.Close()
-
-	for i := 0; i < queued; i++ {
-		if _, err := br.Exec(); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return batch, queued
 }
 
 func (r *ActionRepo) GetTableName() string {
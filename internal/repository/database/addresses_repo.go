@@ -8,6 +8,8 @@ import (
 	"strings"
 )
 
+const debtorSubjectType = `App\Infrastructure\Persistence\Models\Debtor`
+
 type AddressesRepo struct {
 	pg *postgres.Postgres
 }
@@ -34,13 +36,19 @@ func (r *AddressesRepo) SaveAddress(ctx context.Context, row models.Address) err
 		typeID = *row.TypeID
 	}
 
+	return r.SaveSubjectAddress(ctx, debtorSubjectType, row.DebtorID, row.Address, typeID)
+}
+
+// SaveSubjectAddress сохраняет адрес произвольного субъекта (должник, контактное лицо...):
+// один адрес на (subject, type_id), существующий обновляется.
+func (r *AddressesRepo) SaveSubjectAddress(ctx context.Context, subjectType, subjectID, address string, typeID int) error {
 	table := "addresses"
 	var exists bool
 	checkQuery := fmt.Sprintf(
-		`SELECT EXISTS(SELECT 1 FROM %s WHERE subject_id = $1 AND type_id = $2)`,
+		`SELECT EXISTS(SELECT 1 FROM %s WHERE subject_type = $1 AND subject_id = $2 AND type_id = $3 AND deleted_at IS NULL)`,
 		table,
 	)
-	err := r.pg.Pool.QueryRow(ctx, checkQuery, row.DebtorID, typeID).Scan(&exists)
+	err := r.pg.Pool.QueryRow(ctx, checkQuery, subjectType, subjectID, typeID).Scan(&exists)
 	if err != nil {
 		return fmt.Errorf("check exists error: %w", err)
 	}
@@ -49,9 +57,9 @@ func (r *AddressesRepo) SaveAddress(ctx context.Context, row models.Address) err
 		updateQuery := fmt.Sprintf(`
 			UPDATE %s
 			SET address = $1, updated_at = NOW()
-			WHERE subject_id = $2 AND type_id = $3
+			WHERE subject_type = $2 AND subject_id = $3 AND type_id = $4 AND deleted_at IS NULL
 		`, table)
-		_, err = r.pg.Pool.Exec(ctx, updateQuery, row.Address, row.DebtorID, typeID)
+		_, err = r.pg.Pool.Exec(ctx, updateQuery, address, subjectType, subjectID, typeID)
 		if err != nil {
 			return fmt.Errorf("update address error: %w", err)
 		}
@@ -60,12 +68,11 @@ func (r *AddressesRepo) SaveAddress(ctx context.Context, row models.Address) err
 			INSERT INTO %s (
 				id, subject_type, subject_id, address, type_id, created_at, updated_at
 			) VALUES (
-				gen_random_uuid(),
-				'App\Infrastructure\Persistence\Models\Debtor',
-				$1, $2, $3, NOW(), NOW()
+				gen_random_uuid(), $1, $2, $3, $4, NOW(), NOW()
 			)
+			ON CONFLICT `+addressActiveKey+` WHERE deleted_at IS NULL DO NOTHING
 		`, table)
-		_, err = r.pg.Pool.Exec(ctx, insertQuery, row.DebtorID, row.Address, typeID)
+		_, err = r.pg.Pool.Exec(ctx, insertQuery, subjectType, subjectID, address, typeID)
 		if err != nil {
 			return fmt.Errorf("insert address error: %w", err)
 		}
@@ -74,6 +81,76 @@ func (r *AddressesRepo) SaveAddress(ctx context.Context, row models.Address) err
 	return nil
 }
 
+// addressActiveKey — выражение уникального индекса addresses_subject_address_active_uniq
+// (миграция 011): адрес сравнивается без учёта регистра и лишних пробелов.
+const addressActiveKey = `(subject_type, subject_id, type_id, (LOWER(REGEXP_REPLACE(BTRIM(address), '\s+', ' ', 'g'))))`
+
+// AddAddress добавляет адрес субъекту, если такого же (без учёта регистра и пробелов)
+// активного адреса этого типа ещё нет. added=false — адрес уже был.
+func (r *AddressesRepo) AddAddress(ctx context.Context, subjectType, subjectID, address string, typeID int) (bool, error) {
+	address = strings.Join(strings.Fields(address), " ")
+	if address == "" || subjectID == "" {
+		return false, nil
+	}
+
+	tag, err := r.pg.Pool.Exec(ctx, `
+		INSERT INTO addresses (
+			id, subject_type, subject_id, address, type_id, created_at, updated_at
+		)
+		VALUES (gen_random_uuid(), $1, $2, $3, $4, NOW(), NOW())
+		ON CONFLICT `+addressActiveKey+` WHERE deleted_at IS NULL DO NOTHING
+	`, subjectType, subjectID, address, typeID)
+	if err != nil {
+		return false, fmt.Errorf("insert address error: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// ReplaceTypeAddress делает address единственным активным адресом данного типа:
+// остальные адреса этого типа деактивируются.
+func (r *AddressesRepo) ReplaceTypeAddress(ctx context.Context, subjectType, subjectID, address string, typeID int) (removed int, err error) {
+	address = strings.Join(strings.Fields(address), " ")
+	if address == "" || subjectID == "" {
+		return 0, nil
+	}
+
+	tag, err := r.pg.Pool.Exec(ctx, `
+		UPDATE addresses
+		SET deleted_at = NOW(), updated_at = NOW()
+		WHERE subject_type = $1 AND subject_id = $2 AND type_id = $3
+		  AND deleted_at IS NULL
+		  AND LOWER(REGEXP_REPLACE(BTRIM(address), '\s+', ' ', 'g')) <> LOWER($4)
+	`, subjectType, subjectID, typeID, address)
+	if err != nil {
+		return 0, fmt.Errorf("deactivate addresses error: %w", err)
+	}
+
+	if _, err := r.AddAddress(ctx, subjectType, subjectID, address, typeID); err != nil {
+		return int(tag.RowsAffected()), err
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// DeactivateAddresses деактивирует адреса данного типа; если address задан —
+// только совпадающие с ним.
+func (r *AddressesRepo) DeactivateAddresses(ctx context.Context, subjectType, subjectID, address string, typeID int) (int, error) {
+	address = strings.Join(strings.Fields(address), " ")
+
+	tag, err := r.pg.Pool.Exec(ctx, `
+		UPDATE addresses
+		SET deleted_at = NOW(), updated_at = NOW()
+		WHERE subject_type = $1 AND subject_id = $2 AND type_id = $3
+		  AND deleted_at IS NULL
+		  AND ($4 = '' OR LOWER(REGEXP_REPLACE(BTRIM(address), '\s+', ' ', 'g')) = LOWER($4))
+	`, subjectType, subjectID, typeID, address)
+	if err != nil {
+		return 0, fmt.Errorf("deactivate addresses error: %w", err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
 func (r *AddressesRepo) SaveBatchAddresses(ctx context.Context, rows []models.Address) error {
 	for _, row := range rows {
 		if err := r.SaveAddress(ctx, row); err != nil {
@@ -4,94 +4,280 @@ import (
 	"context"
 	"debtster_import/internal/config/connections/postgres"
 	"debtster_import/internal/models"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
 )
 
 type AgreementRepo struct {
-	pg    *postgres.Postgres
-	table string
+	pg            *postgres.Postgres
+	table         string
+	scheduleTable string
 }
 
 func NewAgreementRepo(pg *postgres.Postgres) *AgreementRepo {
 	return &AgreementRepo{
-		pg:    pg,
-		table: "agreements",
+		pg:            pg,
+		table:         "agreements",
+		scheduleTable: "agreement_schedule",
 	}
 }
 
-func (r *AgreementRepo) UpdateOrCreate(ctx context.Context, a models.Agreement) (*models.Agreement, error) {
-
-	// ---------- 1) Пытаемся обновить ----------
-	updateQuery := `
-		UPDATE ` + r.table + `
-		SET 
-			agreement_type_id      = $2,
-			user_id                = $3,
-			amount_debt            = $4,
-			monthly_payment_amount = $5,
-			scheduled_payment_day  = $6,
-			start_date             = $7,
-			end_date               = $8,
-			updated_at             = NOW()
-		WHERE debt_id = $1::uuid
-		RETURNING 
-			id, agreement_type_id, debt_id, user_id, amount_debt,
-			monthly_payment_amount, scheduled_payment_day,
-			start_date, end_date, created_at, updated_at
-	`
+// AgreementSaveResult — что произошло при сохранении соглашения.
+type AgreementSaveResult struct {
+	Created    bool
+	Superseded int64 // сколько прежних действующих соглашений долга заменено
+}
+
+const agreementReturning = `
+	RETURNING
+		id, number, status, agreement_type_id, debt_id, user_id,
+		amount_debt, monthly_payment_amount,
+		scheduled_payment_day, start_date,
+		end_date, created_at, updated_at
+`
 
-	var out models.Agreement
-	err := r.pg.Pool.QueryRow(ctx, updateQuery,
-		a.DebtID, a.AgreementTypeID, a.UserID, a.AmountDebt,
-		a.MonthlyPaymentAmount, a.ScheduledPaymentDay,
-		a.StartDate, a.EndDate,
-	).Scan(
-		&out.ID, &out.AgreementTypeID, &out.DebtID, &out.UserID,
+func scanAgreement(row pgx.Row, out *models.Agreement) error {
+	return row.Scan(
+		&out.ID, &out.Number, &out.Status, &out.AgreementTypeID, &out.DebtID, &out.UserID,
 		&out.AmountDebt, &out.MonthlyPaymentAmount,
 		&out.ScheduledPaymentDay, &out.StartDate,
 		&out.EndDate, &out.CreatedAt, &out.UpdatedAt,
 	)
+}
+
+// UpdateOrCreate сохраняет соглашение и его график в одной транзакции.
+//
+// С номером соглашение ищется по (debt_id, number); новое соглашение
+// заменяет прочие действующие и нарушенные соглашения долга
+// (status=superseded), они остаются в истории. Без номера обновляется действующее соглашение долга.
+// График (schedule) полностью перезаписывается.
+func (r *AgreementRepo) UpdateOrCreate(
+	ctx context.Context,
+	a models.Agreement,
+	schedule []models.AgreementInstallment,
+) (*models.Agreement, AgreementSaveResult, error) {
+	var res AgreementSaveResult
+
+	tx, err := r.pg.Pool.Begin(ctx)
+	if err != nil {
+		return nil, res, err
+	}
+	defer tx.Rollback(ctx)
+
+	// ---------- 1) Ищем существующее соглашение ----------
+	var existingID string
+	if a.Number != nil {
+		err = tx.QueryRow(ctx,
+			`SELECT id::text FROM `+r.table+` WHERE debt_id = $1::uuid AND number = $2 LIMIT 1 FOR UPDATE`,
+			a.DebtID, *a.Number,
+		).Scan(&existingID)
+	} else {
+		err = tx.QueryRow(ctx,
+			`SELECT id::text FROM `+r.table+`
+			 WHERE debt_id = $1::uuid AND status = $2
+			 ORDER BY created_at DESC
+			 LIMIT 1 FOR UPDATE`,
+			a.DebtID, models.AgreementActive,
+		).Scan(&existingID)
+	}
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, res, err
+	}
+
+	var out models.Agreement
 
-	if err == nil {
-		// Успешно обновили
-		return &out, nil
-	}
-
-	// ---------- 2) Если не обновилось — делаем INSERT ----------
-	insertQuery := `
-		INSERT INTO ` + r.table + ` (
-			agreement_type_id, debt_id, user_id, amount_debt,
-			monthly_payment_amount, scheduled_payment_day,
-			start_date, end_date, created_at, updated_at
-		) VALUES (
-			$1, $2::uuid, $3, $4::numeric, $5::numeric,
-			$6, $7::date, $8::date, 
-			COALESCE($9, NOW()), NOW()
+	if existingID != "" {
+		// ---------- 2a) Обновляем ----------
+		err = scanAgreement(tx.QueryRow(ctx, `
+			UPDATE `+r.table+`
+			SET
+				agreement_type_id      = $2,
+				user_id                = $3,
+				amount_debt            = $4,
+				monthly_payment_amount = $5,
+				scheduled_payment_day  = $6,
+				start_date             = $7,
+				end_date               = $8,
+				updated_at             = NOW()
+			WHERE id = $1::uuid
+		`+agreementReturning,
+			existingID, a.AgreementTypeID, a.UserID, a.AmountDebt,
+			a.MonthlyPaymentAmount, a.ScheduledPaymentDay,
+			a.StartDate, a.EndDate,
+		), &out)
+		if err != nil {
+			return nil, res, err
+		}
+	} else {
+		// ---------- 2b) Создаём ----------
+		err = scanAgreement(tx.QueryRow(ctx, `
+			INSERT INTO `+r.table+` (
+				number, status, agreement_type_id, debt_id, user_id, amount_debt,
+				monthly_payment_amount, scheduled_payment_day,
+				start_date, end_date, created_at, updated_at
+			) VALUES (
+				$1, $2, $3, $4::uuid, $5, $6::numeric, $7::numeric,
+				$8, $9::date, $10::date,
+				COALESCE($11, NOW()), NOW()
+			)
+		`+agreementReturning,
+			a.Number, models.AgreementActive, a.AgreementTypeID, a.DebtID, a.UserID, a.AmountDebt,
+			a.MonthlyPaymentAmount, a.ScheduledPaymentDay,
+			a.StartDate, a.EndDate, a.CreatedAt,
+		), &out)
+		if err != nil {
+			return nil, res, err
+		}
+		res.Created = true
+
+		// ---------- 3) Новое соглашение заменяет прежние ----------
+		ct, err := tx.Exec(ctx, `
+			UPDATE `+r.table+`
+			SET status = $3, superseded_at = NOW(), updated_at = NOW()
+			WHERE debt_id = $1::uuid AND id <> $2::uuid AND status = ANY($4::text[])`,
+			a.DebtID, out.ID, models.AgreementSuperseded,
+			[]string{models.AgreementActive, models.AgreementBroken},
 		)
-		RETURNING
-			id, agreement_type_id, debt_id, user_id,
-			amount_debt, monthly_payment_amount,
-			scheduled_payment_day, start_date,
-			end_date, created_at, updated_at
-	`
-
-	err = r.pg.Pool.QueryRow(ctx, insertQuery,
-		a.AgreementTypeID, a.DebtID, a.UserID, a.AmountDebt,
-		a.MonthlyPaymentAmount, a.ScheduledPaymentDay,
-		a.StartDate, a.EndDate, a.CreatedAt,
-	).Scan(
-		&out.ID, &out.AgreementTypeID, &out.DebtID, &out.UserID,
-		&out.AmountDebt, &out.MonthlyPaymentAmount,
-		&out.ScheduledPaymentDay, &out.StartDate,
-		&out.EndDate, &out.CreatedAt, &out.UpdatedAt,
+		if err != nil {
+			return nil, res, err
+		}
+		res.Superseded = ct.RowsAffected()
+	}
+
+	// ---------- 4) График ----------
+	if _, err := tx.Exec(ctx,
+		`DELETE FROM `+r.scheduleTable+` WHERE agreement_id = $1::uuid`, out.ID,
+	); err != nil {
+		return nil, res, err
+	}
+	if len(schedule) > 0 {
+		b := &pgx.Batch{}
+		for _, it := range schedule {
+			b.Queue(
+				`INSERT INTO `+r.scheduleTable+` (agreement_id, installment_no, due_date, amount)
+				 VALUES ($1::uuid, $2, $3::date, $4::numeric)`,
+				out.ID, it.No, it.DueDate, it.Amount,
+			)
+		}
+		if err := tx.SendBatch(ctx, b).Close(); err != nil {
+			return nil, res, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, res, err
+	}
+	return &out, res, nil
+}
+
+func (r *AgreementRepo) GetTableName() string {
+	return r.table
+}
+
+// ListCheckable возвращает соглашения для сверки графика: действующие и
+// нарушенные (нарушение снимается, если график снова выполнен); debtIDs
+// ограничивает выборку долгами (nil — все соглашения).
+func (r *AgreementRepo) ListCheckable(ctx context.Context, debtIDs []string) ([]models.Agreement, error) {
+	rows, err := r.pg.Pool.Query(ctx, `
+		SELECT id, number, status, agreement_type_id, debt_id, user_id,
+		       amount_debt, monthly_payment_amount,
+		       scheduled_payment_day, start_date,
+		       end_date, created_at, updated_at
+		FROM `+r.table+`
+		WHERE status = ANY($1::text[])
+		  AND ($2::text[] IS NULL OR debt_id = ANY($2::text[]::uuid[]))
+		ORDER BY debt_id, created_at`,
+		[]string{models.AgreementActive, models.AgreementBroken}, debtIDs,
 	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
+	var out []models.Agreement
+	for rows.Next() {
+		var a models.Agreement
+		if err := scanAgreement(rows, &a); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
+
+// Schedules возвращает графики соглашений: agreement_id → платежи по порядку.
+func (r *AgreementRepo) Schedules(ctx context.Context, agreementIDs []string) (map[string][]models.AgreementInstallment, error) {
+	rows, err := r.pg.Pool.Query(ctx, `
+		SELECT id::text, agreement_id::text, installment_no, due_date,
+		       amount::float8, paid_amount::float8, status, paid_at
+		FROM `+r.scheduleTable+`
+		WHERE agreement_id = ANY($1::text[]::uuid[])
+		ORDER BY agreement_id, installment_no`,
+		agreementIDs,
+	)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return &out, nil
+	out := make(map[string][]models.AgreementInstallment, len(agreementIDs))
+	for rows.Next() {
+		var it models.AgreementInstallment
+		if err := rows.Scan(
+			&it.ID, &it.AgreementID, &it.No, &it.DueDate,
+			&it.Amount, &it.PaidAmount, &it.Status, &it.PaidAt,
+		); err != nil {
+			return nil, err
+		}
+		out[it.AgreementID] = append(out[it.AgreementID], it)
+	}
+	return out, rows.Err()
 }
 
-func (r *AgreementRepo) GetTableName() string {
-	return r.table
+// UpdateInstallments сохраняет оплату и статусы платежей по графику.
+func (r *AgreementRepo) UpdateInstallments(ctx context.Context, items []models.AgreementInstallment) error {
+	if len(items) == 0 {
+		return nil
+	}
+	b := &pgx.Batch{}
+	for _, it := range items {
+		b.Queue(`
+			UPDATE `+r.scheduleTable+`
+			SET paid_amount = $2::numeric, status = $3, paid_at = $4::date, updated_at = NOW()
+			WHERE id = $1::uuid`,
+			it.ID, it.PaidAmount, it.Status, it.PaidAt,
+		)
+	}
+	return r.pg.Pool.SendBatch(ctx, b).Close()
+}
+
+// MarkBroken переводит действующее соглашение в status=broken.
+// Возвращает false, если соглашение уже не действующее.
+func (r *AgreementRepo) MarkBroken(ctx context.Context, id string) (bool, error) {
+	ct, err := r.pg.Pool.Exec(ctx, `
+		UPDATE `+r.table+`
+		SET status = $2, updated_at = NOW()
+		WHERE id = $1::uuid AND status = $3`,
+		id, models.AgreementBroken, models.AgreementActive,
+	)
+	if err != nil {
+		return false, err
+	}
+	return ct.RowsAffected() > 0, nil
+}
+
+// Restore возвращает нарушенное соглашение в status=active.
+// Возвращает false, если соглашение уже не нарушенное.
+func (r *AgreementRepo) Restore(ctx context.Context, id string) (bool, error) {
+	ct, err := r.pg.Pool.Exec(ctx, `
+		UPDATE `+r.table+`
+		SET status = $2, updated_at = NOW()
+		WHERE id = $1::uuid AND status = $3`,
+		id, models.AgreementActive, models.AgreementBroken,
+	)
+	if err != nil {
+		return false, err
+	}
+	return ct.RowsAffected() > 0, nil
 }
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"debtster_import/internal/config/connections/postgres"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// stageRowColumn — номер строки во входном срезе; по нему merge-запрос
+// сообщает, какие строки применены.
+const stageRowColumn = "row_no"
+
+// StageColumn — колонка временной таблицы загрузки.
+type StageColumn struct {
+	Name string
+	Type string
+}
+
+// Stage — временная таблица сессии для массовой загрузки через COPY.
+// Таблица создаётся в транзакции с ON COMMIT DROP, колонка row_no
+// добавляется автоматически.
+type Stage struct {
+	Table   string
+	Columns []StageColumn
+}
+
+// Load создаёт временную таблицу и копирует в неё rows (значения в порядке
+// Columns, без row_no).
+func (s Stage) Load(ctx context.Context, tx pgx.Tx, rows [][]any) error {
+	defs := make([]string, 0, len(s.Columns)+1)
+	names := make([]string, 0, len(s.Columns)+1)
+	defs = append(defs, stageRowColumn+" integer NOT NULL")
+	names = append(names, stageRowColumn)
+	for _, c := range s.Columns {
+		defs = append(defs, c.Name+" "+c.Type)
+		names = append(names, c.Name)
+	}
+
+	if _, err := tx.Exec(ctx,
+		`CREATE TEMP TABLE `+s.Table+` (`+strings.Join(defs, ", ")+`) ON COMMIT DROP`,
+	); err != nil {
+		return fmt.Errorf("stage %s: %w", s.Table, err)
+	}
+
+	src := make([][]any, len(rows))
+	for i, r := range rows {
+		row := make([]any, 0, len(r)+1)
+		row = append(row, i)
+		src[i] = append(row, r...)
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{s.Table}, names, pgx.CopyFromRows(src)); err != nil {
+		return fmt.Errorf("copy %s: %w", s.Table, err)
+	}
+	return nil
+}
+
+// Merge выполняет set-based запрос слияния, который возвращает row_no
+// применённых строк, и отмечает их в результате длины n.
+func (s Stage) Merge(ctx context.Context, tx pgx.Tx, n int, query string, args ...any) ([]bool, error) {
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("merge %s: %w", s.Table, err)
+	}
+	defer rows.Close()
+
+	applied := make([]bool, n)
+	for rows.Next() {
+		var rowNo int
+		if err := rows.Scan(&rowNo); err != nil {
+			return nil, err
+		}
+		if rowNo >= 0 && rowNo < n {
+			applied[rowNo] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("merge %s: %w", s.Table, err)
+	}
+	return applied, nil
+}
+
+// CopyMerge — загрузка rows во временную таблицу и слияние одной
+// транзакцией. Результат — применена ли каждая строка rows.
+func CopyMerge(ctx context.Context, pg *postgres.Postgres, s Stage, rows [][]any, query string, args ...any) ([]bool, error) {
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	tx, err := pg.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := s.Load(ctx, tx, rows); err != nil {
+		return nil, err
+	}
+	applied, err := s.Merge(ctx, tx, len(rows), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"context"
 	"debtster_import/internal/config/connections/postgres"
+	"debtster_import/internal/validation"
 	"fmt"
 	"strings"
 )
@@ -22,11 +23,14 @@ type ContactPersonPhoneRow struct {
 	Value    string
 }
 
-func (r *ContactPersonPhonesRepo) SaveContactPersonPhones(ctx context.Context, row ContactPersonPhoneRow) error {
+// SaveContactPersonPhones разбирает упакованный формат phone,name,type|phone,name,type.
+// Возвращает предупреждения по номерам, не прошедшим нормализацию.
+func (r *ContactPersonPhonesRepo) SaveContactPersonPhones(ctx context.Context, row ContactPersonPhoneRow) ([]string, error) {
 	if strings.TrimSpace(row.Value) == "" || row.DebtorID == "" {
-		return nil
+		return nil, nil
 	}
 
+	var warnings []string
 	entries := strings.Split(row.Value, "|")
 
 	for _, entry := range entries {
@@ -40,8 +44,12 @@ func (r *ContactPersonPhonesRepo) SaveContactPersonPhones(ctx context.Context, r
 			continue
 		}
 
-		phone := sanitizePhone(parts[0])
-		if phone == "" {
+		if strings.TrimSpace(parts[0]) == "" {
+			continue
+		}
+		phone, err := validation.NormalizePhone(parts[0])
+		if err != nil {
+			warnings = append(warnings, "contact phone: "+err.Error())
 			continue
 		}
 
@@ -59,7 +67,7 @@ func (r *ContactPersonPhonesRepo) SaveContactPersonPhones(ctx context.Context, r
 
 		contactPersonID, err := r.upsertContactPerson(ctx, row.DebtorID, fullname, typeID)
 		if err != nil {
-			return fmt.Errorf("upsert contact person failed: %w", err)
+			return warnings, fmt.Errorf("upsert contact person failed: %w", err)
 		}
 
 		err = r.insertPhone(ctx,
@@ -69,11 +77,11 @@ func (r *ContactPersonPhonesRepo) SaveContactPersonPhones(ctx context.Context, r
 			typeID,
 		)
 		if err != nil {
-			return fmt.Errorf("insert phone failed: %w", err)
+			return warnings, fmt.Errorf("insert phone failed: %w", err)
 		}
 	}
 
-	return nil
+	return warnings, nil
 }
 
 func (r *ContactPersonPhonesRepo) upsertContactPerson(ctx context.Context, debtorID, fullName string, typeID int) (string, error) {
@@ -103,13 +111,17 @@ func (r *ContactPersonPhonesRepo) upsertContactPerson(ctx context.Context, debto
 	return id, err
 }
 
-func (r *ContactPersonPhonesRepo) insertPhone(ctx context.Context, subjectType, subjectID, phone string, typeID int) error {
+func (r *ContactPersonPhonesRepo) insertPhone(ctx context.Context, subjectType, subjectID string, phone validation.Phone, typeID int) error {
 	phonesTable := "phones"
 	query := fmt.Sprintf(`
 		INSERT INTO %s (id, subject_type, subject_id, phone, type_id, created_at, updated_at)
-		VALUES (gen_random_uuid(), $1, $2, $3, $4, NOW(), NOW())
-	`, phonesTable)
+		SELECT gen_random_uuid(), $1, $2, $3, $4, NOW(), NOW()
+		WHERE NOT EXISTS (
+			SELECT 1 FROM %s
+			WHERE subject_type = $1 AND subject_id = $2 AND phone = ANY($5) AND deleted_at IS NULL
+		)
+	`, phonesTable, phonesTable)
 
-	_, err := r.pg.Pool.Exec(ctx, query, subjectType, subjectID, phone, typeID)
+	_, err := r.pg.Pool.Exec(ctx, query, subjectType, subjectID, phone.Digits, typeID, phone.Variants())
 	return err
 }
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"debtster_import/internal/config/connections/postgres"
+	"debtster_import/internal/models"
+	"debtster_import/internal/repository/cache"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type ContactPersonsRepo struct {
+	pg         *postgres.Postgres
+	table      string
+	typesTable string
+
+	// typeCache — название типа связи → id, общий для всех ContactPersonsRepo.
+	typeCache *cache.LRU[string, int64]
+}
+
+func NewContactPersonsRepo(pg *postgres.Postgres) *ContactPersonsRepo {
+	return &ContactPersonsRepo{
+		pg:         pg,
+		table:      "contact_persons",
+		typesTable: "contact_person_types",
+		typeCache:  contactPersonTypeCache,
+	}
+}
+
+func (r *ContactPersonsRepo) GetTableName() string {
+	return r.table
+}
+
+// GetTypeIDByName ищет тип связи (родственник, супруг(а), коллега...) по названию без учёта регистра.
+// Возвращает nil, nil если тип не найден.
+func (r *ContactPersonsRepo) GetTypeIDByName(ctx context.Context, name string) (*int64, error) {
+	key := normalizeName(name)
+	if key == "" {
+		return nil, nil
+	}
+
+	id, found, ok := r.typeCache.Get(key)
+	if ok {
+		if !found {
+			return nil, nil
+		}
+		return &id, nil
+	}
+
+	err := r.pg.Pool.QueryRow(ctx,
+		`SELECT id FROM `+r.typesTable+` WHERE LOWER(BTRIM(name)) = $1 LIMIT 1`,
+		key,
+	).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		r.typeCache.SetMissing(key)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.typeCache.Set(key, id)
+	return &id, nil
+}
+
+// UpdateOrCreate ищет контактное лицо должника по ФИО (регистр, ё/е и лишние пробелы
+// не учитываются) и обновляет его, иначе создаёт новое. created=true для новой записи.
+func (r *ContactPersonsRepo) UpdateOrCreate(ctx context.Context, c models.ContactPerson) (id string, created bool, err error) {
+	c.FullName = strings.Join(strings.Fields(c.FullName), " ")
+	c.Comment = strings.TrimSpace(c.Comment)
+
+	err = r.pg.Pool.QueryRow(ctx, `
+		SELECT id FROM `+r.table+`
+		WHERE debtor_id = $1
+		  AND REPLACE(LOWER(REGEXP_REPLACE(BTRIM(full_name), '\s+', ' ', 'g')), 'ё', 'е') = $2
+		ORDER BY created_at
+		LIMIT 1
+	`, c.DebtorID, normalizeName(c.FullName)).Scan(&id)
+
+	if err == nil {
+		_, err = r.pg.Pool.Exec(ctx, `
+			UPDATE `+r.table+`
+			SET type_id = COALESCE($1, type_id),
+			    comment = COALESCE(NULLIF($2, ''), comment),
+			    updated_at = NOW()
+			WHERE id = $3
+		`, c.TypeID, c.Comment, id)
+		return id, false, err
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return "", false, err
+	}
+
+	typeID := int64(1)
+	if c.TypeID != nil {
+		typeID = *c.TypeID
+	}
+
+	err = r.pg.Pool.QueryRow(ctx, `
+		INSERT INTO `+r.table+` (id, debtor_id, full_name, type_id, comment, created_at, updated_at)
+		VALUES (gen_random_uuid(), $1, $2, $3, NULLIF($4, ''), NOW(), NOW())
+		RETURNING id
+	`, c.DebtorID, c.FullName, typeID, c.Comment).Scan(&id)
+
+	return id, err == nil, err
+}
+
+func normalizeName(s string) string {
+	s = strings.ToLower(strings.Join(strings.Fields(s), " "))
+	return strings.ReplaceAll(s, "ё", "е")
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"context"
+	"debtster_import/internal/config/connections/postgres"
+	"debtster_import/internal/models"
+	"debtster_import/internal/repository/cache"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type CounterpartiesRepo struct {
+	pg    *postgres.Postgres
+	table string
+
+	// cache — БИН или название в нижнем регистре → id, общий для всех CounterpartiesRepo.
+	cache *cache.LRU[string, int64]
+}
+
+func NewCounterpartiesRepo(pg *postgres.Postgres) *CounterpartiesRepo {
+	return &CounterpartiesRepo{
+		pg:    pg,
+		table: "counterparties",
+		cache: counterpartyCache,
+	}
+}
+
+func (r *CounterpartiesRepo) GetTableName() string {
+	return r.table
+}
+
+// Resolve ищет контрагента по БИН (12 цифр) или по названию без учёта регистра.
+// Возвращает nil, nil если не найден.
+func (r *CounterpartiesRepo) Resolve(ctx context.Context, nameOrBIN string) (*int64, error) {
+	key := strings.ToLower(strings.Join(strings.Fields(nameOrBIN), " "))
+	if key == "" {
+		return nil, nil
+	}
+
+	id, found, ok := r.cache.Get(key)
+	if ok {
+		if !found {
+			return nil, nil
+		}
+		return &id, nil
+	}
+
+	var err error
+	if isBIN(key) {
+		err = r.pg.Pool.QueryRow(ctx,
+			`SELECT id FROM `+r.table+` WHERE bin = $1 LIMIT 1`, key,
+		).Scan(&id)
+	} else {
+		err = r.pg.Pool.QueryRow(ctx,
+			`SELECT id FROM `+r.table+` WHERE LOWER(BTRIM(name)) = $1 LIMIT 1`, key,
+		).Scan(&id)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		r.cache.SetMissing(key)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.cache.Set(key, id)
+	return &id, nil
+}
+
+// Upsert создаёт или обновляет контрагента. Существующий ищется по БИН,
+// а если БИН не задан — по названию. Пустые поля не затирают сохранённые.
+func (r *CounterpartiesRepo) Upsert(ctx context.Context, c models.Counterparty) (int64, bool, error) {
+	name := collapseSpaces(c.Name)
+
+	lookup := name
+	if c.BIN != nil && *c.BIN != "" {
+		lookup = *c.BIN
+	}
+	existing, err := r.Resolve(ctx, lookup)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var id int64
+	if existing != nil {
+		id = *existing
+		_, err = r.pg.Pool.Exec(ctx, `
+			UPDATE `+r.table+`
+			SET name            = COALESCE(NULLIF($2, ''), name),
+			    bin             = COALESCE($3, bin),
+			    contract_number = COALESCE($4, contract_number),
+			    contract_date   = COALESCE($5, contract_date),
+			    updated_at      = NOW()
+			WHERE id = $1`,
+			id, name, c.BIN, c.ContractNumber, c.ContractDate,
+		)
+	} else {
+		err = r.pg.Pool.QueryRow(ctx, `
+			INSERT INTO `+r.table+` (name, bin, contract_number, contract_date, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, NOW(), NOW())
+			RETURNING id`,
+			name, c.BIN, c.ContractNumber, c.ContractDate,
+		).Scan(&id)
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	if name != "" {
+		r.cache.Set(strings.ToLower(name), id)
+	}
+	if c.BIN != nil && *c.BIN != "" {
+		r.cache.Set(*c.BIN, id)
+	}
+
+	return id, existing == nil, nil
+}
+
+func isBIN(s string) bool {
+	if len(s) != 12 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
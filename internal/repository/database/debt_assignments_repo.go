@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+
+	"debtster_import/internal/config/connections/postgres"
+	"debtster_import/internal/models"
+)
+
+// AssignmentHistoryTable — таблица истории назначений (migrations/004).
+const AssignmentHistoryTable = "debt_assignment_history"
+
+// RecordAssignmentSQL — вставка записи истории; используется внутри CTE
+// смены debts.user_id. Ожидает CTE upd(id, previous_user_id, new_user_id)
+// и параметры import_record_id и reason под переданными номерами.
+func RecordAssignmentSQL(importRecordParam, reasonParam string) string {
+	return `INSERT INTO ` + AssignmentHistoryTable + ` (debt_id, previous_user_id, new_user_id, import_record_id, reason, assigned_at)
+		SELECT id, previous_user_id, new_user_id, NULLIF(` + importRecordParam + `, ''), NULLIF(` + reasonParam + `, ''), NOW()
+		FROM upd`
+}
+
+type DebtAssignmentsRepo struct {
+	pg *postgres.Postgres
+}
+
+func NewDebtAssignmentsRepo(pg *postgres.Postgres) *DebtAssignmentsRepo {
+	return &DebtAssignmentsRepo{pg: pg}
+}
+
+func (r *DebtAssignmentsRepo) GetTableName() string {
+	return AssignmentHistoryTable
+}
+
+// ListByDebtNumber возвращает историю назначений долга в хронологическом порядке.
+func (r *DebtAssignmentsRepo) ListByDebtNumber(ctx context.Context, number string) ([]models.DebtAssignment, error) {
+	rows, err := r.pg.Pool.Query(ctx, `
+		SELECT h.id, h.debt_id::text,
+		       h.previous_user_id, pu.username,
+		       h.new_user_id, nu.username,
+		       h.import_record_id, h.reason, h.assigned_at
+		FROM `+AssignmentHistoryTable+` h
+		JOIN debts d ON d.id = h.debt_id
+		LEFT JOIN users pu ON pu.id = h.previous_user_id
+		LEFT JOIN users nu ON nu.id = h.new_user_id
+		WHERE d.number = $1
+		ORDER BY h.assigned_at, h.id`,
+		number,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make([]models.DebtAssignment, 0)
+	for rows.Next() {
+		var a models.DebtAssignment
+		if err := rows.Scan(
+			&a.ID, &a.DebtID,
+			&a.PreviousUserID, &a.PreviousUsername,
+			&a.NewUserID, &a.NewUsername,
+			&a.ImportRecordID, &a.Reason, &a.AssignedAt,
+		); err != nil {
+			return nil, err
+		}
+		out = append(out, a)
+	}
+	return out, rows.Err()
+}
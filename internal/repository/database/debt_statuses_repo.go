@@ -3,25 +3,36 @@ package database
 import (
 	"context"
 	"debtster_import/internal/config/connections/postgres"
+	"debtster_import/internal/repository/cache"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
 )
 
 type DebtStatusesRepo struct {
 	pg    *postgres.Postgres
 	table string
-	cache map[string]*int64
+	// cache (shortname → id) и names (id → shortname) общие для всех DebtStatusesRepo.
+	cache *cache.LRU[string, int64]
+	names *cache.LRU[int64, string]
 }
 
 func NewDebtStatusesRepo(pg *postgres.Postgres) *DebtStatusesRepo {
 	return &DebtStatusesRepo{
 		pg:    pg,
 		table: "debt_statuses",
-		cache: make(map[string]*int64),
+		cache: statusIDCache,
+		names: statusNameCache,
 	}
 }
 
 func (r *DebtStatusesRepo) GetStatusBigint(ctx context.Context, shortname string) (*int64, error) {
-	if v, ok := r.cache[shortname]; ok {
-		return v, nil
+	if v, found, ok := r.cache.Get(shortname); ok {
+		if !found {
+			return nil, nil
+		}
+		return &v, nil
 	}
 
 	var id int64
@@ -31,10 +42,121 @@ func (r *DebtStatusesRepo) GetStatusBigint(ctx context.Context, shortname string
 		shortname,
 	).Scan(&id)
 	if err != nil {
-		r.cache[shortname] = nil
+		if errors.Is(err, pgx.ErrNoRows) {
+			r.cache.SetMissing(shortname)
+		}
 		return nil, err
 	}
 
-	r.cache[shortname] = &id
+	r.cache.Set(shortname, id)
+	r.names.Set(id, shortname)
 	return &id, nil
 }
+
+// GetShortname — shortname статуса по id.
+func (r *DebtStatusesRepo) GetShortname(ctx context.Context, id int64) (string, error) {
+	if v, found, ok := r.names.Get(id); ok && found {
+		return v, nil
+	}
+
+	var shortname string
+	err := r.pg.Pool.QueryRow(
+		ctx,
+		`SELECT shortname FROM `+r.table+` WHERE id = $1`,
+		id,
+	).Scan(&shortname)
+	if err != nil {
+		return "", err
+	}
+
+	r.names.Set(id, shortname)
+	return shortname, nil
+}
+
+// Upsert создаёт статус с shortname или обновляет его название.
+func (r *DebtStatusesRepo) Upsert(ctx context.Context, shortname, name string) (int64, bool, error) {
+	var id int64
+	var created bool
+	err := r.pg.Pool.QueryRow(ctx, `
+		WITH upd AS (
+		    UPDATE `+r.table+`
+		    SET name = COALESCE(NULLIF($2, ''), name), updated_at = NOW()
+		    WHERE shortname = $1
+		    RETURNING id
+		), ins AS (
+		    INSERT INTO `+r.table+` (shortname, name, created_at, updated_at)
+		    SELECT $1, COALESCE(NULLIF($2, ''), $1), NOW(), NOW()
+		    WHERE NOT EXISTS (SELECT 1 FROM upd)
+		    RETURNING id
+		)
+		SELECT id, false FROM upd
+		UNION ALL
+		SELECT id, true FROM ins
+		LIMIT 1`,
+		shortname, name,
+	).Scan(&id, &created)
+	if err != nil {
+		return 0, false, err
+	}
+
+	r.cache.Set(shortname, id)
+	r.names.Set(id, shortname)
+	return id, created, nil
+}
+
+// ResolveStatusIDs — id статусов по shortname одним запросом (ненайденных
+// в результате нет). Результат, включая промахи, кладётся в кэш GetStatusBigint.
+func (r *DebtStatusesRepo) ResolveStatusIDs(ctx context.Context, shortnames []string) (map[string]int64, error) {
+	out := make(map[string]int64, len(shortnames))
+	missing := make([]string, 0, len(shortnames))
+	seen := make(map[string]bool, len(shortnames))
+
+	for _, sn := range shortnames {
+		sn = strings.TrimSpace(sn)
+		if sn == "" || seen[sn] {
+			continue
+		}
+		seen[sn] = true
+		if v, found, ok := r.cache.Get(sn); ok {
+			if found {
+				out[sn] = v
+			}
+			continue
+		}
+		missing = append(missing, sn)
+	}
+	if len(missing) == 0 {
+		return out, nil
+	}
+
+	rows, err := r.pg.Pool.Query(ctx,
+		`SELECT DISTINCT ON (shortname) shortname, id FROM `+r.table+` WHERE shortname = ANY($1) ORDER BY shortname, id`,
+		missing,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var shortname string
+		var id int64
+		if err := rows.Scan(&shortname, &id); err != nil {
+			return nil, err
+		}
+		out[shortname] = id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, sn := range missing {
+		if id, ok := out[sn]; ok {
+			r.cache.Set(sn, id)
+			r.names.Set(id, sn)
+		} else {
+			r.cache.SetMissing(sn)
+		}
+	}
+	return out, nil
+}
@@ -4,16 +4,24 @@ import (
 	"context"
 	"debtster_import/internal/config/connections/postgres"
 	"debtster_import/internal/models"
+	"debtster_import/internal/repository/cache"
+	"errors"
 	"strings"
+
+	"github.com/jackc/pgx/v5"
 )
 
 type DebtorRepo struct {
 	pg *postgres.Postgres
+
+	// cache — ИИН → id должника, общий для всех DebtorRepo.
+	cache *cache.LRU[string, string]
 }
 
 func NewDebtorRepo(pg *postgres.Postgres) *DebtorRepo {
 	return &DebtorRepo{
-		pg: pg,
+		pg:    pg,
+		cache: debtorIDCache,
 	}
 }
 
@@ -79,9 +87,88 @@ func (r *DebtorRepo) UpdateOrCreate(ctx context.Context, d models.Debtor) (*mode
 		return nil, err
 	}
 
+	r.cache.Set(debtor.IIN, debtor.ID)
 	return &debtor, nil
 }
 
+func (r *DebtorRepo) GetIDByIIN(ctx context.Context, iin string) (*string, error) {
+	if v, found, ok := r.cache.Get(iin); ok {
+		if !found {
+			return nil, pgx.ErrNoRows
+		}
+		return &v, nil
+	}
+
+	var id string
+	err := r.pg.Pool.QueryRow(ctx,
+		`SELECT id::text FROM debtors WHERE iin = $1 LIMIT 1`,
+		iin,
+	).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			r.cache.SetMissing(iin)
+		}
+		return nil, err
+	}
+
+	r.cache.Set(iin, id)
+	return &id, nil
+}
+
+// ResolveIDsByIIN — id должников по ИИН одним запросом (ненайденных в результате нет).
+// Результат, включая промахи, кладётся в кэш GetIDByIIN.
+func (r *DebtorRepo) ResolveIDsByIIN(ctx context.Context, iins []string) (map[string]string, error) {
+	out := make(map[string]string, len(iins))
+	missing := make([]string, 0, len(iins))
+	seen := make(map[string]bool, len(iins))
+
+	for _, iin := range iins {
+		if iin == "" || seen[iin] {
+			continue
+		}
+		seen[iin] = true
+		if v, found, ok := r.cache.Get(iin); ok {
+			if found {
+				out[iin] = v
+			}
+			continue
+		}
+		missing = append(missing, iin)
+	}
+	if len(missing) == 0 {
+		return out, nil
+	}
+
+	rows, err := r.pg.Pool.Query(ctx,
+		`SELECT DISTINCT ON (iin) iin, id::text FROM debtors WHERE iin = ANY($1) ORDER BY iin`,
+		missing,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var iin, id string
+		if err := rows.Scan(&iin, &id); err != nil {
+			return nil, err
+		}
+		out[iin] = id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, iin := range missing {
+		if id, ok := out[iin]; ok {
+			r.cache.Set(iin, id)
+		} else {
+			r.cache.SetMissing(iin)
+		}
+	}
+	return out, nil
+}
+
 func parseFullName(fullname string) (last, first, middle string) {
 	fullname = strings.TrimSpace(fullname)
 	fullname = strings.Join(strings.Fields(fullname), " ")
@@ -4,14 +4,21 @@ import (
 	"context"
 	"debtster_import/internal/config/connections/postgres"
 	"debtster_import/internal/models"
+	"debtster_import/internal/repository/cache"
+	"debtster_import/internal/validation"
+	"errors"
 	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
 type DebtsRepo struct {
 	pg    *postgres.Postgres
 	table string
 
-	cache map[string]*string
+	// cache — номер долга → id, общий для всех DebtsRepo.
+	cache *cache.LRU[string, string]
 }
 
 func NewDebtsRepo(pg *postgres.Postgres) *DebtsRepo {
@@ -19,7 +26,7 @@ func NewDebtsRepo(pg *postgres.Postgres) *DebtsRepo {
 		pg: pg,
 
 		table: "debts",
-		cache: make(map[string]*string),
+		cache: debtIDCache,
 	}
 }
 
@@ -117,13 +124,21 @@ func (r *DebtsRepo) UpdateOrCreate(ctx context.Context, row models.Debt) error {
 		row.AmountNotaryFees, row.AmountPostage, additional,
 		row.UserID, row.CounterpartyID, row.StatusID,
 	)
+	if err == nil {
+		// долг мог быть закэширован как ненайденный
+		r.cache.Delete(validation.NormalizeDebtNumber(row.Number))
+	}
 
 	return err
 }
 
 func (r *DebtsRepo) GetIDByNumber(ctx context.Context, number string) (*string, error) {
-	if v, ok := r.cache[number]; ok {
-		return v, nil
+	number = validation.NormalizeDebtNumber(number)
+	if v, found, ok := r.cache.Get(number); ok {
+		if !found {
+			return nil, nil
+		}
+		return &v, nil
 	}
 
 	var id string
@@ -132,10 +147,249 @@ func (r *DebtsRepo) GetIDByNumber(ctx context.Context, number string) (*string,
 		number,
 	).Scan(&id)
 	if err != nil {
-		r.cache[number] = nil
+		if errors.Is(err, pgx.ErrNoRows) {
+			r.cache.SetMissing(number)
+		}
 		return nil, err
 	}
 
-	r.cache[number] = &id
+	r.cache.Set(number, id)
 	return &id, nil
 }
+
+// ResolveDebtIDs — id долгов по номерам одним запросом (номера нормализуются,
+// ключи результата — нормализованные номера; ненайденных в результате нет).
+// Результат, включая промахи, кладётся в кэш GetIDByNumber.
+func (r *DebtsRepo) ResolveDebtIDs(ctx context.Context, numbers []string) (map[string]string, error) {
+	out := make(map[string]string, len(numbers))
+	missing := make([]string, 0, len(numbers))
+	seen := make(map[string]bool, len(numbers))
+
+	for _, n := range numbers {
+		n = validation.NormalizeDebtNumber(n)
+		if n == "" || seen[n] {
+			continue
+		}
+		seen[n] = true
+		if v, found, ok := r.cache.Get(n); ok {
+			if found {
+				out[n] = v
+			}
+			continue
+		}
+		missing = append(missing, n)
+	}
+	if len(missing) == 0 {
+		return out, nil
+	}
+
+	rows, err := r.pg.Pool.Query(ctx,
+		`SELECT number, id::text FROM `+r.table+` WHERE number = ANY($1)`,
+		missing,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var number, id string
+		if err := rows.Scan(&number, &id); err != nil {
+			return nil, err
+		}
+		if _, ok := out[number]; !ok {
+			out[number] = id
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, n := range missing {
+		if id, ok := out[n]; ok {
+			r.cache.Set(n, id)
+		} else {
+			r.cache.SetMissing(n)
+		}
+	}
+	return out, nil
+}
+
+func (r *DebtsRepo) GetDebtorIDByNumber(ctx context.Context, number string) (*string, error) {
+	var id *string
+	err := r.pg.Pool.QueryRow(ctx,
+		`SELECT debtor_id::text FROM `+r.table+` WHERE number = $1 LIMIT 1`,
+		validation.NormalizeDebtNumber(number),
+	).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+// ResolveDebtorIDs — id должников по номерам долгов одним запросом
+// (ключи — нормализованные номера; долги без должника и ненайденные пропускаются).
+func (r *DebtsRepo) ResolveDebtorIDs(ctx context.Context, numbers []string) (map[string]string, error) {
+	keys := normalizeDebtNumbers(numbers)
+	out := make(map[string]string, len(keys))
+	if len(keys) == 0 {
+		return out, nil
+	}
+
+	rows, err := r.pg.Pool.Query(ctx,
+		`SELECT number, debtor_id::text FROM `+r.table+` WHERE number = ANY($1) AND debtor_id IS NOT NULL`,
+		keys,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var number, id string
+		if err := rows.Scan(&number, &id); err != nil {
+			return nil, err
+		}
+		if _, ok := out[number]; !ok {
+			out[number] = id
+		}
+	}
+	return out, rows.Err()
+}
+
+// normalizeDebtNumbers — нормализованные непустые номера без повторов.
+func normalizeDebtNumbers(numbers []string) []string {
+	out := make([]string, 0, len(numbers))
+	seen := make(map[string]bool, len(numbers))
+	for _, n := range numbers {
+		n = validation.NormalizeDebtNumber(n)
+		if n != "" && !seen[n] {
+			seen[n] = true
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// GetStatusIDs — текущий status_id долгов по id (nil — статус не задан).
+func (r *DebtsRepo) GetStatusIDs(ctx context.Context, ids []string) (map[string]*int64, error) {
+	out := make(map[string]*int64, len(ids))
+	if len(ids) == 0 {
+		return out, nil
+	}
+
+	rows, err := r.pg.Pool.Query(ctx,
+		`SELECT id::text, status_id FROM `+r.table+` WHERE id = ANY($1::text[]::uuid[])`,
+		ids,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var status *int64
+		if err := rows.Scan(&id, &status); err != nil {
+			return nil, err
+		}
+		out[id] = status
+	}
+	return out, rows.Err()
+}
+
+// DebtClosureState — текущие статус и закрытие долга.
+type DebtClosureState struct {
+	StatusID    *int64
+	CloseReason *string
+	ClosedAt    *time.Time
+}
+
+// Same — совпадает ли закрытие долга с statusID, reason и closedAt (по дате).
+func (s DebtClosureState) Same(statusID int64, reason string, closedAt time.Time) bool {
+	return s.StatusID != nil && *s.StatusID == statusID &&
+		s.CloseReason != nil && *s.CloseReason == reason &&
+		s.ClosedAt != nil && s.ClosedAt.Format("2006-01-02") == closedAt.Format("2006-01-02")
+}
+
+// GetClosureStates — status_id, close_reason и closed_at долгов по id.
+func (r *DebtsRepo) GetClosureStates(ctx context.Context, ids []string) (map[string]DebtClosureState, error) {
+	out := make(map[string]DebtClosureState, len(ids))
+	if len(ids) == 0 {
+		return out, nil
+	}
+
+	rows, err := r.pg.Pool.Query(ctx,
+		`SELECT id::text, status_id, close_reason, closed_at FROM `+r.table+` WHERE id = ANY($1::text[]::uuid[])`,
+		ids,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var st DebtClosureState
+		if err := rows.Scan(&id, &st.StatusID, &st.CloseReason, &st.ClosedAt); err != nil {
+			return nil, err
+		}
+		out[id] = st
+	}
+	return out, rows.Err()
+}
+
+// LockStatusIDsTx — как GetStatusIDs, но в транзакции tx с блокировкой строк
+// долгов (FOR UPDATE, по порядку id): параллельные импорты меняют статус
+// одного долга по очереди и видят результат друг друга.
+func (r *DebtsRepo) LockStatusIDsTx(ctx context.Context, tx pgx.Tx, ids []string) (map[string]*int64, error) {
+	out := make(map[string]*int64, len(ids))
+	if len(ids) == 0 {
+		return out, nil
+	}
+
+	rows, err := tx.Query(ctx,
+		`SELECT id::text, status_id FROM `+r.table+`
+		 WHERE id = ANY($1::text[]::uuid[])
+		 ORDER BY id
+		 FOR UPDATE`,
+		ids,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var status *int64
+		if err := rows.Scan(&id, &status); err != nil {
+			return nil, err
+		}
+		out[id] = status
+	}
+	return out, rows.Err()
+}
+
+// SetStatusesTx проставляет долгам новые status_id (debt id -> status id).
+func (r *DebtsRepo) SetStatusesTx(ctx context.Context, tx pgx.Tx, statuses map[string]int64) error {
+	if len(statuses) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(statuses))
+	values := make([]int64, 0, len(statuses))
+	for id, st := range statuses {
+		ids = append(ids, id)
+		values = append(values, st)
+	}
+
+	_, err := tx.Exec(ctx, `
+		UPDATE `+r.table+` d
+		SET status_id = v.status_id, updated_at = NOW()
+		FROM unnest($1::text[]::uuid[], $2::bigint[]) AS v(id, status_id)
+		WHERE d.id = v.id`,
+		ids, values,
+	)
+	return err
+}
@@ -4,60 +4,108 @@ import (
 	"context"
 	"debtster_import/internal/config/connections/postgres"
 	"debtster_import/internal/models"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
 )
 
 type EnforcementProceedingsRepo struct {
-	pg    *postgres.Postgres
-	table string
+	pg           *postgres.Postgres
+	table        string
+	historyTable string
 }
 
 func NewEnforcementProceedingsRepo(pg *postgres.Postgres) *EnforcementProceedingsRepo {
 	return &EnforcementProceedingsRepo{
-		pg:    pg,
-		table: "enforcement_proceedings",
+		pg:           pg,
+		table:        "enforcement_proceedings",
+		historyTable: "enforcement_proceeding_status_history",
 	}
 }
 
-func (r *EnforcementProceedingsRepo) Upsert(ctx context.Context, e models.EnforcementProceeding) (*models.EnforcementProceeding, error) {
+// Upsert создаёт/обновляет производство по (debt_id, serial_number). Если статус
+// АИС ОИП изменился (или производство новое), в историю статусов дописывается
+// строка перехода. statusChanged=true в этом случае.
+func (r *EnforcementProceedingsRepo) Upsert(ctx context.Context, e models.EnforcementProceeding, importRecordID string) (out *models.EnforcementProceeding, statusChanged bool, err error) {
+	tx, err := r.pg.Pool.Begin(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// ---------- 1) Текущий статус (блокируем строку до конца транзакции) ----------
+	var prevStatus *string
+	exists := true
+	err = tx.QueryRow(ctx, `
+		SELECT status_ais_oip FROM `+r.table+`
+		WHERE debt_id = $1::uuid AND serial_number = $2
+		FOR UPDATE
+	`, e.DebtID, e.SerialNumber).Scan(&prevStatus)
+	if errors.Is(err, pgx.ErrNoRows) {
+		exists = false
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	// ---------- 2) Upsert ----------
 	q := `
 		INSERT INTO ` + r.table + ` (
-			serial_number, debt_id, amount, private_bailiff_name,
+			serial_number, debt_id, executive_document_id, amount, private_bailiff_name,
 			private_bailiff_region, start_date, status_ais_oip,
 			created_at, updated_at
 		) VALUES (
-			$1, $2::uuid, $3::numeric, $4, $5, $6::date, $7,
-			COALESCE($8, NOW()), NOW()
+			$1, $2::uuid, $3::uuid, $4::numeric, $5, $6, $7::date, $8,
+			COALESCE($9, NOW()), NOW()
 		)
 		ON CONFLICT (debt_id, serial_number) DO UPDATE SET
+			executive_document_id = COALESCE(EXCLUDED.executive_document_id, ` + r.table + `.executive_document_id),
 			amount = EXCLUDED.amount,
 			private_bailiff_name = EXCLUDED.private_bailiff_name,
 			private_bailiff_region = EXCLUDED.private_bailiff_region,
 			start_date = EXCLUDED.start_date,
-			status_ais_oip = EXCLUDED.status_ais_oip,
+			status_ais_oip = COALESCE(EXCLUDED.status_ais_oip, ` + r.table + `.status_ais_oip),
 			updated_at = NOW()
 		RETURNING
-			serial_number, debt_id, amount,
+			id::text, serial_number, debt_id, executive_document_id::text, amount,
 			private_bailiff_name, private_bailiff_region,
 			start_date, status_ais_oip,
 			created_at
 	`
 
-	var out models.EnforcementProceeding
-	err := r.pg.Pool.QueryRow(ctx, q,
-		e.SerialNumber, e.DebtID, e.Amount, e.PrivateBailiffName,
+	var res models.EnforcementProceeding
+	err = tx.QueryRow(ctx, q,
+		e.SerialNumber, e.DebtID, e.ExecutiveDocumentID, e.Amount, e.PrivateBailiffName,
 		e.PrivateBailiffRegion, e.StartDate, e.StatusAISOIP,
 		e.CreatedAt,
 	).Scan(
-		&out.SerialNumber, &out.DebtID, &out.Amount,
-		&out.PrivateBailiffName, &out.PrivateBailiffRegion,
-		&out.StartDate, &out.StatusAISOIP,
-		&out.CreatedAt,
+		&res.ID, &res.SerialNumber, &res.DebtID, &res.ExecutiveDocumentID, &res.Amount,
+		&res.PrivateBailiffName, &res.PrivateBailiffRegion,
+		&res.StartDate, &res.StatusAISOIP,
+		&res.CreatedAt,
 	)
-
 	if err != nil {
-		return nil, err
+		return nil, false, err
+	}
+
+	// ---------- 3) История статусов ----------
+	if e.StatusAISOIP != nil && (!exists || prevStatus == nil || *prevStatus != *e.StatusAISOIP) {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO `+r.historyTable+` (
+				enforcement_proceeding_id, status_from, status_to, changed_at, import_record_id, created_at
+			) VALUES (
+				$1::uuid, $2, $3, COALESCE($4::timestamp, NOW()), NULLIF($5, ''), NOW()
+			)
+		`, res.ID, prevStatus, e.StatusAISOIP, e.StatusChangedAt, importRecordID)
+		if err != nil {
+			return nil, false, err
+		}
+		statusChanged = true
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, false, err
 	}
-	return &out, nil
+	return &res, statusChanged, nil
 }
 
 func (r *EnforcementProceedingsRepo) GetTableName() string {
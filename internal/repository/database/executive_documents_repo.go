@@ -2,9 +2,12 @@ package database
 
 import (
 	"context"
+	"errors"
 
 	"debtster_import/internal/config/connections/postgres"
 	"debtster_import/internal/models"
+
+	"github.com/jackc/pgx/v5"
 )
 
 type ExecutiveDocumentsRepo struct {
@@ -15,6 +18,10 @@ func NewExecutiveDocumentsRepo(pg *postgres.Postgres) *ExecutiveDocumentsRepo {
 	return &ExecutiveDocumentsRepo{PG: pg}
 }
 
+func (r *ExecutiveDocumentsRepo) GetTableName() string {
+	return "executive_documents"
+}
+
 func (r *ExecutiveDocumentsRepo) Create(ctx context.Context, row models.ExecutiveDocument) error {
 	const q = `
 		INSERT INTO executive_documents (
@@ -24,17 +31,86 @@ func (r *ExecutiveDocumentsRepo) Create(ctx context.Context, row models.Executiv
 		  lawyer_received_at, private_bailiff_received_at, dvp_transferred_at,
 		  created_at
 		) VALUES (
-		  $1::uuid, $2, $3, $4::uuid, $5::numeric,
+		  $1::uuid, $2, $3, $4::uuid, COALESCE(NULLIF($5, '')::numeric, 0),
 		  $6::date, $7, $8, $9, $10::date,
-		  $11, $12::bool, $13, $14,
+		  $11, COALESCE($12::bool, false), $13, $14::date,
 		  $15::date, $16::date, $17::date,
 		  NOW()
 		)`
 	_, err := r.PG.Pool.Exec(ctx, q,
 		row.ID, row.DocType, row.SerialNumber, row.DebtID, row.Amount,
 		row.StartDate, row.StatusCourt, row.IssuingAuthority, row.IssuePlace, row.IssueDate,
-		row.CreditorReplacement, row.IsCanceled, row.CancellationNumber, row.CancellationDateVarchar,
+		row.CreditorReplacement, row.IsCanceled, row.CancellationNumber, row.CancellationDate,
 		row.LawyerReceivedAt, row.PrivateBailiffRecvAt, row.DVPTransferredAt,
 	)
 	return err
 }
+
+// FindIDBySerial ищет документ долга по серийному номеру (любого типа).
+// Возвращает nil, nil если нет.
+func (r *ExecutiveDocumentsRepo) FindIDBySerial(ctx context.Context, debtID, serial string) (*string, error) {
+	var id string
+	err := r.PG.Pool.QueryRow(ctx, `
+		SELECT id::text FROM executive_documents
+		WHERE debt_id = $1::uuid
+		  AND REPLACE(serial_number, ' ', '') = REPLACE($2, ' ', '')
+		ORDER BY is_canceled, created_at DESC
+		LIMIT 1
+	`, debtID, serial).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// UpdateOrCreate обновляет документ с тем же (debt_id, type, serial_number), иначе создаёт.
+// Ключ совпадает и при пустых debt_id или serial_number (индекс
+// executive_documents_natural_key_uniq, миграция 012), поэтому повторная
+// загрузка строки без найденного долга или без серии не создаёт копию.
+// При обновлении пустые поля не затирают сохранённые, так что строка только с
+// отменой (is_canceled, cancellation_number, cancellation_date) трогает только их.
+func (r *ExecutiveDocumentsRepo) UpdateOrCreate(ctx context.Context, row models.ExecutiveDocument) (id string, created bool, err error) {
+	const q = `
+		INSERT INTO executive_documents AS e (
+		  id, type, serial_number, debt_id, amount,
+		  start_date, status_court, issuing_authority, issue_place, issue_date,
+		  creditor_replacement, is_canceled, cancellation_number, cancellation_date,
+		  lawyer_received_at, private_bailiff_received_at, dvp_transferred_at,
+		  created_at
+		) VALUES (
+		  $1::uuid, $2, $3, $4::uuid, COALESCE(NULLIF($5, '')::numeric, 0),
+		  $6::date, $7, $8, $9, $10::date,
+		  $11, COALESCE($12::bool, false), $13, $14::date,
+		  $15::date, $16::date, $17::date,
+		  NOW()
+		)
+		ON CONFLICT ((COALESCE(debt_id::text, '')), type, (COALESCE(serial_number, ''))) DO UPDATE SET
+		  amount                      = COALESCE(NULLIF($5, '')::numeric, e.amount),
+		  start_date                  = COALESCE($6::date, e.start_date),
+		  status_court                = COALESCE($7, e.status_court),
+		  issuing_authority           = COALESCE($8, e.issuing_authority),
+		  issue_place                 = COALESCE($9, e.issue_place),
+		  issue_date                  = COALESCE($10::date, e.issue_date),
+		  creditor_replacement        = COALESCE($11, e.creditor_replacement),
+		  is_canceled                 = COALESCE($12::bool, e.is_canceled),
+		  cancellation_number         = COALESCE($13, e.cancellation_number),
+		  cancellation_date           = COALESCE($14::date, e.cancellation_date),
+		  lawyer_received_at          = COALESCE($15::date, e.lawyer_received_at),
+		  private_bailiff_received_at = COALESCE($16::date, e.private_bailiff_received_at),
+		  dvp_transferred_at          = COALESCE($17::date, e.dvp_transferred_at),
+		  updated_at                  = NOW()
+		RETURNING id::text, (xmax = 0)`
+	err = r.PG.Pool.QueryRow(ctx, q,
+		row.ID, row.DocType, row.SerialNumber, row.DebtID, row.Amount,
+		row.StartDate, row.StatusCourt, row.IssuingAuthority, row.IssuePlace, row.IssueDate,
+		row.CreditorReplacement, row.IsCanceled, row.CancellationNumber, row.CancellationDate,
+		row.LawyerReceivedAt, row.PrivateBailiffRecvAt, row.DVPTransferredAt,
+	).Scan(&id, &created)
+	if err != nil {
+		return "", false, err
+	}
+	return id, created, nil
+}
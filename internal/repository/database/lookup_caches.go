@@ -0,0 +1,23 @@
+package database
+
+import "debtster_import/internal/repository/cache"
+
+// Кэши справочных поисков общие для всех экземпляров репозиториев: репозитории
+// создаются и в initProcessors, и в обработчиках запросов, а импорты идут
+// параллельно. Размер и сроки жизни задаются cache.Configure при старте.
+var (
+	debtIDCache            = cache.New[string, string]("debt_ids")
+	debtorIDCache          = cache.New[string, string]("debtor_ids")
+	userIDCache            = cache.New[string, int64]("user_ids")
+	statusIDCache          = cache.New[string, int64]("debt_status_ids")
+	statusNameCache        = cache.New[int64, string]("debt_status_names")
+	counterpartyCache      = cache.New[string, int64]("counterparty_ids")
+	referenceCache         = cache.New[referenceKey, int64]("reference_ids")
+	contactPersonTypeCache = cache.New[string, int64]("contact_person_type_ids")
+)
+
+// referenceKey — запись справочника ReferenceRepo: таблица и нормализованное название.
+type referenceKey struct {
+	table string
+	name  string
+}
@@ -2,10 +2,19 @@ package database
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
 
 	"debtster_import/internal/config/connections/postgres"
 	"debtster_import/internal/models"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 )
 
@@ -17,30 +26,32 @@ func NewPaymentRepo(pg *postgres.Postgres) *PaymentRepo {
 	return &PaymentRepo{pg: pg}
 }
 
+// insertPaymentQuery — без цели ON CONFLICT: дубль определяется либо по
+// external_id, либо (для платежей без него) по естественному ключу
+// (debt_id, user_id, amount, amount_after_subtraction, payment_date).
 const insertPaymentQuery = `
 	INSERT INTO payments (
 		id, debt_id, user_id,
 		amount, amount_after_subtraction, amount_government_duty,
 		amount_representation_expenses, amount_notary_fees, amount_postage,
 		confirmed, payment_date, created_at,
-		amount_accounts_receivable, amount_main_debt, amount_accrual, amount_fine
+		amount_accounts_receivable, amount_main_debt, amount_accrual, amount_fine,
+		external_id
 	)
 	VALUES (
 		$1::uuid,  $2::uuid,  $3::bigint,
 		$4::numeric,  $5::numeric,  $6::numeric,
 		$7::numeric,  $8::numeric,  $9::numeric,
 		$10::bool,  $11::date,  NOW(),
-		$12::numeric,  $13::numeric,  $14::numeric,  $15::numeric
+		$12::numeric,  $13::numeric,  $14::numeric,  $15::numeric,
+		NULLIF($16, '')
 	)
-	ON CONFLICT (
-		debt_id,
-		user_id,
-		amount,
-		amount_after_subtraction,
-		payment_date
-	) DO NOTHING;
+	ON CONFLICT DO NOTHING;
 `
 
+// ErrDuplicatePayment — платёж с тем же external_id или естественным ключом уже есть.
+var ErrDuplicatePayment = errors.New("duplicate payment")
+
 func (r *PaymentRepo) CreateBatch(ctx context.Context, rows []models.Payment) []error {
 	errs := make([]error, len(rows))
 	if len(rows) == 0 {
@@ -58,6 +69,7 @@ func (r *PaymentRepo) CreateBatch(ctx context.Context, rows []models.Payment) []
 			row.Confirmed, row.PaymentDate,
 			row.AmountAccountsReceivable, row.AmountMainDebt,
 			row.AmountAccrual, row.AmountFine,
+			row.ExternalID,
 		)
 	}
 
@@ -65,11 +77,539 @@ func (r *PaymentRepo) CreateBatch(ctx context.Context, rows []models.Payment) []
 	defer br.Close()
 
 	for i := range rows {
-		_, err := br.Exec()
+		ct, err := br.Exec()
 		if err != nil {
 			errs[i] = err
+			continue
+		}
+		if ct.RowsAffected() == 0 {
+			errs[i] = ErrDuplicatePayment
+		}
+	}
+
+	return errs
+}
+
+// paymentsStage — временная таблица загрузки платежей (CopyBatch).
+var paymentsStage = Stage{
+	Table: "tmp_payments",
+	Columns: []StageColumn{
+		{"id", "text"}, {"debt_id", "text"}, {"user_id", "text"},
+		{"amount", "text"}, {"amount_after_subtraction", "text"}, {"amount_government_duty", "text"},
+		{"amount_representation_expenses", "text"}, {"amount_notary_fees", "text"}, {"amount_postage", "text"},
+		{"confirmed", "boolean"}, {"payment_date", "date"},
+		{"amount_accounts_receivable", "text"}, {"amount_main_debt", "text"},
+		{"amount_accrual", "text"}, {"amount_fine", "text"},
+		{"external_id", "text"},
+	},
+}
+
+// CopyBatch — CreateBatch через COPY во временную таблицу и один
+// INSERT … SELECT … ON CONFLICT DO NOTHING. Невставленные строки —
+// ErrDuplicatePayment. Если слияние падает целиком (например, неверное
+// значение в одной строке), батч повторяется через CreateBatch, чтобы
+// получить ошибку по каждой строке.
+func (r *PaymentRepo) CopyBatch(ctx context.Context, rows []models.Payment) []error {
+	errs := make([]error, len(rows))
+	if len(rows) == 0 {
+		return errs
+	}
+
+	src := make([][]any, len(rows))
+	for i, row := range rows {
+		src[i] = []any{
+			row.ID, row.DebtID, row.UserID,
+			row.Amount, row.AmountAfterSubtraction, row.AmountGovernmentDuty,
+			row.AmountRepresentationExpenses, row.AmountNotaryFees, row.AmountPostage,
+			row.Confirmed, row.PaymentDate,
+			row.AmountAccountsReceivable, row.AmountMainDebt,
+			row.AmountAccrual, row.AmountFine,
+			row.ExternalID,
 		}
 	}
 
+	applied, err := CopyMerge(ctx, r.pg, paymentsStage, src, `
+		WITH ins AS (
+		    INSERT INTO payments (
+		        id, debt_id, user_id,
+		        amount, amount_after_subtraction, amount_government_duty,
+		        amount_representation_expenses, amount_notary_fees, amount_postage,
+		        confirmed, payment_date, created_at,
+		        amount_accounts_receivable, amount_main_debt, amount_accrual, amount_fine,
+		        external_id
+		    )
+		    SELECT
+		        s.id::uuid, s.debt_id::uuid, s.user_id::bigint,
+		        NULLIF(s.amount, '')::numeric, NULLIF(s.amount_after_subtraction, '')::numeric, NULLIF(s.amount_government_duty, '')::numeric,
+		        NULLIF(s.amount_representation_expenses, '')::numeric, NULLIF(s.amount_notary_fees, '')::numeric, NULLIF(s.amount_postage, '')::numeric,
+		        s.confirmed, s.payment_date, NOW(),
+		        NULLIF(s.amount_accounts_receivable, '')::numeric, NULLIF(s.amount_main_debt, '')::numeric,
+		        NULLIF(s.amount_accrual, '')::numeric, NULLIF(s.amount_fine, '')::numeric,
+		        NULLIF(s.external_id, '')
+		    FROM `+paymentsStage.Table+` s
+		    ORDER BY s.row_no
+		    ON CONFLICT DO NOTHING
+		    RETURNING id
+		)
+		SELECT s.row_no FROM `+paymentsStage.Table+` s JOIN ins ON ins.id = s.id::uuid`,
+	)
+	if err != nil {
+		log.Printf("[PAYMENTS][COPY][WARN] rows=%d bulk merge failed, retry per row: %v", len(rows), err)
+		return r.CreateBatch(ctx, rows)
+	}
+
+	for i, ok := range applied {
+		if !ok {
+			errs[i] = ErrDuplicatePayment
+		}
+	}
 	return errs
 }
+
+// DebtBalance — остатки долга по составляющим (ключи models.PaymentComponents)
+// и общий фактический долг под ключом "actual_debt".
+type DebtBalance map[string]float64
+
+// ApplyPayment вставляет платёж и уменьшает остатки долга в одной транзакции.
+// allocate получает текущие остатки (строка долга заблокирована) и может
+// заполнить разбивку платежа. Если платёж уже существует (ON CONFLICT),
+// остатки не меняются и inserted=false.
+func (r *PaymentRepo) ApplyPayment(
+	ctx context.Context,
+	pay *models.Payment,
+	allocate func(balance DebtBalance) error,
+) (before, after DebtBalance, inserted bool, err error) {
+	tx, err := r.pg.Pool.Begin(ctx)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	before, err = lockDebtBalance(ctx, tx, pay.DebtID)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	if allocate != nil {
+		if err := allocate(before); err != nil {
+			return before, nil, false, err
+		}
+	}
+
+	ct, err := tx.Exec(ctx, insertPaymentQuery,
+		pay.ID, pay.DebtID, pay.UserID,
+		pay.Amount, pay.AmountAfterSubtraction, pay.AmountGovernmentDuty,
+		pay.AmountRepresentationExpenses, pay.AmountNotaryFees, pay.AmountPostage,
+		pay.Confirmed, pay.PaymentDate,
+		pay.AmountAccountsReceivable, pay.AmountMainDebt,
+		pay.AmountAccrual, pay.AmountFine,
+		pay.ExternalID,
+	)
+	if err != nil {
+		return before, nil, false, err
+	}
+	if ct.RowsAffected() == 0 {
+		return before, before, false, tx.Commit(ctx)
+	}
+
+	paid := make(map[string]float64, len(models.PaymentComponents))
+	for _, c := range models.PaymentComponents {
+		paid[c], _ = strconv.ParseFloat(*pay.Component(c), 64)
+	}
+
+	after, err = writeDebtBalance(ctx, tx, pay.DebtID, before, paid, -1)
+	if err != nil {
+		return before, nil, false, err
+	}
+
+	if err := markBalanceApplied(ctx, tx, pay.ID, before, after); err != nil {
+		return before, nil, false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return before, nil, false, err
+	}
+	return before, after, true, nil
+}
+
+// PaymentKey — способ найти существующий платёж: по внешнему идентификатору
+// банка или по естественному ключу из ON CONFLICT insertPaymentQuery.
+type PaymentKey struct {
+	ExternalID             string
+	DebtID                 string
+	UserID                 string
+	Amount                 string
+	AmountAfterSubtraction string // пустая строка, "0" и NULL в базе равны
+	PaymentDate            *time.Time
+}
+
+// FindID ищет платёж по ключу. Сторнирующие записи не учитываются.
+// Возвращает nil, nil если платёж не найден.
+func (r *PaymentRepo) FindID(ctx context.Context, k PaymentKey) (*string, error) {
+	var (
+		id  string
+		err error
+	)
+	if k.ExternalID != "" {
+		err = r.pg.Pool.QueryRow(ctx, `
+			SELECT id::text FROM payments
+			WHERE external_id = $1 AND reversal_of_id IS NULL
+			LIMIT 1`,
+			k.ExternalID,
+		).Scan(&id)
+	} else {
+		err = r.pg.Pool.QueryRow(ctx, `
+			SELECT id::text FROM payments
+			WHERE debt_id = $1::uuid
+			  AND user_id = $2::bigint
+			  AND amount = $3::numeric
+			  AND COALESCE(amount_after_subtraction, 0) = COALESCE(NULLIF($4, '')::numeric, 0)
+			  AND payment_date = $5::date
+			  AND reversal_of_id IS NULL
+			LIMIT 1`,
+			k.DebtID, k.UserID, k.Amount, k.AmountAfterSubtraction, k.PaymentDate,
+		).Scan(&id)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// PaymentChange — результат подтверждения или сторно платежа.
+type PaymentChange struct {
+	DebtID    string
+	Unchanged bool // платёж уже был подтверждён / сторнирован
+	Before    DebtBalance
+	After     DebtBalance
+	// ReversalID — id сторнирующей записи (только для Reverse).
+	ReversalID string
+}
+
+// Confirm выставляет confirmed=true. При applyBalance платёж, ещё не
+// уменьшавший остатки долга, применяется к debts.amount_* в той же транзакции.
+func (r *PaymentRepo) Confirm(ctx context.Context, id string, applyBalance bool) (PaymentChange, error) {
+	var res PaymentChange
+
+	tx, err := r.pg.Pool.Begin(ctx)
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		confirmed bool
+		applied   bool
+		reversed  bool
+	)
+	paid, _, err := lockPayment(ctx, tx, id, &res.DebtID, &confirmed, &applied, &reversed)
+	if err != nil {
+		return res, err
+	}
+	if reversed {
+		return res, fmt.Errorf("payment %s is reversed", id)
+	}
+
+	if confirmed && (applied || !applyBalance) {
+		res.Unchanged = true
+		return res, tx.Commit(ctx)
+	}
+
+	if _, err := tx.Exec(ctx,
+		`UPDATE payments SET confirmed = true WHERE id = $1::uuid`, id,
+	); err != nil {
+		return res, err
+	}
+
+	if applyBalance && !applied {
+		res.Before, err = lockDebtBalance(ctx, tx, res.DebtID)
+		if err != nil {
+			return res, err
+		}
+		res.After, err = writeDebtBalance(ctx, tx, res.DebtID, res.Before, paid, -1)
+		if err != nil {
+			return res, err
+		}
+		if err := markBalanceApplied(ctx, tx, id, res.Before, res.After); err != nil {
+			return res, err
+		}
+	}
+
+	return res, tx.Commit(ctx)
+}
+
+// Reverse сторнирует платёж: вставляет компенсирующую запись с отрицательными
+// суммами, помечает исходный платёж reversed_at и, если платёж уменьшал
+// остатки долга, возвращает ровно то, на что они были уменьшены
+// (balance_applied), а не разбивку платежа.
+func (r *PaymentRepo) Reverse(ctx context.Context, id string, date *time.Time) (PaymentChange, error) {
+	var res PaymentChange
+
+	tx, err := r.pg.Pool.Begin(ctx)
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		confirmed bool
+		applied   bool
+		reversed  bool
+	)
+	paid, appliedSplit, err := lockPayment(ctx, tx, id, &res.DebtID, &confirmed, &applied, &reversed)
+	if err != nil {
+		return res, err
+	}
+	if reversed {
+		res.Unchanged = true
+		return res, tx.Commit(ctx)
+	}
+
+	res.ReversalID = uuid.NewString()
+	_, err = tx.Exec(ctx, `
+		INSERT INTO payments (
+			id, debt_id, user_id,
+			amount, amount_after_subtraction, amount_government_duty,
+			amount_representation_expenses, amount_notary_fees, amount_postage,
+			confirmed, payment_date, created_at,
+			amount_accounts_receivable, amount_main_debt, amount_accrual, amount_fine,
+			external_id, reversal_of_id, balance_applied_at
+		)
+		SELECT
+			$1::uuid, debt_id, user_id,
+			-amount, -amount_after_subtraction, -amount_government_duty,
+			-amount_representation_expenses, -amount_notary_fees, -amount_postage,
+			true, COALESCE($3::date, payment_date), NOW(),
+			-amount_accounts_receivable, -amount_main_debt, -amount_accrual, -amount_fine,
+			external_id, id, CASE WHEN balance_applied_at IS NULL THEN NULL ELSE NOW() END
+		FROM payments
+		WHERE id = $2::uuid`,
+		res.ReversalID, id, date,
+	)
+	if err != nil {
+		return res, fmt.Errorf("insert reversal: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx,
+		`UPDATE payments SET reversed_at = NOW() WHERE id = $1::uuid`, id,
+	); err != nil {
+		return res, err
+	}
+
+	if applied {
+		res.Before, err = lockDebtBalance(ctx, tx, res.DebtID)
+		if err != nil {
+			return res, err
+		}
+		if appliedSplit != nil {
+			res.After, err = restoreDebtBalance(ctx, tx, res.DebtID, res.Before, appliedSplit)
+		} else {
+			// платёж применён до появления balance_applied
+			res.After, err = writeDebtBalance(ctx, tx, res.DebtID, res.Before, paid, +1)
+		}
+		if err != nil {
+			return res, err
+		}
+	}
+
+	return res, tx.Commit(ctx)
+}
+
+// lockPayment блокирует платёж и возвращает его разбивку по составляющим и
+// фактически применённую к остаткам разбивку (nil, если она не записана).
+func lockPayment(
+	ctx context.Context,
+	tx pgx.Tx,
+	id string,
+	debtID *string,
+	confirmed, applied, reversed *bool,
+) (map[string]float64, DebtBalance, error) {
+	cols := []string{
+		"debt_id::text",
+		"COALESCE(confirmed, false)",
+		"balance_applied_at IS NOT NULL",
+		"reversed_at IS NOT NULL",
+		"balance_applied::text",
+	}
+	for _, c := range models.PaymentComponents {
+		cols = append(cols, "COALESCE(amount_"+c+", 0)::float8")
+	}
+
+	var appliedRaw *string
+	vals := make([]float64, len(models.PaymentComponents))
+	dest := []any{debtID, confirmed, applied, reversed, &appliedRaw}
+	for i := range vals {
+		dest = append(dest, &vals[i])
+	}
+
+	err := tx.QueryRow(ctx,
+		`SELECT `+strings.Join(cols, ", ")+` FROM payments WHERE id = $1::uuid FOR UPDATE`,
+		id,
+	).Scan(dest...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("lock payment: %w", err)
+	}
+
+	paid := make(map[string]float64, len(vals))
+	for i, c := range models.PaymentComponents {
+		paid[c] = vals[i]
+	}
+
+	var appliedSplit DebtBalance
+	if appliedRaw != nil {
+		if err := json.Unmarshal([]byte(*appliedRaw), &appliedSplit); err != nil {
+			return nil, nil, fmt.Errorf("decode balance_applied: %w", err)
+		}
+	}
+	return paid, appliedSplit, nil
+}
+
+// lockDebtBalance блокирует строку долга и читает текущие остатки.
+func lockDebtBalance(ctx context.Context, tx pgx.Tx, debtID string) (DebtBalance, error) {
+	cols := make([]string, 0, len(models.PaymentComponents)+1)
+	cols = append(cols, "COALESCE(amount_actual_debt, 0)::float8")
+	for _, c := range models.PaymentComponents {
+		cols = append(cols, "COALESCE(amount_"+c+", 0)::float8")
+	}
+
+	vals := make([]float64, len(cols))
+	dest := make([]any, len(cols))
+	for i := range vals {
+		dest[i] = &vals[i]
+	}
+	err := tx.QueryRow(ctx,
+		`SELECT `+strings.Join(cols, ", ")+` FROM debts WHERE id = $1::uuid FOR UPDATE`,
+		debtID,
+	).Scan(dest...)
+	if err != nil {
+		return nil, fmt.Errorf("lock debt: %w", err)
+	}
+
+	balance := DebtBalance{"actual_debt": vals[0]}
+	for i, c := range models.PaymentComponents {
+		balance[c] = vals[i+1]
+	}
+	return balance, nil
+}
+
+// writeDebtBalance сдвигает остатки долга на sign*paid по каждой составляющей
+// (sign=-1 — погашение, +1 — возврат при сторно) и пишет их в debts.
+// Остатки не уходят ниже нуля, поэтому фактический сдвиг может быть меньше paid.
+func writeDebtBalance(
+	ctx context.Context,
+	tx pgx.Tx,
+	debtID string,
+	before DebtBalance,
+	paid map[string]float64,
+	sign float64,
+) (DebtBalance, error) {
+	after := DebtBalance{}
+	total := 0.0
+	for _, c := range models.PaymentComponents {
+		total += paid[c]
+		after[c] = roundMoney(max(before[c]+sign*paid[c], 0))
+	}
+	after["actual_debt"] = roundMoney(max(before["actual_debt"]+sign*total, 0))
+	return after, saveDebtBalance(ctx, tx, debtID, after)
+}
+
+// restoreDebtBalance возвращает остаткам долга ровно applied — то, на что их
+// уменьшил платёж (см. markBalanceApplied).
+func restoreDebtBalance(
+	ctx context.Context,
+	tx pgx.Tx,
+	debtID string,
+	before DebtBalance,
+	applied DebtBalance,
+) (DebtBalance, error) {
+	after := DebtBalance{}
+	for _, c := range models.PaymentComponents {
+		after[c] = roundMoney(before[c] + applied[c])
+	}
+	after["actual_debt"] = roundMoney(before["actual_debt"] + applied["actual_debt"])
+	return after, saveDebtBalance(ctx, tx, debtID, after)
+}
+
+// saveDebtBalance пишет остатки в debts.amount_*.
+func saveDebtBalance(ctx context.Context, tx pgx.Tx, debtID string, balance DebtBalance) error {
+	setParts := make([]string, 0, len(models.PaymentComponents)+1)
+	args := make([]any, 0, len(models.PaymentComponents)+2)
+	for _, c := range models.PaymentComponents {
+		args = append(args, balance[c])
+		setParts = append(setParts, "amount_"+c+" = $"+strconv.Itoa(len(args)))
+	}
+	args = append(args, balance["actual_debt"])
+	setParts = append(setParts, "amount_actual_debt = $"+strconv.Itoa(len(args)))
+
+	args = append(args, debtID)
+	_, err := tx.Exec(ctx,
+		`UPDATE debts SET `+strings.Join(setParts, ", ")+`, updated_at = NOW() WHERE id = $`+strconv.Itoa(len(args))+`::uuid`,
+		args...,
+	)
+	if err != nil {
+		return fmt.Errorf("update debt balance: %w", err)
+	}
+	return nil
+}
+
+// markBalanceApplied отмечает, что платёж уменьшил остатки долга, и сохраняет
+// фактический сдвиг before-after по каждой составляющей — его вернёт Reverse.
+func markBalanceApplied(ctx context.Context, tx pgx.Tx, paymentID string, before, after DebtBalance) error {
+	applied := make(DebtBalance, len(after))
+	for k, v := range after {
+		applied[k] = roundMoney(before[k] - v)
+	}
+	raw, err := json.Marshal(applied)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx,
+		`UPDATE payments SET balance_applied_at = NOW(), balance_applied = $2::jsonb WHERE id = $1::uuid`,
+		paymentID, string(raw),
+	); err != nil {
+		return fmt.Errorf("mark balance applied: %w", err)
+	}
+	return nil
+}
+
+func roundMoney(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// PaymentFact — действующий (не сторнированный) платёж для сверки с графиком.
+type PaymentFact struct {
+	DebtID string
+	Date   time.Time
+	Amount float64
+}
+
+// ListForDebts возвращает действующие платежи по долгам в хронологическом порядке.
+func (r *PaymentRepo) ListForDebts(ctx context.Context, debtIDs []string) (map[string][]PaymentFact, error) {
+	rows, err := r.pg.Pool.Query(ctx, `
+		SELECT debt_id::text, payment_date, amount::float8
+		FROM payments
+		WHERE debt_id = ANY($1::text[]::uuid[])
+		  AND reversed_at IS NULL
+		  AND reversal_of_id IS NULL
+		  AND payment_date IS NOT NULL
+		ORDER BY debt_id, payment_date, created_at`,
+		debtIDs,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string][]PaymentFact, len(debtIDs))
+	for rows.Next() {
+		var f PaymentFact
+		if err := rows.Scan(&f.DebtID, &f.Date, &f.Amount); err != nil {
+			return nil, err
+		}
+		out[f.DebtID] = append(out[f.DebtID], f)
+	}
+	return out, rows.Err()
+}
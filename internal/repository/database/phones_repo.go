@@ -4,58 +4,164 @@ import (
 	"context"
 	"debtster_import/internal/config/connections/postgres"
 	"debtster_import/internal/models"
+	"debtster_import/internal/validation"
 	"regexp"
 	"strings"
 )
 
 type PhoneRepo struct {
-	pg *postgres.Postgres
+	pg    *postgres.Postgres
+	table string
 }
 
 func NewPhoneRepo(pg *postgres.Postgres) *PhoneRepo {
 	return &PhoneRepo{
-		pg: pg,
+		pg:    pg,
+		table: "phones",
 	}
 }
 
+// PhonesResult — итог операции над телефонами субъекта. Invalid — номера, не
+// прошедшие нормализацию (с причиной); их стоит отдать в предупреждения строки.
+type PhonesResult struct {
+	Added   int
+	Removed int
+	Invalid []string
+}
+
+func (r *PhoneRepo) GetTableName() string {
+	return r.table
+}
+
 func (r *PhoneRepo) SavePhones(ctx context.Context, row models.Phone) error {
-	row.PhonesRaw = strings.TrimSpace(row.PhonesRaw)
-	row.SubjectType = strings.TrimSpace(row.SubjectType)
+	_, err := r.AddPhones(ctx, row)
+	return err
+}
 
-	if row.PhonesRaw == "" || row.SubjectType == "" || row.SubjectID == "" {
-		return nil
+// AddPhones добавляет телефоны субъекту, пропуская номера, которые у него уже есть
+// (среди активных записей, в том числе сохранённые до нормализации в виде 8XXXXXXXXXX).
+// Повтор нормализованного номера при параллельной вставке отсекает уникальный
+// индекс phones_subject_phone_active_uniq (миграция 011).
+func (r *PhoneRepo) AddPhones(ctx context.Context, row models.Phone) (PhonesResult, error) {
+	row.SubjectType = strings.TrimSpace(row.SubjectType)
+	if row.SubjectType == "" || row.SubjectID == "" {
+		return PhonesResult{}, nil
 	}
 
-	splitter := regexp.MustCompile(`[\/|,]+`)
-	phones := splitter.Split(row.PhonesRaw, -1)
+	phones, invalid := splitPhones(row.PhonesRaw)
+	res := PhonesResult{Invalid: invalid}
 
-	for _, p := range phones {
-		phone := sanitizePhone(p)
-		if phone == "" {
-			continue
-		}
+	query := `
+		INSERT INTO ` + r.table + ` (
+			id, subject_type, subject_id, phone, type_id, created_at
+		)
+		SELECT gen_random_uuid(), $1, $2, $3, $4, NOW()
+		WHERE NOT EXISTS (
+			SELECT 1 FROM ` + r.table + `
+			WHERE subject_type = $1 AND subject_id = $2 AND phone = ANY($5) AND deleted_at IS NULL
+		)
+		ON CONFLICT (subject_type, subject_id, phone) WHERE deleted_at IS NULL DO NOTHING
+	`
 
-		table := "phones"
-		query := `
-			INSERT INTO ` + table + ` (
-				id, subject_type, subject_id, phone, type_id, created_at,
-			) VALUES (
-				gen_random_uuid(), $1, $2, $3, $4,  NOW(),
-			)
-		`
-
-		_, err := r.pg.Pool.Exec(ctx, query,
-			row.SubjectType, row.SubjectID, phone, row.TypeID,
+	for _, phone := range phones {
+		tag, err := r.pg.Pool.Exec(ctx, query,
+			row.SubjectType, row.SubjectID, phone.Digits, row.TypeID, phone.Variants(),
 		)
 		if err != nil {
-			return err
+			return res, err
 		}
+		res.Added += int(tag.RowsAffected())
+	}
+
+	return res, nil
+}
+
+// ReplaceType заменяет телефоны субъекта данного типа: активные номера этого типа,
+// которых нет в row.PhonesRaw, деактивируются, недостающие добавляются.
+func (r *PhoneRepo) ReplaceType(ctx context.Context, row models.Phone) (PhonesResult, error) {
+	if row.SubjectType == "" || row.SubjectID == "" || row.TypeID == nil {
+		return PhonesResult{}, nil
 	}
 
-	return nil
+	phones, invalid := splitPhones(row.PhonesRaw)
+	if len(invalid) > 0 && len(phones) == 0 {
+		// не затираем номера, если ни один новый не распознан
+		return PhonesResult{Invalid: invalid}, nil
+	}
+
+	tag, err := r.pg.Pool.Exec(ctx, `
+		UPDATE `+r.table+`
+		SET deleted_at = NOW(), updated_at = NOW()
+		WHERE subject_type = $1 AND subject_id = $2 AND type_id = $3
+		  AND deleted_at IS NULL
+		  AND NOT (phone = ANY($4))
+	`, row.SubjectType, row.SubjectID, *row.TypeID, phoneVariants(phones))
+	if err != nil {
+		return PhonesResult{Invalid: invalid}, err
+	}
+
+	res, err := r.AddPhones(ctx, row)
+	res.Removed = int(tag.RowsAffected())
+	return res, err
 }
 
-func sanitizePhone(input string) string {
-	onlyDigits := regexp.MustCompile(`\D+`)
-	return onlyDigits.ReplaceAllString(strings.TrimSpace(input), "")
+// Deactivate помечает перечисленные номера субъекта удалёнными (deleted_at).
+func (r *PhoneRepo) Deactivate(ctx context.Context, row models.Phone) (PhonesResult, error) {
+	phones, invalid := splitPhones(row.PhonesRaw)
+	res := PhonesResult{Invalid: invalid}
+	if row.SubjectType == "" || row.SubjectID == "" || len(phones) == 0 {
+		return res, nil
+	}
+
+	tag, err := r.pg.Pool.Exec(ctx, `
+		UPDATE `+r.table+`
+		SET deleted_at = NOW(), updated_at = NOW()
+		WHERE subject_type = $1 AND subject_id = $2
+		  AND deleted_at IS NULL
+		  AND phone = ANY($3)
+	`, row.SubjectType, row.SubjectID, phoneVariants(phones))
+	if err != nil {
+		return res, err
+	}
+
+	res.Removed = int(tag.RowsAffected())
+	return res, nil
+}
+
+var phoneSplitter = regexp.MustCompile(`[\/|,;]+`)
+
+// splitPhones разбивает строку с несколькими номерами, нормализует их и убирает повторы.
+func splitPhones(raw string) ([]validation.Phone, []string) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+
+	seen := make(map[string]struct{})
+	out := make([]validation.Phone, 0)
+	var invalid []string
+	for _, p := range phoneSplitter.Split(raw, -1) {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		phone, err := validation.NormalizePhone(p)
+		if err != nil {
+			invalid = append(invalid, err.Error())
+			continue
+		}
+		if _, ok := seen[phone.Digits]; ok {
+			continue
+		}
+		seen[phone.Digits] = struct{}{}
+		out = append(out, phone)
+	}
+	return out, invalid
+}
+
+func phoneVariants(phones []validation.Phone) []string {
+	out := make([]string, 0, len(phones)*4)
+	for _, p := range phones {
+		out = append(out, p.Variants()...)
+	}
+	return out
 }
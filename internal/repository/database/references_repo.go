@@ -0,0 +1,94 @@
+package database
+
+import (
+	"context"
+	"debtster_import/internal/config/connections/postgres"
+	"debtster_import/internal/repository/cache"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ReferenceRepo — справочник вида (id, name): agreement_types, phone_types,
+// address_types. Поиск по названию без учёта регистра и лишних пробелов.
+type ReferenceRepo struct {
+	pg    *postgres.Postgres
+	table string
+
+	// cache — общий для всех справочников, ключ включает таблицу.
+	cache *cache.LRU[referenceKey, int64]
+}
+
+func NewReferenceRepo(pg *postgres.Postgres, table string) *ReferenceRepo {
+	return &ReferenceRepo{
+		pg:    pg,
+		table: table,
+		cache: referenceCache,
+	}
+}
+
+func (r *ReferenceRepo) GetTableName() string {
+	return r.table
+}
+
+// Resolve ищет запись по названию. Возвращает nil, nil если не найдена.
+func (r *ReferenceRepo) Resolve(ctx context.Context, name string) (*int64, error) {
+	key := normalizeName(name)
+	if key == "" {
+		return nil, nil
+	}
+
+	id, found, ok := r.cache.Get(referenceKey{r.table, key})
+	if ok {
+		if !found {
+			return nil, nil
+		}
+		return &id, nil
+	}
+
+	err := r.pg.Pool.QueryRow(ctx,
+		`SELECT id FROM `+r.table+` WHERE LOWER(BTRIM(name)) = $1 ORDER BY id LIMIT 1`,
+		key,
+	).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		r.cache.SetMissing(referenceKey{r.table, key})
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.remember(key, id)
+	return &id, nil
+}
+
+// GetOrCreate ищет запись по названию и создаёт её, если не найдена.
+func (r *ReferenceRepo) GetOrCreate(ctx context.Context, name string) (int64, bool, error) {
+	if id, err := r.Resolve(ctx, name); err != nil || id != nil {
+		if err != nil {
+			return 0, false, err
+		}
+		return *id, false, nil
+	}
+
+	var id int64
+	err := r.pg.Pool.QueryRow(ctx,
+		`INSERT INTO `+r.table+` (name, created_at) VALUES ($1, NOW()) RETURNING id`,
+		collapseSpaces(name),
+	).Scan(&id)
+	if err != nil {
+		return 0, false, err
+	}
+
+	r.remember(normalizeName(name), id)
+	return id, true, nil
+}
+
+func (r *ReferenceRepo) remember(key string, id int64) {
+	r.cache.Set(referenceKey{r.table, key}, id)
+}
+
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -3,19 +3,25 @@ package database
 import (
 	"context"
 	"debtster_import/internal/config/connections/postgres"
+	"debtster_import/internal/repository/cache"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
 )
 
 type UserRepo struct {
 	pg    *postgres.Postgres
 	table string
-	cache map[string]*int64
+	// cache — логин → id, общий для всех UserRepo.
+	cache *cache.LRU[string, int64]
 }
 
 func NewUserRepo(pg *postgres.Postgres) *UserRepo {
 	return &UserRepo{
 		pg:    pg,
 		table: "users",
-		cache: make(map[string]*int64),
+		cache: userIDCache,
 	}
 }
 
@@ -24,8 +30,11 @@ func (r *UserRepo) GetTableName() string {
 }
 
 func (r *UserRepo) GetUserBigint(ctx context.Context, username string) (*int64, error) {
-	if v, ok := r.cache[username]; ok {
-		return v, nil
+	if v, found, ok := r.cache.Get(username); ok {
+		if !found {
+			return nil, nil
+		}
+		return &v, nil
 	}
 
 	var id int64
@@ -35,10 +44,68 @@ func (r *UserRepo) GetUserBigint(ctx context.Context, username string) (*int64,
 		username,
 	).Scan(&id)
 	if err != nil {
-		r.cache[username] = nil
+		if errors.Is(err, pgx.ErrNoRows) {
+			r.cache.SetMissing(username)
+		}
 		return nil, err
 	}
 
-	r.cache[username] = &id
+	r.cache.Set(username, id)
 	return &id, nil
 }
+
+// ResolveUserIDs — id пользователей по логинам одним запросом (ненайденных
+// в результате нет). Результат, включая промахи, кладётся в кэш GetUserBigint.
+func (r *UserRepo) ResolveUserIDs(ctx context.Context, usernames []string) (map[string]int64, error) {
+	out := make(map[string]int64, len(usernames))
+	missing := make([]string, 0, len(usernames))
+	seen := make(map[string]bool, len(usernames))
+
+	for _, u := range usernames {
+		u = strings.TrimSpace(u)
+		if u == "" || seen[u] {
+			continue
+		}
+		seen[u] = true
+		if v, found, ok := r.cache.Get(u); ok {
+			if found {
+				out[u] = v
+			}
+			continue
+		}
+		missing = append(missing, u)
+	}
+	if len(missing) == 0 {
+		return out, nil
+	}
+
+	rows, err := r.pg.Pool.Query(ctx,
+		`SELECT DISTINCT ON (username) username, id FROM `+r.table+` WHERE username = ANY($1) ORDER BY username, id`,
+		missing,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var username string
+		var id int64
+		if err := rows.Scan(&username, &id); err != nil {
+			return nil, err
+		}
+		out[username] = id
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, u := range missing {
+		if id, ok := out[u]; ok {
+			r.cache.Set(u, id)
+		} else {
+			r.cache.SetMissing(u)
+		}
+	}
+	return out, nil
+}
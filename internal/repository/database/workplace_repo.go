@@ -6,8 +6,6 @@ import (
 	"time"
 
 	"debtster_import/internal/config/connections/postgres"
-
-	"github.com/jackc/pgx/v5"
 )
 
 type WorkplaceRepo struct {
@@ -22,35 +20,74 @@ func NewWorkplaceRepo(db *postgres.Postgres, table string) *WorkplaceRepo {
 	}
 }
 
-func (r *WorkplaceRepo) Insert(ctx context.Context, rows []models.WorkPlace) error {
+// workplacesStage — временная таблица загрузки мест работы (Insert).
+var workplacesStage = Stage{
+	Table: "tmp_workplaces",
+	Columns: []StageColumn{
+		{"id", "uuid"}, {"name", "text"}, {"position", "text"}, {"uin", "text"},
+		{"address", "text"}, {"phone", "text"}, {"debtor_id", "uuid"},
+	},
+}
+
+// Insert добавляет места работы через COPY во временную таблицу и один
+// INSERT … SELECT; уже существующие (debtor_id, name) пропускаются.
+// Результат по строкам: false — место работы уже было.
+func (r *WorkplaceRepo) Insert(ctx context.Context, rows []models.WorkPlace) ([]bool, error) {
 	if len(rows) == 0 {
-		return nil
+		return nil, nil
 	}
 
-	batch := &pgx.Batch{}
-	for _, w := range rows {
-		batch.Queue(`
-			INSERT INTO `+r.table+` (
-				id, name, position, uin, address, phone, debtor_id, created_at
-			) VALUES (
-				$1::uuid, $2, $3, $4, $5, $6, $7::uuid, NOW()
-			)
-			ON CONFLICT (debtor_id, name) DO NOTHING
-		`,
-			w.ID, w.Name, w.Position, w.UIN, w.Address, w.Phone, w.DebtorID,
-		)
+	src := make([][]any, len(rows))
+	for i, w := range rows {
+		src[i] = []any{w.ID, w.Name, w.Position, w.UIN, w.Address, w.Phone, w.DebtorID}
 	}
 
-	br := r.db.Pool.SendBatch(ctx, batch)
-	defer br.Close()
+	return CopyMerge(ctx, r.db, workplacesStage, src, `
+		WITH ins AS (
+		    INSERT INTO `+r.table+` (
+		        id, name, position, uin, address, phone, debtor_id, created_at
+		    )
+		    SELECT s.id, s.name, s.position, s.uin, s.address, s.phone, s.debtor_id, NOW()
+		    FROM `+workplacesStage.Table+` s
+		    ORDER BY s.row_no
+		    ON CONFLICT (debtor_id, name) DO NOTHING
+		    RETURNING id
+		)
+		SELECT s.row_no FROM `+workplacesStage.Table+` s JOIN ins ON ins.id = s.id`,
+	)
+}
 
-	for range rows {
-		if _, err := br.Exec(); err != nil {
-			return err
-		}
+// Upsert создаёт или обновляет место работы должника по (debtor_id, name).
+// Пустые поля не затирают уже сохранённые значения.
+func (r *WorkplaceRepo) Upsert(ctx context.Context, w models.WorkPlace) (string, error) {
+	query := `
+		INSERT INTO ` + r.table + ` (
+			id, name, position, uin, address, phone, debtor_id, created_at
+		) VALUES (
+			gen_random_uuid(), $1, $2, $3, $4, $5, $6::uuid, NOW()
+		)
+		ON CONFLICT (debtor_id, name) DO UPDATE SET
+			position = COALESCE(NULLIF(EXCLUDED.position, ''), ` + r.table + `.position),
+			uin = COALESCE(NULLIF(EXCLUDED.uin, ''), ` + r.table + `.uin),
+			address = COALESCE(NULLIF(EXCLUDED.address, ''), ` + r.table + `.address),
+			phone = COALESCE(NULLIF(EXCLUDED.phone, ''), ` + r.table + `.phone),
+			updated_at = NOW()
+		RETURNING id::text
+	`
+
+	var id string
+	err := r.db.Pool.QueryRow(ctx, query,
+		w.Name, w.Position, w.UIN, w.Address, w.Phone, w.DebtorID,
+	).Scan(&id)
+	if err != nil {
+		return "", err
 	}
 
-	return nil
+	return id, nil
+}
+
+func (r *WorkplaceRepo) GetTableName() string {
+	return r.table
 }
 
 func (r *WorkplaceRepo) Exists(ctx context.Context, debtorID, name string) (bool, error) {
@@ -24,6 +24,7 @@ type Item struct {
 	Payload        string    `bson:"payload" json:"payload"`
 	Status         string    `bson:"status" json:"status"`
 	Errors         string    `bson:"errors" json:"errors"`
+	Details        any       `bson:"details,omitempty" json:"details,omitempty"`
 	CreatedAt      time.Time `bson:"created_at" json:"created_at"`
 	UpdatedAt      time.Time `bson:"updated_at" json:"updated_at"`
 }
@@ -35,6 +36,8 @@ type LogParams struct {
 	Payload        map[string]string
 	Status         string
 	Errors         string
+	// Details — произвольные структурированные данные строки (диф полей, балансы и т.п.).
+	Details any
 }
 
 func InsertItem(ctx context.Context, m *mg.Mongo, item Item) (*mongo.InsertOneResult, error) {
@@ -42,7 +45,30 @@ func InsertItem(ctx context.Context, m *mg.Mongo, item Item) (*mongo.InsertOneRe
 		return nil, mongo.ErrClientDisconnected
 	}
 
+	return m.Database.Collection(ImportRecordItemsCollection).InsertOne(ctx, itemDoc(item, time.Now().UTC()), options.InsertOne())
+}
+
+// InsertItems пишет элементы импорта одним InsertMany (без упорядочивания) —
+// для массовой загрузки, где InsertOne на строку заметно медленнее самой вставки в PG.
+func InsertItems(ctx context.Context, m *mg.Mongo, items []Item) error {
+	if m == nil || m.Client == nil || m.Database == nil {
+		return mongo.ErrClientDisconnected
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
 	now := time.Now().UTC()
+	docs := make([]any, len(items))
+	for i, item := range items {
+		docs[i] = itemDoc(item, now)
+	}
+
+	_, err := m.Database.Collection(ImportRecordItemsCollection).InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	return err
+}
+
+func itemDoc(item Item, now time.Time) bson.D {
 	if item.CreatedAt.IsZero() {
 		item.CreatedAt = now
 	}
@@ -58,8 +84,10 @@ func InsertItem(ctx context.Context, m *mg.Mongo, item Item) (*mongo.InsertOneRe
 		{Key: "created_at", Value: item.CreatedAt},
 		{Key: "updated_at", Value: item.UpdatedAt},
 	}
-
-	return m.Database.Collection(ImportRecordItemsCollection).InsertOne(ctx, doc, options.InsertOne())
+	if item.Details != nil {
+		doc = append(doc, bson.E{Key: "details", Value: item.Details})
+	}
+	return doc
 }
 
 func UpdateImportRecordStatus(ctx context.Context, m *mg.Mongo, importRecordID, status string) error {
@@ -125,8 +153,33 @@ func LogMongo(ctx context.Context, mgc *mg.Mongo, p LogParams) {
 		Payload:        string(b),
 		Status:         p.Status,
 		Errors:         p.Errors,
+		Details:        p.Details,
 	}); mErr != nil {
 		log.Printf("[PROC][%s][MONGO][ERR] id=%s status=%s err=%v",
 			p.ModelType, p.ModelID, p.Status, mErr)
 	}
 }
+
+// LogMongoMany — LogMongo для набора строк одним InsertMany.
+func LogMongoMany(ctx context.Context, mgc *mg.Mongo, ps []LogParams) {
+	if mgc == nil || mgc.Database == nil || len(ps) == 0 {
+		return
+	}
+
+	items := make([]Item, len(ps))
+	for i, p := range ps {
+		b, _ := json.Marshal(p.Payload)
+		items[i] = Item{
+			ImportRecordID: p.ImportRecordID,
+			ModelType:      p.ModelType,
+			ModelID:        p.ModelID,
+			Payload:        string(b),
+			Status:         p.Status,
+			Errors:         p.Errors,
+			Details:        p.Details,
+		}
+	}
+	if err := InsertItems(ctx, mgc, items); err != nil {
+		log.Printf("[PROC][%s][MONGO][ERR] items=%d err=%v", ps[0].ModelType, len(ps), err)
+	}
+}
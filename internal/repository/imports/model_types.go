@@ -15,6 +15,7 @@ const (
 	ModelTypeUserPlans      ModelType = "user_plans"
 	ModelTypeEnforcements   ModelType = "enforcement_proceedings"
 	ModelTypeExecDocs       ModelType = "executive_documents"
+	ModelTypeWorkPlaces     ModelType = "work_places"
 )
 
 var PHPModelMap = map[ModelType]string{
@@ -30,6 +31,7 @@ var PHPModelMap = map[ModelType]string{
 	ModelTypeUserPlans:      "App\\Infrastructure\\Persistence\\Models\\UserPlan",
 	ModelTypeEnforcements:   "App\\Infrastructure\\Persistence\\Models\\EnforcementProceeding",
 	ModelTypeExecDocs:       "App\\Infrastructure\\Persistence\\Models\\ExecutiveDocument",
+	ModelTypeWorkPlaces:     "App\\Infrastructure\\Persistence\\Models\\WorkPlace",
 }
 
 func PHPModelByTable(table string) string {
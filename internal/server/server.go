@@ -22,9 +22,12 @@ func NewServer(port string, h *handlers.Handlers) *Server {
 	if h != nil {
 		mux.HandleFunc("/health", h.Health)
 		mux.HandleFunc("/import", h.Import)
+		mux.HandleFunc("GET /metrics/cache", h.CacheStats)
 		tokenRepo := repository.NewPersonalAccessTokenRepository(h.Postgres)
 		sanctum := auth.SanctumMiddleware(tokenRepo)
 		mux.Handle("/upload", sanctum(http.HandlerFunc(h.Upload)))
+		mux.Handle("GET /debts/{number}/assignments", sanctum(http.HandlerFunc(h.DebtAssignments)))
+		mux.Handle("POST /agreements/compliance", sanctum(http.HandlerFunc(h.AgreementsCompliance)))
 	}
 
 	return &Server{
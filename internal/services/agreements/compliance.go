@@ -0,0 +1,274 @@
+package agreements
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"debtster_import/internal/models"
+	"debtster_import/internal/repository/database"
+
+	"github.com/google/uuid"
+)
+
+// ActionAgreementBroken — тип действия, создаваемого при нарушении соглашения.
+const ActionAgreementBroken = "agreement_broken"
+
+// ActionAgreementRestored — тип действия, создаваемого, когда нарушенное
+// соглашение снова выполняется (например, просроченный платёж пришёл позже).
+const ActionAgreementRestored = "agreement_restored"
+
+// complianceChunk — сколько соглашений проверяется за один проход.
+const complianceChunk = 500
+
+// Checker сверяет графики действующих и нарушенных соглашений с платежами
+// по долгу: отмечает платежи графика как paid / partial / overdue, переводит
+// соглашение в broken, если платёж просрочен дольше GraceDays, и возвращает
+// в active, если просрочки больше нет.
+type Checker struct {
+	Agreements *database.AgreementRepo
+	Payments   *database.PaymentRepo
+	Actions    *database.ActionRepo
+
+	// GraceDays — сколько дней после даты платежа просрочка ещё не нарушение.
+	GraceDays int
+	// CreateActions — создавать действие agreement_broken при нарушении.
+	CreateActions bool
+}
+
+// Report — итог проверки.
+type Report struct {
+	Agreements   int      `json:"agreements"`
+	Installments int      `json:"installments_updated"`
+	Overdue      int      `json:"installments_overdue"`
+	Broken       []string `json:"broken_agreement_ids"`
+	Restored     []string `json:"restored_agreement_ids"`
+	Actions      int      `json:"actions_created"`
+}
+
+// Run проверяет действующие и нарушенные соглашения по долгам debtIDs (nil — все) на дату asOf.
+func (c *Checker) Run(ctx context.Context, debtIDs []string, asOf time.Time) (Report, error) {
+	var rep Report
+
+	list, err := c.Agreements.ListCheckable(ctx, debtIDs)
+	if err != nil {
+		return rep, fmt.Errorf("list agreements: %w", err)
+	}
+	rep.Agreements = len(list)
+
+	for start := 0; start < len(list); start += complianceChunk {
+		end := min(start+complianceChunk, len(list))
+		if err := c.checkChunk(ctx, list[start:end], asOf, &rep); err != nil {
+			return rep, err
+		}
+	}
+
+	log.Printf("[AGREEMENTS][COMPLIANCE] agreements=%d updated=%d overdue=%d broken=%d restored=%d actions=%d",
+		rep.Agreements, rep.Installments, rep.Overdue, len(rep.Broken), len(rep.Restored), rep.Actions)
+	return rep, nil
+}
+
+func (c *Checker) checkChunk(ctx context.Context, list []models.Agreement, asOf time.Time, rep *Report) error {
+	ids := make([]string, 0, len(list))
+	debtSet := make(map[string]bool)
+	debts := make([]string, 0, len(list))
+	for _, a := range list {
+		ids = append(ids, a.ID)
+		if a.DebtID != nil && !debtSet[*a.DebtID] {
+			debtSet[*a.DebtID] = true
+			debts = append(debts, *a.DebtID)
+		}
+	}
+
+	schedules, err := c.Agreements.Schedules(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("load schedules: %w", err)
+	}
+	payments, err := c.Payments.ListForDebts(ctx, debts)
+	if err != nil {
+		return fmt.Errorf("load payments: %w", err)
+	}
+
+	var (
+		changed []models.AgreementInstallment
+		actions []models.Action
+	)
+	for _, a := range list {
+		schedule := schedules[a.ID]
+		if len(schedule) == 0 || a.DebtID == nil {
+			continue
+		}
+
+		var facts []database.PaymentFact
+		for _, f := range payments[*a.DebtID] {
+			if a.StartDate == nil || !f.Date.Before(truncateDay(*a.StartDate)) {
+				facts = append(facts, f)
+			}
+		}
+
+		updated, firstBroken := Evaluate(schedule, facts, asOf, c.GraceDays)
+		for i := range updated {
+			if updated[i].Status == models.InstallmentOverdue {
+				rep.Overdue++
+			}
+			if installmentChanged(schedule[i], updated[i]) {
+				changed = append(changed, updated[i])
+			}
+		}
+
+		if firstBroken == nil {
+			if a.Status != models.AgreementBroken {
+				continue
+			}
+			ok, err := c.Agreements.Restore(ctx, a.ID)
+			if err != nil {
+				return fmt.Errorf("restore %s: %w", a.ID, err)
+			}
+			if ok {
+				rep.Restored = append(rep.Restored, a.ID)
+				if c.CreateActions && c.Actions != nil {
+					actions = append(actions, restoredAction(a))
+				}
+			}
+			continue
+		}
+		if a.Status == models.AgreementBroken {
+			continue
+		}
+		ok, err := c.Agreements.MarkBroken(ctx, a.ID)
+		if err != nil {
+			return fmt.Errorf("mark broken %s: %w", a.ID, err)
+		}
+		if !ok {
+			continue
+		}
+		rep.Broken = append(rep.Broken, a.ID)
+
+		if c.CreateActions && c.Actions != nil {
+			actions = append(actions, brokenAction(a, *firstBroken))
+		}
+	}
+
+	if err := c.Agreements.UpdateInstallments(ctx, changed); err != nil {
+		return fmt.Errorf("update installments: %w", err)
+	}
+	rep.Installments += len(changed)
+
+	if len(actions) > 0 {
+		if err := c.Actions.InsertActions(ctx, actions); err != nil {
+			return fmt.Errorf("create actions: %w", err)
+		}
+		rep.Actions += len(actions)
+	}
+	return nil
+}
+
+// Evaluate распределяет платежи по графику в хронологическом порядке и
+// вычисляет статусы на дату asOf. Возвращает первый платёж, просроченный
+// дольше graceDays (nil — соглашение не нарушено).
+func Evaluate(
+	schedule []models.AgreementInstallment,
+	payments []database.PaymentFact,
+	asOf time.Time,
+	graceDays int,
+) ([]models.AgreementInstallment, *models.AgreementInstallment) {
+	asOf = truncateDay(asOf)
+	out := make([]models.AgreementInstallment, len(schedule))
+	copy(out, schedule)
+
+	pi := 0
+	var carry float64 // остаток текущего платежа
+	var carryDate time.Time
+	var broken *models.AgreementInstallment
+
+	for i := range out {
+		it := &out[i]
+		it.PaidAmount = 0
+		it.PaidAt = nil
+
+		for it.PaidAmount < it.Amount {
+			if carry <= 0 {
+				if pi >= len(payments) {
+					break
+				}
+				carry = payments[pi].Amount
+				carryDate = payments[pi].Date
+				pi++
+				continue
+			}
+			part := math.Min(carry, it.Amount-it.PaidAmount)
+			it.PaidAmount = round2(it.PaidAmount + part)
+			carry = round2(carry - part)
+			if it.PaidAmount >= it.Amount {
+				d := truncateDay(carryDate)
+				it.PaidAt = &d
+			}
+		}
+
+		due := truncateDay(it.DueDate)
+		switch {
+		case it.PaidAmount >= it.Amount:
+			it.Status = models.InstallmentPaid
+		case due.Before(asOf):
+			it.Status = models.InstallmentOverdue
+			if broken == nil && due.AddDate(0, 0, graceDays).Before(asOf) {
+				b := *it
+				broken = &b
+			}
+		case it.PaidAmount > 0:
+			it.Status = models.InstallmentPartial
+		default:
+			it.Status = models.InstallmentPending
+		}
+	}
+	return out, broken
+}
+
+func installmentChanged(a, b models.AgreementInstallment) bool {
+	if a.Status != b.Status || a.PaidAmount != b.PaidAmount {
+		return true
+	}
+	if (a.PaidAt == nil) != (b.PaidAt == nil) {
+		return true
+	}
+	return a.PaidAt != nil && !a.PaidAt.Equal(*b.PaidAt)
+}
+
+func brokenAction(a models.Agreement, it models.AgreementInstallment) models.Action {
+	typ := ActionAgreementBroken
+	number := ""
+	if a.Number != nil {
+		number = " № " + *a.Number
+	}
+	comment := fmt.Sprintf("Соглашение%s нарушено: платёж %d от %s на сумму %.2f оплачен на %.2f",
+		number, it.No, it.DueDate.Format("02.01.2006"), it.Amount, it.PaidAmount)
+	now := time.Now()
+	return models.Action{
+		ID:        uuid.NewString(),
+		DebtID:    a.DebtID,
+		UserID:    a.UserID,
+		Type:      &typ,
+		Comment:   &comment,
+		CreatedAt: &now,
+	}
+}
+
+func restoredAction(a models.Agreement) models.Action {
+	typ := ActionAgreementRestored
+	number := ""
+	if a.Number != nil {
+		number = " № " + *a.Number
+	}
+	comment := fmt.Sprintf("Соглашение%s снова выполняется: просроченных платежей нет", number)
+	now := time.Now()
+	return models.Action{
+		ID:        uuid.NewString(),
+		DebtID:    a.DebtID,
+		UserID:    a.UserID,
+		Type:      &typ,
+		Comment:   &comment,
+		CreatedAt: &now,
+	}
+}
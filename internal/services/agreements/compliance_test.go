@@ -0,0 +1,183 @@
+package agreements
+
+import (
+	"testing"
+
+	"debtster_import/internal/models"
+	"debtster_import/internal/repository/database"
+)
+
+func TestEvaluate(t *testing.T) {
+	schedule := []models.AgreementInstallment{
+		{No: 1, DueDate: day("2024-01-10"), Amount: 100},
+		{No: 2, DueDate: day("2024-02-10"), Amount: 100},
+		{No: 3, DueDate: day("2024-03-10"), Amount: 100},
+	}
+	pay := func(date string, amount float64) database.PaymentFact {
+		return database.PaymentFact{Date: day(date), Amount: amount}
+	}
+
+	type want struct {
+		status string
+		paid   float64
+		paidAt string // "" — PaidAt не задан
+	}
+
+	tests := []struct {
+		name       string
+		schedule   []models.AgreementInstallment
+		payments   []database.PaymentFact
+		asOf       string
+		grace      int
+		want       []want
+		wantBroken int // No первого нарушенного платежа, 0 — не нарушено
+	}{
+		{
+			name:  "no payments, overdue within grace days",
+			asOf:  "2024-01-12",
+			grace: 5,
+			want: []want{
+				{models.InstallmentOverdue, 0, ""},
+				{models.InstallmentPending, 0, ""},
+				{models.InstallmentPending, 0, ""},
+			},
+		},
+		{
+			name:  "grace days end on asOf: not broken yet",
+			asOf:  "2024-01-15",
+			grace: 5,
+			want: []want{
+				{models.InstallmentOverdue, 0, ""},
+				{models.InstallmentPending, 0, ""},
+				{models.InstallmentPending, 0, ""},
+			},
+		},
+		{
+			name:  "overdue longer than grace days breaks the agreement",
+			asOf:  "2024-01-16",
+			grace: 5,
+			want: []want{
+				{models.InstallmentOverdue, 0, ""},
+				{models.InstallmentPending, 0, ""},
+				{models.InstallmentPending, 0, ""},
+			},
+			wantBroken: 1,
+		},
+		{
+			name:  "zero grace days: broken the day after due date",
+			asOf:  "2024-01-11",
+			grace: 0,
+			want: []want{
+				{models.InstallmentOverdue, 0, ""},
+				{models.InstallmentPending, 0, ""},
+				{models.InstallmentPending, 0, ""},
+			},
+			wantBroken: 1,
+		},
+		{
+			name:     "payment on the due date counts as paid",
+			payments: []database.PaymentFact{pay("2024-01-10", 100)},
+			asOf:     "2024-01-10",
+			grace:    5,
+			want: []want{
+				{models.InstallmentPaid, 100, "2024-01-10"},
+				{models.InstallmentPending, 0, ""},
+				{models.InstallmentPending, 0, ""},
+			},
+		},
+		{
+			name:     "overpayment carries over to the next installment",
+			payments: []database.PaymentFact{pay("2024-01-09", 150)},
+			asOf:     "2024-02-20",
+			grace:    5,
+			want: []want{
+				{models.InstallmentPaid, 100, "2024-01-09"},
+				{models.InstallmentOverdue, 50, ""},
+				{models.InstallmentPending, 0, ""},
+			},
+			wantBroken: 2,
+		},
+		{
+			name:     "installment paid by several payments gets the date of the last one",
+			payments: []database.PaymentFact{pay("2024-01-05", 60), pay("2024-01-20", 40)},
+			asOf:     "2024-01-25",
+			grace:    5,
+			want: []want{
+				{models.InstallmentPaid, 100, "2024-01-20"},
+				{models.InstallmentPending, 0, ""},
+				{models.InstallmentPending, 0, ""},
+			},
+		},
+		{
+			name:     "partial payment before due date",
+			payments: []database.PaymentFact{pay("2024-01-05", 30)},
+			asOf:     "2024-01-05",
+			grace:    5,
+			want: []want{
+				{models.InstallmentPartial, 30, ""},
+				{models.InstallmentPending, 0, ""},
+				{models.InstallmentPending, 0, ""},
+			},
+		},
+		{
+			name:     "late payment restores the schedule",
+			payments: []database.PaymentFact{pay("2024-02-01", 200)},
+			asOf:     "2024-02-10",
+			grace:    5,
+			want: []want{
+				{models.InstallmentPaid, 100, "2024-02-01"},
+				{models.InstallmentPaid, 100, "2024-02-01"},
+				{models.InstallmentPending, 0, ""},
+			},
+		},
+		{
+			name: "stale paid amounts of the stored schedule are recalculated",
+			schedule: []models.AgreementInstallment{
+				{No: 1, DueDate: day("2024-01-10"), Amount: 100, PaidAmount: 100, Status: models.InstallmentPaid, PaidAt: dayPtr("2024-01-01")},
+			},
+			asOf:  "2024-01-20",
+			grace: 5,
+			want: []want{
+				{models.InstallmentOverdue, 0, ""},
+			},
+			wantBroken: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := tt.schedule
+			if in == nil {
+				in = schedule
+			}
+			got, broken := Evaluate(in, tt.payments, day(tt.asOf), tt.grace)
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d installments, want %d", len(got), len(tt.want))
+			}
+			for i, w := range tt.want {
+				g := got[i]
+				if g.Status != w.status || g.PaidAmount != w.paid {
+					t.Errorf("[%d] status=%s paid=%v, want status=%s paid=%v", i, g.Status, g.PaidAmount, w.status, w.paid)
+				}
+				switch {
+				case w.paidAt == "" && g.PaidAt != nil:
+					t.Errorf("[%d] PaidAt = %s, want nil", i, g.PaidAt.Format("2006-01-02"))
+				case w.paidAt != "" && (g.PaidAt == nil || !g.PaidAt.Equal(day(w.paidAt))):
+					t.Errorf("[%d] PaidAt = %v, want %s", i, g.PaidAt, w.paidAt)
+				}
+			}
+
+			switch {
+			case tt.wantBroken == 0 && broken != nil:
+				t.Errorf("broken = #%d, want nil", broken.No)
+			case tt.wantBroken != 0 && (broken == nil || broken.No != tt.wantBroken):
+				t.Errorf("broken = %+v, want #%d", broken, tt.wantBroken)
+			}
+		})
+	}
+
+	if schedule[0].Status != "" || schedule[0].PaidAmount != 0 {
+		t.Errorf("Evaluate changed the input schedule: %+v", schedule[0])
+	}
+}
@@ -0,0 +1,144 @@
+package agreements
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"debtster_import/internal/models"
+)
+
+// maxInstallments — защита от некорректных дат (например, end_date через сто лет).
+const maxInstallments = 600
+
+var (
+	ErrNoStartDate = errors.New("schedule: missing start_date")
+	ErrNoAmounts   = errors.New("schedule: missing monthly_payment_amount and amount_debt")
+)
+
+// BuildSchedule строит график платежей соглашения.
+//
+// Платежи ежемесячные, в scheduled_payment_day (по умолчанию — день
+// start_date; для коротких месяцев — последний день месяца), начиная с
+// первой такой даты не раньше start_date и не позже end_date.
+//
+//   - задана сумма долга и ежемесячный платёж: платежи по monthly_payment_amount,
+//     пока не покрыта сумма долга; последний платёж — остаток. Если end_date
+//     наступает раньше, остаток переносится на последний платёж до end_date;
+//   - задан только долг: он делится поровну на месяцы до end_date;
+//   - задан только ежемесячный платёж: платежи до end_date.
+func BuildSchedule(a models.Agreement) ([]models.AgreementInstallment, error) {
+	if a.StartDate == nil {
+		return nil, ErrNoStartDate
+	}
+
+	total := parseAmount(a.AmountDebt)
+	monthly := parseAmount(a.MonthlyPaymentAmount)
+	if total <= 0 && monthly <= 0 {
+		return nil, ErrNoAmounts
+	}
+
+	start := truncateDay(*a.StartDate)
+	day := start.Day()
+	if a.ScheduledPaymentDay != nil {
+		if d, err := strconv.Atoi(strings.TrimSpace(*a.ScheduledPaymentDay)); err == nil && d >= 1 && d <= 31 {
+			day = d
+		}
+	}
+
+	var end *time.Time
+	if a.EndDate != nil {
+		e := truncateDay(*a.EndDate)
+		end = &e
+	}
+
+	dates := dueDates(start, end, day, total, monthly)
+	if len(dates) == 0 {
+		return nil, nil
+	}
+
+	amounts := make([]float64, len(dates))
+	switch {
+	case total > 0 && monthly > 0:
+		rest := total
+		for i := range dates {
+			amt := math.Min(monthly, rest)
+			if i == len(dates)-1 {
+				amt = rest
+			}
+			amounts[i] = round2(amt)
+			rest = round2(rest - amounts[i])
+		}
+	case total > 0:
+		per := math.Floor(total/float64(len(dates))*100) / 100
+		for i := range dates {
+			amounts[i] = per
+		}
+		amounts[len(amounts)-1] = round2(total - per*float64(len(dates)-1))
+	default:
+		for i := range dates {
+			amounts[i] = round2(monthly)
+		}
+	}
+
+	out := make([]models.AgreementInstallment, 0, len(dates))
+	for i, d := range dates {
+		if amounts[i] <= 0 {
+			break
+		}
+		out = append(out, models.AgreementInstallment{No: i + 1, DueDate: d, Amount: amounts[i]})
+	}
+	return out, nil
+}
+
+// dueDates — даты платежей. Без end_date число платежей определяется
+// суммой долга и ежемесячным платежом.
+func dueDates(start time.Time, end *time.Time, day int, total, monthly float64) []time.Time {
+	limit := maxInstallments
+	if end == nil {
+		if total <= 0 || monthly <= 0 {
+			return nil
+		}
+		limit = min(int(math.Ceil(total/monthly)), maxInstallments)
+	}
+
+	var dates []time.Time
+	for m := 0; len(dates) < limit && m < maxInstallments+1; m++ {
+		d := monthDay(start.Year(), start.Month()+time.Month(m), day)
+		if d.Before(start) {
+			continue
+		}
+		if end != nil && d.After(*end) {
+			break
+		}
+		dates = append(dates, d)
+		// сумма долга покрыта раньше end_date
+		if end != nil && total > 0 && monthly > 0 && float64(len(dates))*monthly >= total {
+			break
+		}
+	}
+	return dates
+}
+
+// monthDay — день месяца, ограниченный последним днём месяца.
+func monthDay(year int, month time.Month, day int) time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1).Day()
+	return time.Date(first.Year(), first.Month(), min(day, last), 0, 0, 0, 0, time.UTC)
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func parseAmount(s string) float64 {
+	s = strings.ReplaceAll(strings.ReplaceAll(strings.TrimSpace(s), " ", ""), ",", ".")
+	v, _ := strconv.ParseFloat(s, 64)
+	return v
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,173 @@
+package agreements
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"debtster_import/internal/models"
+)
+
+func day(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func dayPtr(s string) *time.Time {
+	t := day(s)
+	return &t
+}
+
+func strPtr(s string) *string { return &s }
+
+type wantInstallment struct {
+	due    string
+	amount float64
+}
+
+func TestBuildSchedule(t *testing.T) {
+	tests := []struct {
+		name    string
+		a       models.Agreement
+		want    []wantInstallment
+		wantErr error
+	}{
+		{
+			name: "debt and monthly without end date, last payment is the rest",
+			a: models.Agreement{
+				StartDate: dayPtr("2024-01-15"), AmountDebt: "1000", MonthlyPaymentAmount: "300",
+			},
+			want: []wantInstallment{
+				{"2024-01-15", 300}, {"2024-02-15", 300}, {"2024-03-15", 300}, {"2024-04-15", 100},
+			},
+		},
+		{
+			name: "day 31 is clipped to the end of short months (leap year)",
+			a: models.Agreement{
+				StartDate: dayPtr("2024-01-31"), AmountDebt: "300", MonthlyPaymentAmount: "100",
+			},
+			want: []wantInstallment{
+				{"2024-01-31", 100}, {"2024-02-29", 100}, {"2024-03-31", 100},
+			},
+		},
+		{
+			name: "day 31 is clipped to February 28 in a common year",
+			a: models.Agreement{
+				StartDate: dayPtr("2023-01-31"), AmountDebt: "200", MonthlyPaymentAmount: "100",
+			},
+			want: []wantInstallment{
+				{"2023-01-31", 100}, {"2023-02-28", 100},
+			},
+		},
+		{
+			name: "scheduled day before start date moves the first payment to next month",
+			a: models.Agreement{
+				StartDate: dayPtr("2024-01-15"), ScheduledPaymentDay: strPtr("10"),
+				AmountDebt: "200", MonthlyPaymentAmount: "100",
+			},
+			want: []wantInstallment{
+				{"2024-02-10", 100}, {"2024-03-10", 100},
+			},
+		},
+		{
+			name: "invalid scheduled day falls back to the start day",
+			a: models.Agreement{
+				StartDate: dayPtr("2024-01-15"), ScheduledPaymentDay: strPtr("32"),
+				AmountDebt: "100", MonthlyPaymentAmount: "100",
+			},
+			want: []wantInstallment{
+				{"2024-01-15", 100},
+			},
+		},
+		{
+			name: "end date comes first: the rest is added to the last payment",
+			a: models.Agreement{
+				StartDate: dayPtr("2024-01-01"), EndDate: dayPtr("2024-03-01"),
+				AmountDebt: "1000", MonthlyPaymentAmount: "300",
+			},
+			want: []wantInstallment{
+				{"2024-01-01", 300}, {"2024-02-01", 300}, {"2024-03-01", 400},
+			},
+		},
+		{
+			name: "debt covered before end date stops the schedule",
+			a: models.Agreement{
+				StartDate: dayPtr("2024-01-01"), EndDate: dayPtr("2024-12-01"),
+				AmountDebt: "200", MonthlyPaymentAmount: "100",
+			},
+			want: []wantInstallment{
+				{"2024-01-01", 100}, {"2024-02-01", 100},
+			},
+		},
+		{
+			name: "only debt: split evenly, rounding goes to the last payment",
+			a: models.Agreement{
+				StartDate: dayPtr("2024-01-10"), EndDate: dayPtr("2024-03-10"), AmountDebt: "100",
+			},
+			want: []wantInstallment{
+				{"2024-01-10", 33.33}, {"2024-02-10", 33.33}, {"2024-03-10", 33.34},
+			},
+		},
+		{
+			name: "only monthly payment: payments until end date",
+			a: models.Agreement{
+				StartDate: dayPtr("2024-01-05"), EndDate: dayPtr("2024-03-04"), MonthlyPaymentAmount: "50",
+			},
+			want: []wantInstallment{
+				{"2024-01-05", 50}, {"2024-02-05", 50},
+			},
+		},
+		{
+			name: "only monthly payment without end date: no schedule",
+			a: models.Agreement{
+				StartDate: dayPtr("2024-01-05"), MonthlyPaymentAmount: "50",
+			},
+		},
+		{
+			name: "amounts with spaces and decimal comma",
+			a: models.Agreement{
+				StartDate: dayPtr("2024-01-05"), AmountDebt: "1 000,50", MonthlyPaymentAmount: "500",
+			},
+			want: []wantInstallment{
+				{"2024-01-05", 500}, {"2024-02-05", 500}, {"2024-03-05", 0.5},
+			},
+		},
+		{
+			name:    "missing start date",
+			a:       models.Agreement{AmountDebt: "100"},
+			wantErr: ErrNoStartDate,
+		},
+		{
+			name:    "missing amounts",
+			a:       models.Agreement{StartDate: dayPtr("2024-01-01")},
+			wantErr: ErrNoAmounts,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BuildSchedule(tt.a)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d installments, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, w := range tt.want {
+				g := got[i]
+				if g.No != i+1 {
+					t.Errorf("[%d] No = %d, want %d", i, g.No, i+1)
+				}
+				if !g.DueDate.Equal(day(w.due)) {
+					t.Errorf("[%d] DueDate = %s, want %s", i, g.DueDate.Format("2006-01-02"), w.due)
+				}
+				if g.Amount != w.amount {
+					t.Errorf("[%d] Amount = %v, want %v", i, g.Amount, w.amount)
+				}
+			}
+		})
+	}
+}
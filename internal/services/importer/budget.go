@@ -0,0 +1,69 @@
+package importer
+
+import (
+	"context"
+	"log"
+
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	// xlsxXMLMemLimit — сколько распакованного XML листа excelize держит в памяти,
+	// всё что больше уходит во временные файлы.
+	xlsxXMLMemLimit int64 = 16 << 20
+
+	// importBaseCost — накладные расходы одного импорта (батчи, буферы, драйверы).
+	importBaseCost int64 = 32 << 20
+)
+
+// MemoryBudget ограничивает суммарную оценочную память одновременно идущих импортов,
+// то есть только их число: импорт, который оценён больше всего бюджета, всё равно
+// выполняется и займёт столько, сколько потребует excelize.
+// Один экземпляр разделяется всеми импортами процесса.
+type MemoryBudget struct {
+	total int64
+	sem   *semaphore.Weighted
+}
+
+func NewMemoryBudget(totalBytes int64) *MemoryBudget {
+	if totalBytes <= 0 {
+		return nil
+	}
+	return &MemoryBudget{total: totalBytes, sem: semaphore.NewWeighted(totalBytes)}
+}
+
+// Acquire блокируется, пока в бюджете не освободится n байт, либо до отмены ctx.
+// Запрос больше всего бюджета урезается до бюджета, чтобы импорт всё же выполнился (в одиночку).
+func (b *MemoryBudget) Acquire(ctx context.Context, n int64) (func(), error) {
+	if b == nil {
+		return func() {}, nil
+	}
+	if n <= 0 {
+		n = 1
+	}
+	if n > b.total {
+		n = b.total
+	}
+	if !b.sem.TryAcquire(n) {
+		log.Printf("[IMP][BUDGET] waiting for %d bytes (budget=%d)", n, b.total)
+		if err := b.sem.Acquire(ctx, n); err != nil {
+			return nil, err
+		}
+	}
+	return func() { b.sem.Release(n) }, nil
+}
+
+// estimateMemory — грубая оценка пикового потребления памяти импортом.
+// XLSX: excelize держит весь zip в памяти плюс до xlsxXMLMemLimit на лист и shared strings.
+// CSV и банковские выписки читаются потоково.
+func estimateMemory(format string, size int64) int64 {
+	if size < 0 {
+		size = 0
+	}
+	switch format {
+	case "csv", formatMT940, format1C:
+		return importBaseCost
+	default:
+		return importBaseCost + size + 2*xlsxXMLMemLimit
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"debtster_import/internal/models"
 	"debtster_import/internal/repository/database"
+	"debtster_import/internal/services/statuses"
+	"debtster_import/internal/validation"
+	"fmt"
 	"log"
 	"strings"
 
@@ -19,6 +22,19 @@ type ActionsProcessor struct {
 	ActionsRepo      *database.ActionRepo
 	UserRepo         *database.UserRepo
 	DebtStatusesRepo *database.DebtStatusesRepo
+
+	// Transitions — допустимые переходы статусов; nil — без ограничений.
+	Transitions *statuses.Graph
+
+	// Bulk — загружать батч через COPY (опция импорта bulk переопределяет).
+	Bulk bool
+}
+
+// actionMeta — исходная строка файла для действия.
+type actionMeta struct {
+	id       string
+	data     map[string]string
+	warnings []string
 }
 
 func (p ActionsProcessor) Type() string { return "import_actions" }
@@ -38,21 +54,30 @@ func (p *ActionsProcessor) ProcessBatch(ctx context.Context, batch []map[string]
 		}
 	}
 
-	log.Printf("[PROC][actions][START] rows=%d import_record_id=%s", len(batch), importRecordID)
+	strict := strictReferences(ctx)
 
-	type meta struct {
-		id       string
-		data     map[string]string
-		warnings []string
-	}
+	log.Printf("[PROC][actions][START] rows=%d import_record_id=%s strict_references=%t", len(batch), importRecordID, strict)
 
 	modelType := importitems.PHPModelByTable(p.ActionsRepo.GetTableName())
 
+	debtIDs, err := p.DebtsRepo.ResolveDebtIDs(ctx, columnValues(batch, "debt_number"))
+	if err != nil {
+		return fmt.Errorf("resolve debts: %w", err)
+	}
+	userIDs, err := p.UserRepo.ResolveUserIDs(ctx, columnValues(batch, "username"))
+	if err != nil {
+		return fmt.Errorf("resolve users: %w", err)
+	}
+	statusIDs, err := p.DebtStatusesRepo.ResolveStatusIDs(ctx, columnValues(batch, "status"))
+	if err != nil {
+		return fmt.Errorf("resolve statuses: %w", err)
+	}
+
 	actions := make([]models.Action, 0, len(batch))
-	metas := make([]meta, 0, len(batch))
+	metas := make([]actionMeta, 0, len(batch))
 
 	for i, m := range batch {
-		debtNumber := strings.TrimSpace(m["debt_number"])
+		debtNumber := validation.NormalizeDebtNumber(m["debt_number"])
 		if debtNumber == "" {
 			if _, err := importitems.InsertItem(ctx, p.MG, importitems.Item{
 				ImportRecordID: importRecordID,
@@ -67,12 +92,9 @@ func (p *ActionsProcessor) ProcessBatch(ctx context.Context, batch []map[string]
 			continue
 		}
 
-		debtID, err := p.DebtsRepo.GetIDByNumber(ctx, debtNumber)
-		if err != nil || debtID == nil {
+		debtID, ok := debtIDs[debtNumber]
+		if !ok {
 			msg := "debt not found: " + debtNumber
-			if err != nil {
-				msg += " (" + err.Error() + ")"
-			}
 			if _, mErr := importitems.InsertItem(ctx, p.MG, importitems.Item{
 				ImportRecordID: importRecordID,
 				ModelType:      modelType,
@@ -92,8 +114,8 @@ func (p *ActionsProcessor) ProcessBatch(ctx context.Context, batch []map[string]
 		if un := strings.TrimSpace(m["username"]); un == "" {
 			warnings = append(warnings, "missing username -> user_id=NULL")
 		} else {
-			if uid, err := p.UserRepo.GetUserBigint(ctx, un); err == nil && uid != nil {
-				userID = uid
+			if uid, ok := userIDs[un]; ok {
+				userID = &uid
 			} else {
 				warnings = append(warnings, "username not found: "+un+" -> user_id=NULL")
 			}
@@ -103,8 +125,20 @@ func (p *ActionsProcessor) ProcessBatch(ctx context.Context, batch []map[string]
 		if st := strings.TrimSpace(m["status"]); st == "" {
 			warnings = append(warnings, "missing status -> debt_status_id=NULL")
 		} else {
-			if sid, err := p.DebtStatusesRepo.GetStatusBigint(ctx, st); err == nil && sid != nil {
-				statusID = sid
+			if sid, ok := statusIDs[st]; ok {
+				statusID = &sid
+			} else if strict {
+				if _, mErr := importitems.InsertItem(ctx, p.MG, importitems.Item{
+					ImportRecordID: importRecordID,
+					ModelType:      modelType,
+					ModelID:        uuid.NewString(),
+					Payload:        mustJSON(m),
+					Status:         "failed",
+					Errors:         "status not found: " + st,
+				}); mErr != nil {
+					log.Printf("[PROC][actions][MONGO][ERR] row=%d status not found: %v", i, mErr)
+				}
+				continue
 			} else {
 				warnings = append(warnings, "status not found: "+st+" -> debt_status_id=NULL")
 			}
@@ -114,7 +148,7 @@ func (p *ActionsProcessor) ProcessBatch(ctx context.Context, batch []map[string]
 
 		action := models.Action{
 			ID:           id,
-			DebtID:       debtID,
+			DebtID:       &debtID,
 			UserID:       userID,
 			DebtStatusID: statusID,
 			Type:         nullIfEmpty(strings.TrimSpace(m["type"])),
@@ -124,7 +158,7 @@ func (p *ActionsProcessor) ProcessBatch(ctx context.Context, batch []map[string]
 
 		actions = append(actions, action)
 
-		metas = append(metas, meta{
+		metas = append(metas, actionMeta{
 			id:       id,
 			data:     m,
 			warnings: warnings,
@@ -136,19 +170,29 @@ func (p *ActionsProcessor) ProcessBatch(ctx context.Context, batch []map[string]
 		return nil
 	}
 
-	if err := p.ActionsRepo.InsertActions(ctx, actions); err != nil {
+	// ------------------------------------------------------------
+	// Вставка; смена статуса долга проверяется в той же транзакции
+	// ------------------------------------------------------------
+	reject := func(m actionMeta, msg string) {
+		if _, mErr := importitems.InsertItem(ctx, p.MG, importitems.Item{
+			ImportRecordID: importRecordID,
+			ModelType:      modelType,
+			ModelID:        m.id,
+			Payload:        mustJSON(m.data),
+			Status:         "failed",
+			Errors:         msg,
+		}); mErr != nil {
+			log.Printf("[PROC][actions][MONGO][ERR] id=%s status=failed err=%v", m.id, mErr)
+		}
+	}
+
+	bulk := bulkLoad(ctx, p.Bulk)
+
+	actions, metas, rowErrs, err := p.insertWithStatuses(ctx, actions, metas, reject, bulk)
+	if err != nil {
 		log.Printf("[PROC][actions][ERR] batch insert failed: %v", err)
 		for _, m := range metas {
-			if _, mErr := importitems.InsertItem(ctx, p.MG, importitems.Item{
-				ImportRecordID: importRecordID,
-				ModelType:      modelType,
-				ModelID:        m.id,
-				Payload:        mustJSON(m.data),
-				Status:         "failed",
-				Errors:         err.Error(),
-			}); mErr != nil {
-				log.Printf("[PROC][actions][MONGO][ERR] id=%s status=failed err=%v", m.id, mErr)
-			}
+			reject(m, err.Error())
 		}
 		log.Printf("[PROC][actions][DONE] total=%d inserted=0", len(actions))
 		if err := importitems.UpdateImportRecordStatusDone(ctx, p.MG, importRecordID); err != nil {
@@ -158,25 +202,40 @@ func (p *ActionsProcessor) ProcessBatch(ctx context.Context, batch []map[string]
 	}
 
 	inserted := 0
+	items := make([]importitems.Item, 0, len(metas))
 
-	for _, m := range metas {
-		errText := strings.Join(m.warnings, "; ")
-		if res, mErr := importitems.InsertItem(ctx, p.MG, importitems.Item{
+	for i, m := range metas {
+		item := importitems.Item{
 			ImportRecordID: importRecordID,
 			ModelType:      modelType,
 			ModelID:        m.id,
 			Payload:        mustJSON(m.data),
 			Status:         "done",
-			Errors:         errText,
-		}); mErr != nil {
-			log.Printf("[PROC][actions][MONGO][ERR] id=%s status=done err=%v", m.id, mErr)
+			Errors:         strings.Join(m.warnings, "; "),
+		}
+		if rowErrs != nil && rowErrs[i] != nil {
+			item.Status = "failed"
+			item.Errors = rowErrs[i].Error()
+		} else {
+			inserted++
+		}
+
+		if bulk {
+			items = append(items, item)
+			continue
+		}
+		if res, mErr := importitems.InsertItem(ctx, p.MG, item); mErr != nil {
+			log.Printf("[PROC][actions][MONGO][ERR] id=%s status=%s err=%v", m.id, item.Status, mErr)
 		} else {
-			log.Printf("[PROC][actions][MONGO][OK] id=%s status=done inserted_id=%v", m.id, res.InsertedID)
+			log.Printf("[PROC][actions][MONGO][OK] id=%s status=%s inserted_id=%v", m.id, item.Status, res.InsertedID)
 		}
-		inserted++
 	}
 
-	log.Printf("[PROC][actions][DONE] total=%d inserted=%d", len(actions), inserted)
+	if err := importitems.InsertItems(ctx, p.MG, items); err != nil {
+		log.Printf("[PROC][actions][MONGO][ERR] items=%d err=%v", len(items), err)
+	}
+
+	log.Printf("[PROC][actions][DONE] total=%d inserted=%d bulk=%t", len(actions), inserted, bulk)
 
 	if err := importitems.UpdateImportRecordStatusDone(ctx, p.MG, importRecordID); err != nil {
 		log.Printf("[PROC][actions][ERR] error change status: %v", err)
@@ -184,3 +243,106 @@ func (p *ActionsProcessor) ProcessBatch(ctx context.Context, batch []map[string]
 
 	return nil
 }
+
+// applyStatusTransitions проверяет смену статуса долга каждым действием
+// в порядке строк файла относительно текущих статусов current. Действия
+// с запрещённым переходом отбрасываются через reject. Возвращает оставшиеся
+// действия, действия-аудит смены статуса и итоговые статусы долгов.
+func (p *ActionsProcessor) applyStatusTransitions(
+	ctx context.Context,
+	current map[string]*int64,
+	actions []models.Action,
+	metas []actionMeta,
+	reject func(actionMeta, string),
+) ([]models.Action, []actionMeta, []models.Action, map[string]int64) {
+	keptActions := actions[:0]
+	keptMetas := metas[:0]
+	var audit []models.Action
+	newStatuses := make(map[string]int64)
+
+	for i, a := range actions {
+		if a.DebtStatusID == nil {
+			keptActions = append(keptActions, a)
+			keptMetas = append(keptMetas, metas[i])
+			continue
+		}
+
+		debtID, toID := *a.DebtID, *a.DebtStatusID
+		fromID := current[debtID]
+		if fromID == nil || *fromID != toID {
+			from, to, err := statusTransition(ctx, p.DebtStatusesRepo, p.Transitions, fromID, toID)
+			if err != nil {
+				reject(metas[i], err.Error())
+				continue
+			}
+			audit = append(audit, statuses.ChangeAction(debtID, toID, from, to, p.Type()))
+			current[debtID] = &toID
+			newStatuses[debtID] = toID
+		}
+
+		keptActions = append(keptActions, a)
+		keptMetas = append(keptMetas, metas[i])
+	}
+
+	return keptActions, keptMetas, audit, newStatuses
+}
+
+// insertWithStatuses пишет действия. Если действия меняют статус долга,
+// статусы этих долгов блокируются в транзакции вставки, переходы проверяются
+// по заблокированным значениям, и действия, аудит и новые статусы пишутся
+// той же транзакцией — параллельные батчи не проверяют переход по устаревшему
+// статусу. Возвращает оставшиеся действия и их строки; с bulk — ошибку
+// вставки по каждому действию (nil — вставлено), без bulk nil — вставлены все.
+func (p *ActionsProcessor) insertWithStatuses(
+	ctx context.Context,
+	actions []models.Action,
+	metas []actionMeta,
+	reject func(actionMeta, string),
+	bulk bool,
+) ([]models.Action, []actionMeta, []error, error) {
+	var debtIDs []string
+	for _, a := range actions {
+		if a.DebtStatusID != nil {
+			debtIDs = append(debtIDs, *a.DebtID)
+		}
+	}
+
+	if len(debtIDs) == 0 {
+		if bulk {
+			rowErrs, err := p.ActionsRepo.CopyActions(ctx, actions)
+			return actions, metas, rowErrs, err
+		}
+		return actions, metas, nil, p.ActionsRepo.InsertActions(ctx, actions)
+	}
+
+	tx, err := p.PG.Pool.Begin(ctx)
+	if err != nil {
+		return actions, metas, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	current, err := p.DebtsRepo.LockStatusIDsTx(ctx, tx, debtIDs)
+	if err != nil {
+		return actions, metas, nil, fmt.Errorf("lock debt statuses: %w", err)
+	}
+
+	actions, metas, audit, newStatuses := p.applyStatusTransitions(ctx, current, actions, metas, reject)
+	if len(actions) == 0 {
+		return actions, metas, nil, nil
+	}
+
+	rows := append(actions, audit...)
+	var rowErrs []error
+	if bulk {
+		rowErrs, err = p.ActionsRepo.CopyActionsTx(ctx, tx, rows)
+	} else {
+		err = p.ActionsRepo.InsertActionsTx(ctx, tx, rows)
+	}
+	if err != nil {
+		return actions, metas, nil, err
+	}
+	if err := p.DebtsRepo.SetStatusesTx(ctx, tx, newStatuses); err != nil {
+		return actions, metas, nil, err
+	}
+	return actions, metas, rowErrs, tx.Commit(ctx)
+}
@@ -0,0 +1,142 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"debtster_import/internal/ports"
+	"debtster_import/internal/repository/database"
+	importitems "debtster_import/internal/repository/imports"
+
+	"github.com/google/uuid"
+)
+
+// Типы адресов, те же id что и в import_debtors (reg_address/fact_address/work_address).
+var addressTypeAliases = map[string]int{
+	"reg": 1, "registration": 1, "регистрация": 1, "прописка": 1,
+	"fact": 2, "actual": 2, "фактический": 2,
+	"work": 3, "рабочий": 3,
+}
+
+// AddressesProcessor — адреса должника без пересылки всей строки import_debtors.
+// Колонки: iin | debt_number, address, address_type, operation (add, replace_type, deactivate).
+type AddressesProcessor struct {
+	*BaseProcessor
+
+	DebtorsRepo   *database.DebtorRepo
+	DebtsRepo     *database.DebtsRepo
+	AddressesRepo *database.AddressesRepo
+
+	// AddressTypesRepo — справочник address_types для типов, заданных названием.
+	AddressTypesRepo *database.ReferenceRepo
+}
+
+func (p AddressesProcessor) Type() string { return "import_addresses" }
+
+// OrderSensitive — батчи по одному: операции над адресами применяются в порядке файла.
+func (p AddressesProcessor) OrderSensitive() bool { return true }
+
+func (p *AddressesProcessor) ProcessBatch(ctx context.Context, batch []map[string]string) error {
+	if err := CheckDeps(p); err != nil {
+		return err
+	}
+
+	var importRecordID string
+	if v := ctx.Value(ports.CtxImportRecordID); v != nil {
+		if s, ok := v.(string); ok {
+			importRecordID = strings.TrimSpace(s)
+		}
+	}
+
+	modelType := importitems.PHPModelMap[importitems.ModelTypeAddresses]
+
+	log.Printf("[PROC][addresses][START] rows=%d import_record_id=%s", len(batch), importRecordID)
+
+	lookup := newDebtorLookup(p.DebtorsRepo, p.DebtsRepo)
+	if err := lookup.prefetch(ctx, batch); err != nil {
+		return err
+	}
+	success, failed := 0, 0
+
+	for i, m := range batch {
+		modelID := uuid.NewString()
+		v := func(key string) string { return strings.TrimSpace(m[key]) }
+
+		fail := func(msg string) {
+			failed++
+			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+				ImportRecordID: importRecordID,
+				ModelType:      modelType,
+				ModelID:        modelID,
+				Payload:        m,
+				Errors:         msg,
+			})
+		}
+
+		op, ok := parseOperation(v("operation"))
+		if !ok {
+			fail("unknown operation: " + v("operation"))
+			continue
+		}
+
+		typeID, typeErr := resolveTypeID(ctx, v("address_type"), addressTypeAliases, 1, p.AddressTypesRepo)
+		if typeErr != "" {
+			fail("address_type: " + typeErr)
+			continue
+		}
+
+		address := v("address")
+		if address == "" && op != opDeactivate {
+			fail("missing address")
+			continue
+		}
+
+		debtorID, errMsg := lookup.resolve(ctx, m)
+		if errMsg != "" {
+			fail(errMsg)
+			continue
+		}
+
+		var summary string
+		var err error
+		switch op {
+		case opAdd:
+			var added bool
+			added, err = p.AddressesRepo.AddAddress(ctx, debtorSubjectType, debtorID, address, typeID)
+			summary = fmt.Sprintf("added=%t", added)
+		case opReplaceType:
+			var removed int
+			removed, err = p.AddressesRepo.ReplaceTypeAddress(ctx, debtorSubjectType, debtorID, address, typeID)
+			summary = fmt.Sprintf("deactivated=%d", removed)
+		case opDeactivate:
+			var removed int
+			removed, err = p.AddressesRepo.DeactivateAddresses(ctx, debtorSubjectType, debtorID, address, typeID)
+			summary = fmt.Sprintf("deactivated=%d", removed)
+		}
+		if err != nil {
+			log.Printf("[PROC][addresses][ERR] row=%d op=%s err=%v", i, op, err)
+			fail(err.Error())
+			continue
+		}
+
+		success++
+		importitems.LogMongo(ctx, p.MG, importitems.LogParams{
+			ImportRecordID: importRecordID,
+			ModelType:      modelType,
+			ModelID:        debtorID,
+			Payload:        m,
+			Status:         "done",
+			Errors:         op + ": " + summary,
+		})
+	}
+
+	log.Printf("[PROC][addresses][DONE] total=%d success=%d failed=%d", len(batch), success, failed)
+
+	if err := importitems.UpdateImportRecordStatusDone(ctx, p.MG, importRecordID); err != nil {
+		log.Printf("[PROC][addresses][ERR] update import_record status: %v", err)
+	}
+
+	return nil
+}
@@ -5,11 +5,14 @@ import (
 	"debtster_import/internal/models"
 	"debtster_import/internal/ports"
 	"errors"
+	"fmt"
 	"log"
 	"strings"
 
 	"debtster_import/internal/repository/database"
 	importitems "debtster_import/internal/repository/imports"
+	"debtster_import/internal/services/agreements"
+	"debtster_import/internal/validation"
 
 	"github.com/google/uuid"
 )
@@ -19,10 +22,17 @@ type AgreementsProcessor struct {
 	AgreementsRepo *database.AgreementRepo
 	DebtsRepo      *database.DebtsRepo
 	UserRepo       *database.UserRepo
+
+	// AgreementTypesRepo — справочник agreement_types. Неизвестный тип
+	// создаётся, а с опцией strict_references строка отклоняется.
+	AgreementTypesRepo *database.ReferenceRepo
 }
 
 func (p AgreementsProcessor) Type() string { return "import_agreements" }
 
+// OrderSensitive — батчи по одному: соглашение ищется по долгу и номеру и создаётся, если не найдено.
+func (p AgreementsProcessor) OrderSensitive() bool { return true }
+
 func (p *AgreementsProcessor) ProcessBatch(ctx context.Context, batch []map[string]string) error {
 	if err := CheckDeps(p); err != nil {
 		return err
@@ -35,19 +45,27 @@ func (p *AgreementsProcessor) ProcessBatch(ctx context.Context, batch []map[stri
 		}
 	}
 
-	log.Printf("[PROC][agreements][START] rows=%d import_record_id=%s", len(batch), importRecordID)
+	strict := strictReferences(ctx)
 
-	typesTable := "agreement_types"
-	typeIDCache := make(map[string]*int64)
+	log.Printf("[PROC][agreements][START] rows=%d import_record_id=%s strict_references=%t", len(batch), importRecordID, strict)
 
 	modelType := importitems.PHPModelByTable(p.AgreementsRepo.GetTableName())
 
+	debtIDs, err := p.DebtsRepo.ResolveDebtIDs(ctx, columnValues(batch, "debt_number"))
+	if err != nil {
+		return fmt.Errorf("resolve debts: %w", err)
+	}
+	userIDs, err := p.UserRepo.ResolveUserIDs(ctx, columnValues(batch, "username"))
+	if err != nil {
+		return fmt.Errorf("resolve users: %w", err)
+	}
+
 	success, failed := 0, 0
 
 	for i, m := range batch {
 		modelID := uuid.NewString()
 
-		debtNumber := strings.TrimSpace(m["debt_number"])
+		debtNumber := validation.NormalizeDebtNumber(m["debt_number"])
 		if debtNumber == "" {
 			failed++
 			_, _ = importitems.InsertItem(ctx, p.MG, importitems.Item{
@@ -61,13 +79,10 @@ func (p *AgreementsProcessor) ProcessBatch(ctx context.Context, batch []map[stri
 			continue
 		}
 
-		debtUUID, err := p.DebtsRepo.GetIDByNumber(ctx, debtNumber)
-		if err != nil || debtUUID == nil {
+		debtID, ok := debtIDs[debtNumber]
+		if !ok {
 			failed++
 			msg := "debt not found: " + debtNumber
-			if err != nil {
-				msg += " (" + err.Error() + ")"
-			}
 			_, _ = importitems.InsertItem(ctx, p.MG, importitems.Item{
 				ImportRecordID: importRecordID,
 				ModelType:      modelType,
@@ -85,8 +100,8 @@ func (p *AgreementsProcessor) ProcessBatch(ctx context.Context, batch []map[stri
 		if un := strings.TrimSpace(m["username"]); un == "" {
 			warnings = append(warnings, "missing username -> user_id=NULL")
 		} else {
-			if uid, err := p.UserRepo.GetUserBigint(ctx, un); err == nil && uid != nil {
-				userID = uid
+			if uid, ok := userIDs[un]; ok {
+				userID = &uid
 			} else {
 				warnings = append(warnings, "username not found: "+un+" -> user_id=NULL")
 			}
@@ -94,10 +109,22 @@ func (p *AgreementsProcessor) ProcessBatch(ctx context.Context, batch []map[stri
 
 		var agreementTypeID *int64
 		if tname := strings.TrimSpace(m["agreement_type"]); tname != "" {
-			if tid, err := p.getOrCreateAgreementType(ctx, typesTable, tname, typeIDCache); err == nil && tid != nil {
-				agreementTypeID = tid
-			} else if err != nil {
-				warnings = append(warnings, "agreement_type upsert failed: "+err.Error())
+			tid, warn, err := p.resolveAgreementType(ctx, tname, strict)
+			if err != nil {
+				failed++
+				_, _ = importitems.InsertItem(ctx, p.MG, importitems.Item{
+					ImportRecordID: importRecordID,
+					ModelType:      modelType,
+					ModelID:        modelID,
+					Payload:        mustJSON(m),
+					Status:         "failed",
+					Errors:         err.Error(),
+				})
+				continue
+			}
+			agreementTypeID = tid
+			if warn != "" {
+				warnings = append(warnings, warn)
 			}
 		} else {
 			warnings = append(warnings, "missing agreement_type -> agreement_type_id=NULL")
@@ -109,9 +136,10 @@ func (p *AgreementsProcessor) ProcessBatch(ctx context.Context, batch []map[stri
 		start := parseDateStrict(m["agreement_start_date"])
 		end := parseDateStrict(m["agreement_end_date"])
 
-		_, err = p.AgreementsRepo.UpdateOrCreate(ctx, models.Agreement{
+		agreement := models.Agreement{
+			Number:               nullIfEmpty(strings.TrimSpace(m["agreement_number"])),
 			AgreementTypeID:      agreementTypeID,
-			DebtID:               debtUUID,
+			DebtID:               &debtID,
 			UserID:               userID,
 			AmountDebt:           amountDebt,
 			MonthlyPaymentAmount: monthly,
@@ -119,7 +147,14 @@ func (p *AgreementsProcessor) ProcessBatch(ctx context.Context, batch []map[stri
 			StartDate:            start,
 			EndDate:              end,
 			CreatedAt:            nowPtr(),
-		})
+		}
+
+		schedule, err := agreements.BuildSchedule(agreement)
+		if err != nil {
+			warnings = append(warnings, err.Error()+" -> no schedule")
+		}
+
+		saved, res, err := p.AgreementsRepo.UpdateOrCreate(ctx, agreement, schedule)
 		if err != nil {
 			failed++
 			log.Printf("[PROC][agreements][ERR] row=%d debt=%s err=%v", i, debtNumber, err)
@@ -135,13 +170,21 @@ func (p *AgreementsProcessor) ProcessBatch(ctx context.Context, batch []map[stri
 		}
 
 		success++
+		if res.Superseded > 0 {
+			warnings = append(warnings, fmt.Sprintf("superseded %d previous agreement(s)", res.Superseded))
+		}
 		_, _ = importitems.InsertItem(ctx, p.MG, importitems.Item{
 			ImportRecordID: importRecordID,
 			ModelType:      modelType,
-			ModelID:        modelID,
+			ModelID:        saved.ID,
 			Payload:        mustJSON(m),
 			Status:         "done",
 			Errors:         strings.Join(warnings, "; "),
+			Details: map[string]any{
+				"created":      res.Created,
+				"superseded":   res.Superseded,
+				"installments": len(schedule),
+			},
 		})
 	}
 
@@ -152,23 +195,26 @@ func (p *AgreementsProcessor) ProcessBatch(ctx context.Context, batch []map[stri
 	return nil
 }
 
-func (p AgreementsProcessor) getOrCreateAgreementType(ctx context.Context, table, name string, cache map[string]*int64) (*int64, error) {
-	key := strings.ToLower(strings.TrimSpace(name))
-	if v, ok := cache[key]; ok {
-		return v, nil
-	}
-	var id int64
-	if err := p.PG.Pool.QueryRow(ctx, "SELECT id FROM "+table+" WHERE LOWER(name)=LOWER($1) LIMIT 1", name).Scan(&id); err == nil {
-		cache[key] = &id
-		return &id, nil
+// resolveAgreementType ищет тип соглашения по названию. Без strict
+// неизвестный тип создаётся (с предупреждением), со strict — ошибка.
+func (p AgreementsProcessor) resolveAgreementType(ctx context.Context, name string, strict bool) (*int64, string, error) {
+	if strict {
+		id, err := p.AgreementTypesRepo.Resolve(ctx, name)
+		if err != nil {
+			return nil, "", fmt.Errorf("agreement_type lookup error: %w", err)
+		}
+		if id == nil {
+			return nil, "", errors.New("agreement_type not found: " + name)
+		}
+		return id, "", nil
 	}
-	if err := p.PG.Pool.QueryRow(ctx, "INSERT INTO "+table+" (name,created_at) VALUES ($1,NOW()) RETURNING id", name).Scan(&id); err == nil {
-		cache[key] = &id
-		return &id, nil
+
+	id, created, err := p.AgreementTypesRepo.GetOrCreate(ctx, name)
+	if err != nil {
+		return nil, "agreement_type upsert failed: " + err.Error(), nil
 	}
-	if err := p.PG.Pool.QueryRow(ctx, "SELECT id FROM "+table+" WHERE LOWER(name)=LOWER($1) LIMIT 1", name).Scan(&id); err == nil {
-		cache[key] = &id
-		return &id, nil
+	if created {
+		return &id, "agreement_type created: " + name, nil
 	}
-	return nil, errors.New("agreement_type not found/created: " + name)
+	return &id, "", nil
 }
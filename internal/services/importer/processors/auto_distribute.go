@@ -0,0 +1,562 @@
+package processors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"debtster_import/internal/ports"
+	"debtster_import/internal/repository/database"
+	importitems "debtster_import/internal/repository/imports"
+	"debtster_import/internal/validation"
+)
+
+const (
+	strategyRoundRobin    = "round_robin"
+	strategyBalanceAmount = "balance_amount"
+	strategyPlan          = "plan"
+
+	// autoDistributeChunk — сколько назначений применяется одной транзакцией.
+	autoDistributeChunk = 1000
+)
+
+// AutoDistributeProcessor распределяет набор долгов по пулу пользователей.
+//
+// Долги: колонка debt_number файла или, если её нет, фильтр из опций
+// filial / product_name / status. Пул: пользователи команды app с ролями из
+// опции roles и/или перечисленные в опции usernames и колонке username.
+// Стратегия (опция strategy): round_robin, balance_amount (выравнивание
+// суммы портфеля) или plan (пропорционально user_plans.amount).
+//
+// Без опции commit результат — только предпросмотр в import_record_items.
+// Распределение считается по всему файлу, поэтому выполняется в Finish.
+type AutoDistributeProcessor struct {
+	*BaseProcessor
+	Distributor      *DistributionDebtsProcessor
+	DebtStatusesRepo *database.DebtStatusesRepo
+
+	mu      sync.Mutex
+	pending map[string]*autoDistributeInput
+}
+
+type autoDistributeInput struct {
+	numbers   []string
+	usernames []string
+	seen      map[string]bool
+}
+
+type distDebt struct {
+	id         string
+	number     string
+	amount     float64
+	prevUserID *int64
+}
+
+type distUser struct {
+	id       int64
+	username string
+	roleID   int64
+	weight   float64 // plan: целевая сумма из user_plans
+	load     float64 // текущая сумма портфеля
+	assigned int
+	amount   float64 // сумма распределённых в этом импорте долгов
+}
+
+func (p *AutoDistributeProcessor) Type() string { return "auto_distribute" }
+
+// OrderSensitive — батчи по одному: долги копятся в порядке файла до Finish.
+func (p *AutoDistributeProcessor) OrderSensitive() bool { return true }
+
+func (p *AutoDistributeProcessor) ProcessBatch(ctx context.Context, batch []map[string]string) error {
+	if err := CheckDeps(p); err != nil {
+		return err
+	}
+
+	importRecordID, _ := ctx.Value(ports.CtxImportRecordID).(string)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pending == nil {
+		p.pending = make(map[string]*autoDistributeInput)
+	}
+	in := p.pending[importRecordID]
+	if in == nil {
+		in = &autoDistributeInput{seen: make(map[string]bool)}
+		p.pending[importRecordID] = in
+	}
+
+	for _, m := range batch {
+		if n := validation.NormalizeDebtNumber(m["debt_number"]); n != "" && !in.seen[n] {
+			in.seen[n] = true
+			in.numbers = append(in.numbers, n)
+		}
+		if u := strings.TrimSpace(m["username"]); u != "" {
+			in.usernames = append(in.usernames, u)
+		}
+	}
+	return nil
+}
+
+func (p *AutoDistributeProcessor) Finish(ctx context.Context, readErr error) error {
+	importRecordID, _ := ctx.Value(ports.CtxImportRecordID).(string)
+
+	p.mu.Lock()
+	in := p.pending[importRecordID]
+	delete(p.pending, importRecordID)
+	p.mu.Unlock()
+
+	if readErr != nil {
+		return nil
+	}
+	if in == nil {
+		in = &autoDistributeInput{}
+	}
+
+	strategy := ports.ImportOption(ctx, "strategy")
+	if strategy == "" {
+		strategy = strategyRoundRobin
+	}
+	commit := ports.ImportFlag(ctx, "commit")
+	modelType := p.Type()
+
+	log.Printf("[PROC][auto_distribute][START] import_record_id=%s debts_from_file=%d strategy=%s commit=%v",
+		importRecordID, len(in.numbers), strategy, commit)
+
+	appTeamID, err := p.Distributor.appTeamID(ctx)
+	if err != nil {
+		return err
+	}
+
+	// ---------------------------------------------------------------------
+	// 1. Набор долгов
+	// ---------------------------------------------------------------------
+	debts, missing, err := p.loadDebts(ctx, in.numbers)
+	if err != nil {
+		return err
+	}
+	for _, n := range missing {
+		importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+			ImportRecordID: importRecordID,
+			ModelType:      modelType,
+			Payload:        map[string]string{"debt_number": n},
+			Errors:         "debt not found: " + n,
+		})
+	}
+	if len(debts) == 0 {
+		return errors.New("auto_distribute: no debts to distribute")
+	}
+
+	// ---------------------------------------------------------------------
+	// 2. Пул пользователей
+	// ---------------------------------------------------------------------
+	usernames := append(splitOption(ports.ImportOption(ctx, "usernames")), in.usernames...)
+	users, err := p.loadUsers(ctx, appTeamID, splitOption(ports.ImportOption(ctx, "roles")), usernames)
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return errors.New("auto_distribute: empty user pool (set roles or usernames)")
+	}
+
+	// ---------------------------------------------------------------------
+	// 3. Стратегия
+	// ---------------------------------------------------------------------
+	var plan []*distUser
+	switch strategy {
+	case strategyRoundRobin:
+		plan = distributeRoundRobin(debts, users)
+	case strategyBalanceAmount:
+		if err := p.loadPortfolio(ctx, users, debts); err != nil {
+			return err
+		}
+		plan = distributeWeighted(debts, users, func(u *distUser) float64 { return 1 })
+	case strategyPlan:
+		if err := p.loadPortfolio(ctx, users, debts); err != nil {
+			return err
+		}
+		if err := p.loadPlans(ctx, users); err != nil {
+			return err
+		}
+		plan = distributeWeighted(debts, users, func(u *distUser) float64 { return u.weight })
+	default:
+		return fmt.Errorf("auto_distribute: unknown strategy %q", strategy)
+	}
+
+	// ---------------------------------------------------------------------
+	// 4. Предпросмотр или применение (порциями через applyAssignments)
+	// ---------------------------------------------------------------------
+	type planned struct {
+		debt    distDebt
+		user    *distUser
+		details map[string]any
+	}
+
+	assigned, failed := 0, 0
+	reason := modelType + ":" + strategy
+
+	logResult := func(it planned, applyErr error) {
+		payload := map[string]string{"debt_number": it.debt.number, "debt_username": it.user.username}
+		if applyErr != nil {
+			failed++
+			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+				ImportRecordID: importRecordID,
+				ModelType:      modelType,
+				ModelID:        it.debt.id,
+				Payload:        payload,
+				Errors:         applyErr.Error(),
+				Details:        it.details,
+			})
+			return
+		}
+		status := "preview"
+		if commit {
+			status = "done"
+		}
+		assigned++
+		importitems.LogMongo(ctx, p.MG, importitems.LogParams{
+			ImportRecordID: importRecordID,
+			ModelType:      modelType,
+			ModelID:        it.debt.id,
+			Payload:        payload,
+			Status:         status,
+			Details:        it.details,
+		})
+	}
+
+	chunk := make([]planned, 0, autoDistributeChunk)
+	flush := func() {
+		if len(chunk) == 0 {
+			return
+		}
+		var applyErr error
+		if commit {
+			as := make([]assignment, len(chunk))
+			for i, it := range chunk {
+				as[i] = assignment{debtID: it.debt.id, userID: it.user.id, roleID: it.user.roleID, reason: reason}
+			}
+			applyErr = p.Distributor.applyAssignments(ctx, as, importRecordID)
+		}
+		for _, it := range chunk {
+			logResult(it, applyErr)
+		}
+		chunk = chunk[:0]
+	}
+
+	for i, d := range debts {
+		u := plan[i]
+		details := map[string]any{
+			"debt_number": d.number,
+			"amount":      d.amount,
+			"preview":     !commit,
+		}
+		if d.prevUserID != nil {
+			details["previous_user_id"] = *d.prevUserID
+		}
+		if u == nil {
+			failed++
+			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+				ImportRecordID: importRecordID,
+				ModelType:      modelType,
+				ModelID:        d.id,
+				Payload:        map[string]string{"debt_number": d.number},
+				Errors:         "no user with positive plan in pool",
+				Details:        details,
+			})
+			continue
+		}
+		details["username"] = u.username
+
+		chunk = append(chunk, planned{debt: d, user: u, details: details})
+		if len(chunk) >= autoDistributeChunk {
+			flush()
+		}
+	}
+	flush()
+
+	// Сводка по пользователям — одна запись на импорт.
+	summary := make([]map[string]any, 0, len(users))
+	for _, u := range users {
+		su := map[string]any{
+			"username": u.username,
+			"debts":    u.assigned,
+			"amount":   math.Round(u.amount*100) / 100,
+		}
+		if strategy != strategyRoundRobin {
+			su["portfolio"] = math.Round(u.load*100) / 100
+		}
+		if strategy == strategyPlan {
+			su["plan_amount"] = u.weight
+		}
+		summary = append(summary, su)
+	}
+	summaryStatus := "preview"
+	if commit {
+		summaryStatus = "done"
+	}
+	importitems.LogMongo(ctx, p.MG, importitems.LogParams{
+		ImportRecordID: importRecordID,
+		ModelType:      modelType,
+		ModelID:        "summary",
+		Status:         summaryStatus,
+		Details: map[string]any{
+			"strategy": strategy,
+			"commit":   commit,
+			"debts":    len(debts),
+			"assigned": assigned,
+			"failed":   failed,
+			"users":    summary,
+		},
+	})
+
+	log.Printf("[PROC][auto_distribute][DONE] debts=%d users=%d assigned=%d failed=%d commit=%v",
+		len(debts), len(users), assigned, failed, commit)
+
+	if err := importitems.UpdateImportRecordStatusDone(ctx, p.MG, importRecordID); err != nil {
+		log.Printf("[PROC][auto_distribute][ERR] error change status: %v", err)
+	}
+	return nil
+}
+
+// loadDebts загружает долги по номерам из файла, а если их нет — по фильтру
+// из опций. Результат отсортирован по номеру, чтобы предпросмотр и
+// применение давали одинаковое распределение.
+func (p *AutoDistributeProcessor) loadDebts(ctx context.Context, numbers []string) ([]distDebt, []string, error) {
+	const cols = `SELECT id::text, number, COALESCE(amount_actual_debt, 0)::float8, user_id FROM debts`
+
+	var (
+		query string
+		args  []any
+	)
+	if len(numbers) > 0 {
+		query = cols + ` WHERE number = ANY($1) ORDER BY number`
+		args = []any{numbers}
+	} else {
+		filial := ports.ImportOption(ctx, "filial")
+		product := ports.ImportOption(ctx, "product_name")
+		statusName := ports.ImportOption(ctx, "status")
+		if filial == "" && product == "" && statusName == "" {
+			return nil, nil, errors.New("auto_distribute: provide debt_number column or filial/product_name/status filter")
+		}
+
+		var statusID *int64
+		if statusName != "" {
+			id, err := p.DebtStatusesRepo.GetStatusBigint(ctx, statusName)
+			if err != nil || id == nil {
+				return nil, nil, fmt.Errorf("auto_distribute: status not found: %s", statusName)
+			}
+			statusID = id
+		}
+
+		query = cols + `
+			WHERE ($1 = '' OR filial = $1)
+			  AND ($2 = '' OR product_name = $2)
+			  AND ($3::bigint IS NULL OR status_id = $3)
+			ORDER BY number`
+		args = []any{filial, product, statusID}
+	}
+
+	rows, err := p.PG.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load debts: %w", err)
+	}
+	defer rows.Close()
+
+	var debts []distDebt
+	found := make(map[string]bool)
+	for rows.Next() {
+		var d distDebt
+		if err := rows.Scan(&d.id, &d.number, &d.amount, &d.prevUserID); err != nil {
+			return nil, nil, err
+		}
+		if found[d.number] {
+			continue
+		}
+		found[d.number] = true
+		debts = append(debts, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var missing []string
+	for _, n := range numbers {
+		if !found[n] {
+			missing = append(missing, n)
+		}
+	}
+	return debts, missing, nil
+}
+
+// loadUsers собирает пул: пользователи команды app с заданными ролями
+// или с заданными логинами. Роль берётся из команды app.
+func (p *AutoDistributeProcessor) loadUsers(ctx context.Context, appTeamID int64, roles, usernames []string) ([]*distUser, error) {
+	rows, err := p.PG.Pool.Query(ctx, `
+		SELECT DISTINCT ON (u.id) u.id, u.username, ru.role_id
+		FROM role_user ru
+		JOIN users u ON u.id = ru.user_id
+		JOIN roles r ON r.id = ru.role_id
+		WHERE ru.team_id = $1
+		  AND (r.name = ANY($2) OR u.username = ANY($3))
+		ORDER BY u.id, ru.role_id`,
+		appTeamID, roles, usernames,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("load user pool: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*distUser
+	for rows.Next() {
+		u := &distUser{}
+		if err := rows.Scan(&u.id, &u.username, &u.roleID); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].username < users[j].username })
+	return users, nil
+}
+
+// loadPortfolio — текущая сумма портфеля каждого пользователя без
+// распределяемых долгов.
+func (p *AutoDistributeProcessor) loadPortfolio(ctx context.Context, users []*distUser, debts []distDebt) error {
+	userIDs := make([]int64, len(users))
+	byID := make(map[int64]*distUser, len(users))
+	for i, u := range users {
+		userIDs[i] = u.id
+		byID[u.id] = u
+	}
+	debtIDs := make([]string, len(debts))
+	for i, d := range debts {
+		debtIDs[i] = d.id
+	}
+
+	rows, err := p.PG.Pool.Query(ctx, `
+		SELECT user_id, SUM(COALESCE(amount_actual_debt, 0))::float8
+		FROM debts
+		WHERE user_id = ANY($1) AND NOT (id = ANY($2::text[]::uuid[]))
+		GROUP BY user_id`,
+		userIDs, debtIDs,
+	)
+	if err != nil {
+		return fmt.Errorf("load portfolio: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var sum float64
+		if err := rows.Scan(&id, &sum); err != nil {
+			return err
+		}
+		if u := byID[id]; u != nil {
+			u.load = sum
+		}
+	}
+	return rows.Err()
+}
+
+// loadPlans — сумма действующего плана (user_plans) каждого пользователя.
+func (p *AutoDistributeProcessor) loadPlans(ctx context.Context, users []*distUser) error {
+	userIDs := make([]int64, len(users))
+	byID := make(map[int64]*distUser, len(users))
+	for i, u := range users {
+		userIDs[i] = u.id
+		byID[u.id] = u
+	}
+
+	rows, err := p.PG.Pool.Query(ctx, `
+		SELECT DISTINCT ON (user_id) user_id, COALESCE(amount, 0)::float8
+		FROM user_plans
+		WHERE user_id = ANY($1)
+		  AND (end_date IS NULL OR end_date >= CURRENT_DATE)
+		ORDER BY user_id, end_date DESC NULLS LAST`,
+		userIDs,
+	)
+	if err != nil {
+		return fmt.Errorf("load user plans: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var amount float64
+		if err := rows.Scan(&id, &amount); err != nil {
+			return err
+		}
+		if u := byID[id]; u != nil {
+			u.weight = amount
+		}
+	}
+	return rows.Err()
+}
+
+// distributeRoundRobin раздаёт долги по очереди.
+func distributeRoundRobin(debts []distDebt, users []*distUser) []*distUser {
+	plan := make([]*distUser, len(debts))
+	for i, d := range debts {
+		u := users[i%len(users)]
+		u.assigned++
+		u.amount += d.amount
+		u.load += d.amount
+		plan[i] = u
+	}
+	return plan
+}
+
+// distributeWeighted — жадное выравнивание: крупные долги первыми, каждый
+// достаётся пользователю с наименьшим отношением портфеля к весу.
+// Пользователи с нулевым весом долги не получают.
+func distributeWeighted(debts []distDebt, users []*distUser, weight func(*distUser) float64) []*distUser {
+	order := make([]int, len(debts))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return debts[order[a]].amount > debts[order[b]].amount
+	})
+
+	plan := make([]*distUser, len(debts))
+	for _, i := range order {
+		d := debts[i]
+		var best *distUser
+		bestScore := math.Inf(1)
+		for _, u := range users {
+			w := weight(u)
+			if w <= 0 {
+				continue
+			}
+			if score := (u.load + d.amount) / w; score < bestScore {
+				best, bestScore = u, score
+			}
+		}
+		if best == nil {
+			continue
+		}
+		best.assigned++
+		best.amount += d.amount
+		best.load += d.amount
+		plan[i] = best
+	}
+	return plan
+}
+
+func splitOption(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
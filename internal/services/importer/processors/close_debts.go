@@ -0,0 +1,478 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"debtster_import/internal/models"
+	"debtster_import/internal/ports"
+	"debtster_import/internal/repository/database"
+	importitems "debtster_import/internal/repository/imports"
+	"debtster_import/internal/services/statuses"
+	"debtster_import/internal/validation"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// defaultCloseStatus — shortname статуса закрытого долга, если не задан
+	// ни колонкой debt_status, ни опцией status.
+	defaultCloseStatus = "closed"
+
+	// actionDebtClosed — тип действия, создаваемого при закрытии долга.
+	actionDebtClosed = "debt_closed"
+)
+
+// closureStage — закрытия батча для set-based запросов applyClosures.
+var closureStage = database.Stage{
+	Table: "tmp_closure",
+	Columns: []database.StageColumn{
+		{Name: "debt_id", Type: "text NOT NULL"},
+		{Name: "status_id", Type: "bigint NOT NULL"},
+		{Name: "closed_at", Type: "date NOT NULL"},
+		{Name: "reason", Type: "text NOT NULL"},
+		{Name: "team_name", Type: "text NOT NULL"},
+	},
+}
+
+// Причины закрытия долга (debts.close_reason).
+const (
+	closeReasonPaid       = "paid"
+	closeReasonSoldBack   = "sold_back"
+	closeReasonWrittenOff = "written_off"
+	closeReasonRecalled   = "recalled"
+)
+
+var closeReasonAliases = map[string]string{
+	"paid": closeReasonPaid, "погашен": closeReasonPaid, "оплачен": closeReasonPaid,
+	"sold_back": closeReasonSoldBack, "buyback": closeReasonSoldBack, "обратный выкуп": closeReasonSoldBack, "выкуп": closeReasonSoldBack,
+	"written_off": closeReasonWrittenOff, "write_off": closeReasonWrittenOff, "списан": closeReasonWrittenOff, "списание": closeReasonWrittenOff,
+	"recalled": closeReasonRecalled, "recall": closeReasonRecalled, "отозван": closeReasonRecalled, "отзыв": closeReasonRecalled,
+}
+
+var closeReasonTitles = map[string]string{
+	closeReasonPaid:       "погашен",
+	closeReasonSoldBack:   "обратный выкуп кредитором",
+	closeReasonWrittenOff: "списан",
+	closeReasonRecalled:   "отозван банком",
+}
+
+// CloseDebtsProcessor — массовое закрытие долгов: статус, дата и причина
+// закрытия, снятие ответственного (обратное distribution_debts, с очисткой
+// role_user команды debt/<id>), отмена действующих соглашений и действие
+// debt_closed по каждому долгу.
+//
+// Колонки: debt_number, close_reason, close_date, debt_status, comment, username.
+// Опции: status — shortname статуса по умолчанию, reason — причина по умолчанию.
+type CloseDebtsProcessor struct {
+	*BaseProcessor
+
+	DebtsRepo        *database.DebtsRepo
+	DebtStatusesRepo *database.DebtStatusesRepo
+	ActionsRepo      *database.ActionRepo
+	UserRepo         *database.UserRepo
+
+	// Transitions — допустимые переходы статусов; nil — без ограничений.
+	Transitions *statuses.Graph
+}
+
+// closure — закрытие одного долга.
+type closure struct {
+	debtID   string
+	statusID int64
+	closedAt time.Time
+	reason   string
+	action   models.Action
+}
+
+// closureResult — что изменилось у долга при закрытии.
+type closureResult struct {
+	unassignedUserID    *int64
+	agreementsCancelled int
+}
+
+func (p CloseDebtsProcessor) Type() string { return "close_debts" }
+
+// OrderSensitive — батчи по одному: при повторе долга побеждает последняя строка файла.
+func (p CloseDebtsProcessor) OrderSensitive() bool { return true }
+
+func (p *CloseDebtsProcessor) ProcessBatch(ctx context.Context, batch []map[string]string) error {
+	if err := CheckDeps(p); err != nil {
+		return err
+	}
+
+	var importRecordID string
+	if v := ctx.Value(ports.CtxImportRecordID); v != nil {
+		if s, ok := v.(string); ok {
+			importRecordID = strings.TrimSpace(s)
+		}
+	}
+
+	modelType := "debts"
+	defaultStatus := firstNonEmpty(ports.ImportOption(ctx, "status"), defaultCloseStatus)
+	defaultReason := ports.ImportOption(ctx, "reason")
+
+	log.Printf("[PROC][close_debts][START] rows=%d import_record_id=%s status=%s", len(batch), importRecordID, defaultStatus)
+
+	fail := func(id string, m map[string]string, msg string) {
+		importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+			ImportRecordID: importRecordID,
+			ModelType:      modelType,
+			ModelID:        id,
+			Payload:        m,
+			Errors:         msg,
+		})
+	}
+
+	// ---------------------------------------------------------------------
+	// 1. Разбор строк
+	// ---------------------------------------------------------------------
+	type row struct {
+		payload    map[string]string
+		debtNumber string
+		c          closure
+		statusName string
+	}
+
+	parsed := make([]row, 0, len(batch))
+	numbers := make([]string, 0, len(batch))
+	y, mo, d := time.Now().Date()
+	today := time.Date(y, mo, d, 0, 0, 0, 0, time.Local)
+
+	for _, m := range batch {
+		v := func(key string) string { return strings.TrimSpace(m[key]) }
+
+		r := row{payload: m, debtNumber: validation.NormalizeDebtNumber(v("debt_number"))}
+		if r.debtNumber == "" {
+			fail("", m, "missing debt_number")
+			continue
+		}
+
+		rawReason := firstNonEmpty(v("close_reason"), defaultReason)
+		reason, ok := closeReasonAliases[strings.ToLower(rawReason)]
+		if !ok {
+			if rawReason == "" {
+				fail("", m, "missing close_reason")
+			} else {
+				fail("", m, "unknown close_reason: "+rawReason)
+			}
+			continue
+		}
+		r.c.reason = reason
+
+		r.c.closedAt = today
+		if raw := v("close_date"); raw != "" {
+			d := parseDateStrict(raw)
+			if d == nil {
+				fail("", m, "bad close_date: "+raw)
+				continue
+			}
+			r.c.closedAt = *d
+		}
+
+		r.statusName = firstNonEmpty(v("debt_status"), defaultStatus)
+		sid, err := p.DebtStatusesRepo.GetStatusBigint(ctx, r.statusName)
+		if err != nil || sid == nil {
+			fail("", m, "status not found: "+r.statusName)
+			continue
+		}
+		r.c.statusID = *sid
+
+		parsed = append(parsed, r)
+		numbers = append(numbers, r.debtNumber)
+	}
+
+	if len(parsed) == 0 {
+		log.Printf("[PROC][close_debts][DONE] no valid rows")
+		return nil
+	}
+
+	// ---------------------------------------------------------------------
+	// 2. Долги и текущие статусы; при повторе долга побеждает последняя строка
+	// ---------------------------------------------------------------------
+	debtIDs, err := p.DebtsRepo.ResolveDebtIDs(ctx, numbers)
+	if err != nil {
+		return fmt.Errorf("debt lookup error: %w", err)
+	}
+	if p.UserRepo != nil {
+		// логины авторов действий — в кэш репозитория для closeAction
+		if _, err := p.UserRepo.ResolveUserIDs(ctx, columnValues(batch, "username")); err != nil {
+			return fmt.Errorf("user lookup error: %w", err)
+		}
+	}
+
+	found := make([]string, 0, len(debtIDs))
+	for _, id := range debtIDs {
+		found = append(found, id)
+	}
+	current, err := p.DebtsRepo.GetClosureStates(ctx, found)
+	if err != nil {
+		return fmt.Errorf("load debt statuses: %w", err)
+	}
+
+	type ready struct {
+		row
+		from string
+		// unchanged — долг уже закрыт с тем же статусом, причиной и датой.
+		unchanged bool
+	}
+
+	readyRows := make([]ready, 0, len(parsed))
+	lastByDebt := make(map[string]int)
+
+	for _, r := range parsed {
+		debtID, ok := debtIDs[r.debtNumber]
+		if !ok {
+			fail("", r.payload, "debt not found: "+r.debtNumber)
+			continue
+		}
+		r.c.debtID = debtID
+
+		// повторная загрузка уже закрытого долга: ни второго действия
+		// debt_closed, ни перезаписи closed_at
+		state := current[debtID]
+		unchanged := state.Same(r.c.statusID, r.c.reason, r.c.closedAt)
+		var from string
+		if !unchanged {
+			f, to, err := statusTransition(ctx, p.DebtStatusesRepo, p.Transitions, state.StatusID, r.c.statusID)
+			if err != nil {
+				fail(debtID, r.payload, err.Error())
+				continue
+			}
+			from = f
+			r.c.action = p.closeAction(ctx, r.payload, r.c, from, to)
+		}
+
+		if prev, ok := lastByDebt[debtID]; ok {
+			fail(debtID, readyRows[prev].payload, "superseded by a later row for debt "+r.debtNumber)
+			readyRows[prev].c.debtID = ""
+		}
+		lastByDebt[debtID] = len(readyRows)
+		readyRows = append(readyRows, ready{row: r, from: from, unchanged: unchanged})
+	}
+
+	closures := make([]closure, 0, len(readyRows))
+	for _, r := range readyRows {
+		if r.c.debtID != "" && !r.unchanged {
+			closures = append(closures, r.c)
+		}
+	}
+
+	// ---------------------------------------------------------------------
+	// 3. Закрываем батч набором запросов
+	// ---------------------------------------------------------------------
+	var (
+		results  map[string]closureResult
+		applyErr error
+	)
+	if len(closures) > 0 {
+		results, applyErr = p.applyClosures(ctx, closures, importRecordID)
+		if applyErr != nil {
+			log.Printf("[PROC][close_debts][ERR] apply failed: %v", applyErr)
+		}
+	}
+
+	closed, unchanged := 0, 0
+	for _, r := range readyRows {
+		if r.c.debtID == "" {
+			continue
+		}
+		if r.unchanged {
+			unchanged++
+			importitems.LogMongo(ctx, p.MG, importitems.LogParams{
+				ImportRecordID: importRecordID,
+				ModelType:      modelType,
+				ModelID:        r.c.debtID,
+				Payload:        r.payload,
+				Status:         "done",
+				Errors:         "already closed",
+				Details: map[string]any{
+					"status_to":    r.statusName,
+					"close_reason": r.c.reason,
+					"closed_at":    r.c.closedAt.Format("2006-01-02"),
+				},
+			})
+			continue
+		}
+		if applyErr != nil {
+			fail(r.c.debtID, r.payload, applyErr.Error())
+			continue
+		}
+
+		closed++
+		res := results[r.c.debtID]
+		importitems.LogMongo(ctx, p.MG, importitems.LogParams{
+			ImportRecordID: importRecordID,
+			ModelType:      modelType,
+			ModelID:        r.c.debtID,
+			Payload:        r.payload,
+			Status:         "done",
+			Details: map[string]any{
+				"status_from":          r.from,
+				"status_to":            r.statusName,
+				"close_reason":         r.c.reason,
+				"closed_at":            r.c.closedAt.Format("2006-01-02"),
+				"unassigned_user_id":   res.unassignedUserID,
+				"agreements_cancelled": res.agreementsCancelled,
+			},
+		})
+	}
+
+	log.Printf("[PROC][close_debts][DONE] total=%d closed=%d unchanged=%d", len(batch), closed, unchanged)
+
+	if err := importitems.UpdateImportRecordStatusDone(ctx, p.MG, importRecordID); err != nil {
+		log.Printf("[PROC][close_debts][ERR] error change status: %v", err)
+	}
+	return nil
+}
+
+// closeAction — действие debt_closed: причина, дата и смена статуса.
+func (p *CloseDebtsProcessor) closeAction(ctx context.Context, m map[string]string, c closure, from, to string) models.Action {
+	if from == "" {
+		from = "—"
+	}
+	comment := fmt.Sprintf("Долг закрыт: %s с %s; статус %s → %s",
+		closeReasonTitles[c.reason], c.closedAt.Format("02.01.2006"), from, to)
+	if extra := strings.TrimSpace(m["comment"]); extra != "" {
+		comment += ". " + extra
+	}
+
+	var userID *int64
+	if un := strings.TrimSpace(m["username"]); un != "" && p.UserRepo != nil {
+		if uid, err := p.UserRepo.GetUserBigint(ctx, un); err == nil {
+			userID = uid
+		}
+	}
+
+	typ := actionDebtClosed
+	debtID, statusID := c.debtID, c.statusID
+	return models.Action{
+		ID:           uuid.NewString(),
+		DebtID:       &debtID,
+		UserID:       userID,
+		DebtStatusID: &statusID,
+		Type:         &typ,
+		Comment:      &comment,
+		CreatedAt:    nowPtr(),
+	}
+}
+
+// applyClosures закрывает долги в одной транзакции: закрытия копируются во
+// временную таблицу, затем набором запросов обновляются debts (статус, дата,
+// причина, снятие ответственного с записью истории назначений), удаляются
+// записи role_user команд debt/<id>, отменяются действующие соглашения и
+// пишутся действия. Долг в closures должен встречаться не более одного раза.
+func (p *CloseDebtsProcessor) applyClosures(ctx context.Context, closures []closure, importRecordID string) (map[string]closureResult, error) {
+	tx, err := p.PG.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	src := make([][]any, len(closures))
+	for i, c := range closures {
+		src[i] = []any{c.debtID, c.statusID, c.closedAt, c.reason, debtTeamPrefix + c.debtID}
+	}
+	if err := closureStage.Load(ctx, tx, src); err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]closureResult, len(closures))
+
+	// 1) UPDATE debts + история назначений для снятых ответственных
+	rows, err := tx.Query(ctx, `
+		WITH prev AS (
+		    SELECT d.id, d.user_id
+		    FROM debts d
+		    JOIN `+closureStage.Table+` t ON d.id = t.debt_id::uuid
+		    FOR UPDATE OF d
+		), upd AS (
+		    UPDATE debts d
+		    SET status_id    = t.status_id,
+		        closed_at    = t.closed_at,
+		        close_reason = t.reason,
+		        user_id      = NULL,
+		        updated_at   = NOW()
+		    FROM `+closureStage.Table+` t, prev
+		    WHERE d.id = t.debt_id::uuid
+		      AND prev.id = d.id
+		    RETURNING d.id, prev.user_id AS previous_user_id, d.user_id AS new_user_id
+		), hist AS (
+		    `+database.RecordAssignmentSQL("$1", "$2")+`
+		    WHERE previous_user_id IS NOT NULL
+		)
+		SELECT id::text, previous_user_id FROM upd`,
+		importRecordID, p.Type(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("update debts: %w", err)
+	}
+	for rows.Next() {
+		var id string
+		var prevUser *int64
+		if err := rows.Scan(&id, &prevUser); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		results[id] = closureResult{unassignedUserID: prevUser}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("update debts: %w", err)
+	}
+
+	// 2) записи role_user команд debt/<id>
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM role_user ru
+		USING teams tm, `+closureStage.Table+` t
+		WHERE tm.name = t.team_name
+		  AND ru.team_id = tm.id`,
+	); err != nil {
+		return nil, fmt.Errorf("delete role_user: %w", err)
+	}
+
+	// 3) отмена действующих и нарушенных соглашений
+	rows, err = tx.Query(ctx, `
+		UPDATE agreements a
+		SET status = $1, updated_at = NOW()
+		FROM `+closureStage.Table+` t
+		WHERE a.debt_id = t.debt_id::uuid
+		  AND a.status = ANY($2::text[])
+		RETURNING a.debt_id::text`,
+		models.AgreementCancelled, []string{models.AgreementActive, models.AgreementBroken},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cancel agreements: %w", err)
+	}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		res := results[id]
+		res.agreementsCancelled++
+		results[id] = res
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cancel agreements: %w", err)
+	}
+
+	// 4) действия debt_closed
+	actions := make([]models.Action, len(closures))
+	for i, c := range closures {
+		actions[i] = c.action
+	}
+	if err := p.ActionsRepo.InsertActionsTx(ctx, tx, actions); err != nil {
+		return nil, fmt.Errorf("create actions: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
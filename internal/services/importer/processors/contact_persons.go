@@ -0,0 +1,175 @@
+package processors
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"debtster_import/internal/models"
+	"debtster_import/internal/ports"
+	"debtster_import/internal/repository/database"
+	importitems "debtster_import/internal/repository/imports"
+
+	"github.com/google/uuid"
+)
+
+const (
+	contactPhoneTypeID   = 1
+	contactAddressTypeID = 1
+)
+
+var contactPersonSubjectType = importitems.PHPModelMap[importitems.ModelTypeContactPersons]
+
+// ContactPersonsProcessor — одна строка = одно контактное лицо должника:
+// iin | debt_number, contact_full_name, contact_type (название), contact_phones, contact_address, contact_comment.
+type ContactPersonsProcessor struct {
+	*BaseProcessor
+
+	DebtorsRepo        *database.DebtorRepo
+	DebtsRepo          *database.DebtsRepo
+	ContactPersonsRepo *database.ContactPersonsRepo
+	PhonesRepo         *database.PhoneRepo
+	AddressesRepo      *database.AddressesRepo
+}
+
+func (p ContactPersonsProcessor) Type() string { return "import_contact_persons" }
+
+// OrderSensitive — батчи по одному: контактное лицо ищется по ФИО и создаётся, если не найдено.
+func (p ContactPersonsProcessor) OrderSensitive() bool { return true }
+
+func (p *ContactPersonsProcessor) ProcessBatch(ctx context.Context, batch []map[string]string) error {
+	if err := CheckDeps(p); err != nil {
+		return err
+	}
+
+	var importRecordID string
+	if v := ctx.Value(ports.CtxImportRecordID); v != nil {
+		if s, ok := v.(string); ok {
+			importRecordID = strings.TrimSpace(s)
+		}
+	}
+
+	modelType := contactPersonSubjectType
+
+	log.Printf("[PROC][contact_persons][START] rows=%d import_record_id=%s", len(batch), importRecordID)
+
+	lookup := newDebtorLookup(p.DebtorsRepo, p.DebtsRepo)
+	if err := lookup.prefetch(ctx, batch); err != nil {
+		return err
+	}
+	created, updated, failed := 0, 0, 0
+
+	for i, m := range batch {
+		modelID := uuid.NewString()
+		v := func(key string) string { return strings.TrimSpace(m[key]) }
+
+		fail := func(msg string) {
+			failed++
+			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+				ImportRecordID: importRecordID,
+				ModelType:      modelType,
+				ModelID:        modelID,
+				Payload:        m,
+				Errors:         msg,
+			})
+		}
+
+		fullName := v("contact_full_name")
+		if fullName == "" {
+			fail("missing contact_full_name")
+			continue
+		}
+
+		// ----------------------------------------------------
+		// 1. Должник по ИИН (или debt_number)
+		// ----------------------------------------------------
+		debtorID, errMsg := lookup.resolve(ctx, m)
+		if errMsg != "" {
+			fail(errMsg)
+			continue
+		}
+
+		// ----------------------------------------------------
+		// 2. Тип связи по названию
+		// ----------------------------------------------------
+		var warnings []string
+		var typeID *int64
+		if tname := v("contact_type"); tname != "" {
+			tid, err := p.ContactPersonsRepo.GetTypeIDByName(ctx, tname)
+			if err != nil {
+				fail("contact_type lookup error: " + err.Error())
+				continue
+			}
+			if tid == nil {
+				fail("contact_type not found: " + tname)
+				continue
+			}
+			typeID = tid
+		} else {
+			warnings = append(warnings, "missing contact_type -> type unchanged/default")
+		}
+
+		// ----------------------------------------------------
+		// 3. Контактное лицо (дедупликация по ФИО внутри должника)
+		// ----------------------------------------------------
+		contactID, isNew, err := p.ContactPersonsRepo.UpdateOrCreate(ctx, models.ContactPerson{
+			DebtorID: debtorID,
+			FullName: fullName,
+			TypeID:   typeID,
+			Comment:  v("contact_comment"),
+		})
+		if err != nil {
+			log.Printf("[PROC][contact_persons][ERR] row=%d debtor_id=%s err=%v", i, debtorID, err)
+			fail(err.Error())
+			continue
+		}
+
+		// ----------------------------------------------------
+		// 4. Телефоны и адрес
+		// ----------------------------------------------------
+		if raw := v("contact_phones"); raw != "" && p.PhonesRepo != nil {
+			phoneType := contactPhoneTypeID
+			res, err := p.PhonesRepo.AddPhones(ctx, models.Phone{
+				SubjectType: contactPersonSubjectType,
+				SubjectID:   contactID,
+				PhonesRaw:   raw,
+				TypeID:      &phoneType,
+				CreatedAt:   nowPtr(),
+			})
+			if err != nil {
+				warnings = append(warnings, "phones: "+err.Error())
+			}
+			for _, inv := range res.Invalid {
+				warnings = append(warnings, "phones: "+inv)
+			}
+		}
+
+		if addr := v("contact_address"); addr != "" && p.AddressesRepo != nil {
+			if err := p.AddressesRepo.SaveSubjectAddress(ctx, contactPersonSubjectType, contactID, addr, contactAddressTypeID); err != nil {
+				warnings = append(warnings, "address: "+err.Error())
+			}
+		}
+
+		if isNew {
+			created++
+		} else {
+			updated++
+		}
+		importitems.LogMongo(ctx, p.MG, importitems.LogParams{
+			ImportRecordID: importRecordID,
+			ModelType:      modelType,
+			ModelID:        contactID,
+			Payload:        m,
+			Status:         "done",
+			Errors:         strings.Join(warnings, "; "),
+		})
+	}
+
+	log.Printf("[PROC][contact_persons][DONE] total=%d created=%d updated=%d failed=%d", len(batch), created, updated, failed)
+
+	if err := importitems.UpdateImportRecordStatusDone(ctx, p.MG, importRecordID); err != nil {
+		log.Printf("[PROC][contact_persons][ERR] update import_record status: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package processors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"debtster_import/internal/repository/database"
+	"debtster_import/internal/validation"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Операции над телефонами/адресами (колонка operation).
+const (
+	opAdd         = "add"
+	opReplaceType = "replace_type"
+	opDeactivate  = "deactivate"
+)
+
+func parseOperation(s string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", opAdd:
+		return opAdd, true
+	case opReplaceType, "replace":
+		return opReplaceType, true
+	case opDeactivate, "delete", "remove":
+		return opDeactivate, true
+	}
+	return "", false
+}
+
+// debtorLookup находит должника по iin, а если его нет — по debt_number.
+// Кэш живёт в пределах одного батча.
+type debtorLookup struct {
+	debtors *database.DebtorRepo
+	debts   *database.DebtsRepo
+
+	byIIN  map[string]*string
+	byDebt map[string]*string
+}
+
+func newDebtorLookup(debtors *database.DebtorRepo, debts *database.DebtsRepo) *debtorLookup {
+	return &debtorLookup{
+		debtors: debtors,
+		debts:   debts,
+		byIIN:   make(map[string]*string),
+		byDebt:  make(map[string]*string),
+	}
+}
+
+// prefetch разрешает iin и номера долгов батча двумя запросами и заполняет
+// кэш; resolve после него в базу не ходит.
+func (l *debtorLookup) prefetch(ctx context.Context, batch []map[string]string) error {
+	var iins, numbers []string
+	for _, m := range batch {
+		if raw := strings.TrimSpace(m["iin"]); raw != "" {
+			if parsed, err := validation.ParseIIN(raw); err == nil {
+				iins = append(iins, parsed.Value)
+			}
+			continue
+		}
+		if dn := validation.NormalizeDebtNumber(m["debt_number"]); dn != "" {
+			numbers = append(numbers, dn)
+		}
+	}
+
+	if len(iins) > 0 {
+		found, err := l.debtors.ResolveIDsByIIN(ctx, iins)
+		if err != nil {
+			return fmt.Errorf("resolve debtors: %w", err)
+		}
+		for _, iin := range iins {
+			if id, ok := found[iin]; ok {
+				l.byIIN[iin] = &id
+			} else {
+				l.byIIN[iin] = nil
+			}
+		}
+	}
+
+	if len(numbers) > 0 && l.debts != nil {
+		found, err := l.debts.ResolveDebtorIDs(ctx, numbers)
+		if err != nil {
+			return fmt.Errorf("resolve debts: %w", err)
+		}
+		for _, dn := range numbers {
+			if id, ok := found[dn]; ok {
+				l.byDebt[dn] = &id
+			} else {
+				l.byDebt[dn] = nil
+			}
+		}
+	}
+	return nil
+}
+
+// resolve возвращает id должника либо текст ошибки для import_record_items.
+func (l *debtorLookup) resolve(ctx context.Context, m map[string]string) (string, string) {
+	if raw := strings.TrimSpace(m["iin"]); raw != "" {
+		parsed, err := validation.ParseIIN(raw)
+		if err != nil {
+			return "", "invalid iin: " + err.Error()
+		}
+		iin := parsed.Value
+		id, ok := l.byIIN[iin]
+		if !ok {
+			var err error
+			id, err = l.debtors.GetIDByIIN(ctx, iin)
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return "", "debtor lookup error: " + err.Error()
+			}
+			l.byIIN[iin] = id
+		}
+		if id == nil {
+			return "", "debtor not found: " + iin
+		}
+		return *id, ""
+	}
+
+	if dn := validation.NormalizeDebtNumber(m["debt_number"]); dn != "" {
+		if l.debts == nil {
+			return "", "debt_number lookup not configured"
+		}
+		id, ok := l.byDebt[dn]
+		if !ok {
+			var err error
+			id, err = l.debts.GetDebtorIDByNumber(ctx, dn)
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return "", "debt lookup error: " + err.Error()
+			}
+			l.byDebt[dn] = id
+		}
+		if id == nil {
+			return "", "debtor not found by debt_number: " + dn
+		}
+		return *id, ""
+	}
+
+	return "", "missing iin or debt_number"
+}
+
+// parseTypeID принимает числовой id или название из aliases.
+func parseTypeID(s string, aliases map[string]int, def int) (int, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return def, true
+	}
+	if n, err := strconv.Atoi(s); err == nil && n > 0 {
+		return n, true
+	}
+	if n, ok := aliases[s]; ok {
+		return n, true
+	}
+	return 0, false
+}
+
+// resolveTypeID — parseTypeID с поиском по названию в справочнике типов
+// (phone_types, address_types), если значение не id и не известный алиас.
+func resolveTypeID(ctx context.Context, s string, aliases map[string]int, def int, types *database.ReferenceRepo) (int, string) {
+	if n, ok := parseTypeID(s, aliases, def); ok {
+		return n, ""
+	}
+	if types == nil {
+		return 0, "unknown type: " + s
+	}
+	id, err := types.Resolve(ctx, s)
+	if err != nil {
+		return 0, "type lookup error: " + err.Error()
+	}
+	if id == nil {
+		return 0, "unknown type: " + s
+	}
+	return int(*id), ""
+}
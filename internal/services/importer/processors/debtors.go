@@ -11,6 +11,7 @@ import (
 
 	"debtster_import/internal/repository/database"
 	importitems "debtster_import/internal/repository/imports"
+	"debtster_import/internal/validation"
 
 	"github.com/google/uuid"
 )
@@ -23,16 +24,27 @@ type DebtorsProcessor struct {
 	AddressesRepo           *database.AddressesRepo
 	PhonesRepo              *database.PhoneRepo
 	ContactPersonPhonesRepo *database.ContactPersonPhonesRepo
+	WorkplacesRepo          *database.WorkplaceRepo
+
+	// Справочники для колонок debt_counterparty и debt_status (по названию / БИН
+	// и shortname). С опцией strict_references долг с неизвестным значением не пишется.
+	CounterpartiesRepo *database.CounterpartiesRepo
+	DebtStatusesRepo   *database.DebtStatusesRepo
 }
 
 func (p DebtorsProcessor) Type() string { return "import_debtors" }
 
+// OrderSensitive — батчи по одному: должник и долг обновляются последней строкой файла.
+func (p DebtorsProcessor) OrderSensitive() bool { return true }
+
 func (p *DebtorsProcessor) ProcessBatch(ctx context.Context, batch []map[string]string) error {
 	if err := CheckDeps(p); err != nil {
 		return err
 	}
 
-	log.Printf("[PROC][debtors][START] rows=%d", len(batch))
+	strict := strictReferences(ctx)
+
+	log.Printf("[PROC][debtors][START] rows=%d strict_references=%t", len(batch), strict)
 
 	success := 0
 	failed := 0
@@ -47,8 +59,7 @@ func (p *DebtorsProcessor) ProcessBatch(ctx context.Context, batch []map[string]
 	for i, m := range batch {
 
 		modelID := uuid.NewString()
-		iin := strings.TrimSpace(m["iin"])
-		if iin == "" {
+		if strings.TrimSpace(m["iin"]) == "" {
 			failed++
 			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
 				ImportRecordID: importRecordID,
@@ -60,6 +71,49 @@ func (p *DebtorsProcessor) ProcessBatch(ctx context.Context, batch []map[string]
 			continue
 		}
 
+		// ----------------------------------------------------
+		// 0. Проверка ИИН и сверка с birth_day
+		// ----------------------------------------------------
+		parsedIIN, err := validation.ParseIIN(m["iin"])
+		if err != nil {
+			failed++
+			log.Printf("[PROC][debtors][ERR] row=%d invalid iin: %v", i, err)
+			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+				ImportRecordID: importRecordID,
+				ModelType:      p.Type(),
+				ModelID:        modelID,
+				Payload:        m,
+				Errors:         "invalid iin: " + err.Error(),
+			})
+			continue
+		}
+		iin := parsedIIN.Value
+
+		var warnings []string
+		if parsedIIN.Repaired {
+			warnings = append(warnings, "iin repaired: leading zero restored -> "+iin)
+		}
+
+		birthDay := parseDate(m["birth_day"])
+		iinBirth := parsedIIN.BirthDate
+		switch {
+		case parsedIIN.BIN:
+			// у БИН даты рождения нет — берём только из файла
+			if birthDay == nil && strings.TrimSpace(m["birth_day"]) != "" {
+				warnings = append(warnings, "bad birth_day -> ignored")
+			}
+		case birthDay == nil && strings.TrimSpace(m["birth_day"]) != "":
+			warnings = append(warnings, "bad birth_day -> taken from iin: "+iinBirth.Format("2006-01-02"))
+			birthDay = &iinBirth
+		case birthDay == nil:
+			birthDay = &iinBirth
+		case birthDay.Format("2006-01-02") != iinBirth.Format("2006-01-02"):
+			warnings = append(warnings, "birth_day mismatch: file="+birthDay.Format("2006-01-02")+" iin="+iinBirth.Format("2006-01-02"))
+		}
+		for _, w := range warnings {
+			log.Printf("[PROC][debtors][WARN] row=%d iin=%s %s", i, iin, w)
+		}
+
 		// ----------------------------------------------------
 		// 1. Создаём или обновляем Debtor
 		// ----------------------------------------------------
@@ -71,7 +125,7 @@ func (p *DebtorsProcessor) ProcessBatch(ctx context.Context, batch []map[string]
 			IDCardAuthoritiesInGranting: strings.TrimSpace(m["id_card_authorities_in_granting"]),
 			IDCardStartDate:             parseDate(m["id_card_start_date"]),
 			IDCardEndDate:               parseDate(m["id_card_end_date"]),
-			BirthDay:                    parseDate(m["birth_day"]),
+			BirthDay:                    birthDay,
 			Birthplace:                  strings.TrimSpace(m["birthplace"]),
 			Nationality:                 strings.TrimSpace(m["nationality"]),
 			CreatedAt:                   nowPtr(),
@@ -95,7 +149,7 @@ func (p *DebtorsProcessor) ProcessBatch(ctx context.Context, batch []map[string]
 		// 2. Долги (debts)
 		// ----------------------------------------------------
 		if p.DebtsRepo != nil {
-			debtNumber := strings.TrimSpace(m["debt_number"])
+			debtNumber := validation.NormalizeDebtNumber(m["debt_number"])
 			if debtNumber != "" {
 
 				debtRow := models.Debt{
@@ -115,7 +169,18 @@ func (p *DebtorsProcessor) ProcessBatch(ctx context.Context, batch []map[string]
 					CreatedAt:        nowPtr(),
 				}
 
-				if err := p.DebtsRepo.UpdateOrCreate(ctx, debtRow); err != nil {
+				refWarnings, refErr := p.resolveDebtReferences(ctx, m, &debtRow, strict)
+				warnings = append(warnings, refWarnings...)
+
+				if refErr != "" {
+					importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+						ImportRecordID: importRecordID,
+						ModelType:      "debts",
+						ModelID:        debtRow.ID,
+						Payload:        m,
+						Errors:         refErr,
+					})
+				} else if err := p.DebtsRepo.UpdateOrCreate(ctx, debtRow); err != nil {
 					log.Printf("[PROC][debts][ERR] iin=%s debt_number=%s: %v", iin, debtNumber, err)
 					importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
 						ImportRecordID: importRecordID,
@@ -194,7 +259,11 @@ func (p *DebtorsProcessor) ProcessBatch(ctx context.Context, batch []map[string]
 					CreatedAt:   nowPtr(),
 				}
 
-				if err := p.PhonesRepo.SavePhones(ctx, phoneRow); err != nil {
+				res, err := p.PhonesRepo.AddPhones(ctx, phoneRow)
+				for _, inv := range res.Invalid {
+					warnings = append(warnings, ph.key+": "+inv)
+				}
+				if err != nil {
 					log.Printf("[PROC][phones][ERR] iin=%s phones=%s: %v", iin, raw, err)
 					importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
 						ImportRecordID: importRecordID,
@@ -217,7 +286,9 @@ func (p *DebtorsProcessor) ProcessBatch(ctx context.Context, batch []map[string]
 					DebtorID: debtor.ID,
 					Value:    raw,
 				}
-				if err := p.ContactPersonPhonesRepo.SaveContactPersonPhones(ctx, contactRow); err != nil {
+				cpWarnings, err := p.ContactPersonPhonesRepo.SaveContactPersonPhones(ctx, contactRow)
+				warnings = append(warnings, cpWarnings...)
+				if err != nil {
 					log.Printf("[PROC][contact_phones][ERR] iin=%s value=%s: %v", iin, raw, err)
 					importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
 						ImportRecordID: importRecordID,
@@ -230,6 +301,28 @@ func (p *DebtorsProcessor) ProcessBatch(ctx context.Context, batch []map[string]
 			}
 		}
 
+		// ----------------------------------------------------
+		// 6. Workplace (workplace_* колонки)
+		// ----------------------------------------------------
+		if p.WorkplacesRepo != nil {
+			if wp, ok := workplaceFromRow(m, debtor.ID); ok {
+				// предупреждения (например, неверный БИН) — в строку должника:
+				// должник сохранён, строка не ошибочная
+				_, wpWarnings, err := saveWorkplace(ctx, p.WorkplacesRepo, p.PhonesRepo, wp)
+				warnings = append(warnings, wpWarnings...)
+				if err != nil {
+					log.Printf("[PROC][workplaces][ERR] iin=%s name=%s: %v", iin, wp.Name, err)
+					importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+						ImportRecordID: importRecordID,
+						ModelType:      "work_places",
+						ModelID:        uuid.NewString(),
+						Payload:        m,
+						Errors:         err.Error(),
+					})
+				}
+			}
+		}
+
 		// ----------------------------------------------------
 		// Успешная запись
 		// ----------------------------------------------------
@@ -240,7 +333,7 @@ func (p *DebtorsProcessor) ProcessBatch(ctx context.Context, batch []map[string]
 			ModelID:        debtor.ID,
 			Payload:        m,
 			Status:         "done",
-			Errors:         "",
+			Errors:         strings.Join(warnings, "; "),
 		})
 	}
 
@@ -286,3 +379,43 @@ func parseFloatPtr(s string) *float64 {
 	}
 	return &v
 }
+
+// resolveDebtReferences заполняет counterparty_id и status_id долга по колонкам
+// debt_counterparty и debt_status. Неизвестное значение — предупреждение,
+// а со strict — ошибка (долг не пишется).
+func (p *DebtorsProcessor) resolveDebtReferences(ctx context.Context, m map[string]string, debt *models.Debt, strict bool) ([]string, string) {
+	var warnings []string
+	miss := func(msg string) string {
+		if strict {
+			return msg
+		}
+		warnings = append(warnings, msg+" -> NULL")
+		return ""
+	}
+
+	if raw := strings.TrimSpace(m["debt_counterparty"]); raw != "" && p.CounterpartiesRepo != nil {
+		id, err := p.CounterpartiesRepo.Resolve(ctx, raw)
+		switch {
+		case err != nil:
+			if msg := miss("counterparty lookup error: " + err.Error()); msg != "" {
+				return warnings, msg
+			}
+		case id == nil:
+			if msg := miss("counterparty not found: " + raw); msg != "" {
+				return warnings, msg
+			}
+		default:
+			debt.CounterpartyID = id
+		}
+	}
+
+	if raw := strings.TrimSpace(m["debt_status"]); raw != "" && p.DebtStatusesRepo != nil {
+		if id, err := p.DebtStatusesRepo.GetStatusBigint(ctx, raw); err == nil && id != nil {
+			debt.StatusID = id
+		} else if msg := miss("status not found: " + raw); msg != "" {
+			return warnings, msg
+		}
+	}
+
+	return warnings, ""
+}
@@ -6,10 +6,11 @@ import (
 	"fmt"
 	"log"
 	"strings"
-	"time"
 
 	"debtster_import/internal/ports"
+	"debtster_import/internal/repository/database"
 	importitems "debtster_import/internal/repository/imports"
+	"debtster_import/internal/validation"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
@@ -20,16 +21,46 @@ const (
 	defaultAppTeam = "app"
 )
 
+// distributionStage — назначения батча для set-based запросов applyAssignments.
+var distributionStage = database.Stage{
+	Table: "tmp_distribution",
+	Columns: []database.StageColumn{
+		{Name: "debt_id", Type: "text NOT NULL"},
+		{Name: "user_id", Type: "bigint NOT NULL"},
+		{Name: "role_id", Type: "bigint NOT NULL"},
+		{Name: "reason", Type: "text NULL"},
+		{Name: "team_name", Type: "text NOT NULL"},
+	},
+}
+
 var defaultUserType = importitems.PHPModelMap[importitems.ModelTypeUsers]
 
 type DistributionDebtsProcessor struct {
 	*BaseProcessor
+	DebtsRepo *database.DebtsRepo
 
 	SystemTeamID int64
 }
 
+// assignment — назначение долга пользователю с его ролью из команды app.
+type assignment struct {
+	debtID string
+	userID int64
+	roleID int64
+	reason string
+}
+
+// distUserRef — пользователь и его роль в команде app (roleID=nil — роли нет).
+type distUserRef struct {
+	id     int64
+	roleID *int64
+}
+
 func (p DistributionDebtsProcessor) Type() string { return "distribution_debts" }
 
+// OrderSensitive — батчи по одному: при повторе долга побеждает последняя строка файла.
+func (p DistributionDebtsProcessor) OrderSensitive() bool { return true }
+
 func (p *DistributionDebtsProcessor) ProcessBatch(ctx context.Context, batch []map[string]string) error {
 	if err := CheckDeps(p); err != nil {
 		return err
@@ -42,10 +73,6 @@ func (p *DistributionDebtsProcessor) ProcessBatch(ctx context.Context, batch []m
 		}
 	}
 
-	debtsTable := "debts"
-	usersTable := "users"
-	teamsTable := "teams"
-	roleUserTable := "role_user"
 	modelType := p.Type()
 
 	log.Printf("[PROC][redistribute][START] rows=%d import_record_id=%s", len(batch), importRecordID)
@@ -53,330 +80,158 @@ func (p *DistributionDebtsProcessor) ProcessBatch(ctx context.Context, batch []m
 	// ---------------------------------------------------------------------
 	// Получаем app team
 	// ---------------------------------------------------------------------
-	var appTeamID int64
-	if err := p.PG.Pool.QueryRow(ctx,
-		`SELECT id FROM `+teamsTable+` WHERE name = $1 LIMIT 1`, defaultAppTeam,
-	).Scan(&appTeamID); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return fmt.Errorf("app team not found: %s", defaultAppTeam)
-		}
-		return fmt.Errorf("lookup app team failed: %w", err)
+	appTeamID, err := p.appTeamID(ctx)
+	if err != nil {
+		return err
+	}
+
+	fail := func(id string, m map[string]string, msg string) {
+		importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+			ImportRecordID: importRecordID,
+			ModelType:      modelType,
+			ModelID:        id,
+			Payload:        m,
+			Errors:         msg,
+		})
 	}
 
 	// ---------------------------------------------------------------------
-	// Кэши для ускорения
+	// 1. Разбор строк и массовое разрешение номеров и логинов
 	// ---------------------------------------------------------------------
-	debtIDCache := make(map[string]*string)
-	userIDCache := make(map[string]*int64)
-	userRoleCache := make(map[int64]*int64)
-
 	type row struct {
-		id        string
-		payload   map[string]string
-		debtID    *string
-		userID    *int64
-		roleID    *int64
-		createdAt *time.Time
+		id         string
+		payload    map[string]string
+		debtNumber string
+		username   string
 	}
 
-	rows := make([]row, 0, len(batch))
+	parsed := make([]row, 0, len(batch))
+	numbers := make([]string, 0, len(batch))
+	usernames := make([]string, 0, len(batch))
 
-	// ---------------------------------------------------------------------
-	// 1. Предобработка строк
-	// ---------------------------------------------------------------------
 	for _, m := range batch {
-		rowID := uuid.NewString()
-
-		debtNumber := strings.TrimSpace(m["debt_number"])
-		username := strings.TrimSpace(m["debt_username"])
-
-		if debtNumber == "" {
-			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
-				ImportRecordID: importRecordID,
-				ModelType:      modelType,
-				ModelID:        rowID,
-				Payload:        m,
-				Errors:         "missing debt_number",
-			})
-			continue
+		r := row{
+			id:         uuid.NewString(),
+			payload:    m,
+			debtNumber: validation.NormalizeDebtNumber(m["debt_number"]),
+			username:   strings.TrimSpace(m["debt_username"]),
 		}
-		if username == "" {
-			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
-				ImportRecordID: importRecordID,
-				ModelType:      modelType,
-				ModelID:        rowID,
-				Payload:        m,
-				Errors:         "missing username",
-			})
+		if r.debtNumber == "" {
+			fail(r.id, m, "missing debt_number")
 			continue
 		}
-
-		// ---------------------------------------------
-		// 1.1 Получаем debt_id
-		// ---------------------------------------------
-		var debtUUID *string
-		if v, ok := debtIDCache[debtNumber]; ok {
-			debtUUID = v
-		} else {
-			var uuidText string
-			err := p.PG.Pool.QueryRow(ctx,
-				`SELECT id::text FROM `+debtsTable+` WHERE number = $1 LIMIT 1`, debtNumber,
-			).Scan(&uuidText)
-
-			if err != nil {
-				if errors.Is(err, pgx.ErrNoRows) {
-					debtIDCache[debtNumber] = nil
-					importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
-						ImportRecordID: importRecordID,
-						ModelType:      modelType,
-						ModelID:        rowID,
-						Payload:        m,
-						Errors:         "debt not found: " + debtNumber,
-					})
-					continue
-				}
-				importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
-					ImportRecordID: importRecordID,
-					ModelType:      modelType,
-					ModelID:        rowID,
-					Payload:        m,
-					Errors:         "debt lookup error: " + err.Error(),
-				})
-				continue
-			}
-			debtUUID = &uuidText
-			debtIDCache[debtNumber] = debtUUID
-		}
-		if debtUUID == nil {
+		if r.username == "" {
+			fail(r.id, m, "missing username")
 			continue
 		}
-
-		// ---------------------------------------------
-		// 1.2 Получаем user_id
-		// ---------------------------------------------
-		var userID *int64
-		if v, ok := userIDCache[username]; ok {
-			userID = v
-		} else {
-			var id int64
-			err := p.PG.Pool.QueryRow(ctx,
-				`SELECT id FROM `+usersTable+` WHERE username = $1 LIMIT 1`, username,
-			).Scan(&id)
-
-			if err != nil {
-				if errors.Is(err, pgx.ErrNoRows) {
-					userIDCache[username] = nil
-					importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
-						ImportRecordID: importRecordID,
-						ModelType:      modelType,
-						ModelID:        rowID,
-						Payload:        m,
-						Errors:         "username not found: " + username,
-					})
-					continue
-				}
-				importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
-					ImportRecordID: importRecordID,
-					ModelType:      modelType,
-					ModelID:        rowID,
-					Payload:        m,
-					Errors:         "user lookup error: " + err.Error(),
-				})
-				continue
-			}
-			userID = &id
-			userIDCache[username] = userID
-		}
-		if userID == nil {
-			continue
-		}
-
-		// ---------------------------------------------
-		// 1.3 Получаем роль пользователя
-		// ---------------------------------------------
-		var roleID *int64
-		if cached, ok := userRoleCache[*userID]; ok {
-			roleID = cached
-		} else {
-			var rid int64
-			err := p.PG.Pool.QueryRow(ctx,
-				`SELECT role_id FROM `+roleUserTable+` WHERE user_id = $1 AND team_id = $2 LIMIT 1`,
-				*userID, appTeamID,
-			).Scan(&rid)
-
-			if err != nil {
-				if errors.Is(err, pgx.ErrNoRows) {
-					userRoleCache[*userID] = nil
-					importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
-						ImportRecordID: importRecordID,
-						ModelType:      modelType,
-						ModelID:        rowID,
-						Payload:        m,
-						Errors:         "user has no role in app team",
-					})
-					continue
-				}
-				importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
-					ImportRecordID: importRecordID,
-					ModelType:      modelType,
-					ModelID:        rowID,
-					Payload:        m,
-					Errors:         "lookup app role failed: " + err.Error(),
-				})
-				continue
-			}
-
-			roleID = &rid
-			userRoleCache[*userID] = roleID
-		}
-		if roleID == nil {
-			continue
-		}
-
-		now := time.Now()
-		rows = append(rows, row{
-			id:        rowID,
-			payload:   m,
-			debtID:    debtUUID,
-			userID:    userID,
-			roleID:    roleID,
-			createdAt: &now,
-		})
+		parsed = append(parsed, r)
+		numbers = append(numbers, r.debtNumber)
+		usernames = append(usernames, r.username)
 	}
 
-	if len(rows) == 0 {
+	if len(parsed) == 0 {
 		log.Printf("[PROC][redistribute][DONE] no valid rows")
 		return nil
 	}
 
+	debtIDs, err := p.DebtsRepo.ResolveDebtIDs(ctx, numbers)
+	if err != nil {
+		return fmt.Errorf("debt lookup error: %w", err)
+	}
+	users, err := p.resolveUsers(ctx, appTeamID, usernames)
+	if err != nil {
+		return err
+	}
+
 	// ---------------------------------------------------------------------
-	// 2. Основная обработка строк
+	// 2. Назначения; при повторе долга в батче побеждает последняя строка
 	// ---------------------------------------------------------------------
-	fixed := 0
-
-	for _, r := range rows {
-		debtTeamName := debtTeamPrefix + *r.debtID
-
-		batch := &pgx.Batch{}
-		batch.Queue(
-			`UPDATE `+debtsTable+` d
-		     SET user_id = $2,
-		         user_assigned_at = (NOW() AT TIME ZONE 'Asia/Almaty')
-		     WHERE d.id = $1::uuid AND (d.user_id IS DISTINCT FROM $2)`,
-			r.debtID, r.userID,
-		)
-		batch.Queue(
-			`INSERT INTO `+teamsTable+` (name) VALUES ($1)
-			 ON CONFLICT (name) DO NOTHING`,
-			debtTeamName,
-		)
-		batch.Queue(
-			`SELECT id, name FROM `+teamsTable+` WHERE name = $1 LIMIT 1`,
-			debtTeamName,
-		)
+	type ready struct {
+		row
+		a assignment
+		// superseded — строку перекрыла более поздняя строка того же долга.
+		superseded string
+	}
 
-		br := p.PG.Pool.SendBatch(ctx, batch)
+	readyRows := make([]ready, 0, len(parsed))
+	lastByDebt := make(map[string]int)
 
-		// 1) UPDATE debts
-		if _, err := br.Exec(); err != nil {
-			br.Close()
-			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
-				ImportRecordID: importRecordID,
-				ModelType:      modelType,
-				ModelID:        r.id,
-				Payload:        r.payload,
-				Errors:         "update debts: " + err.Error(),
-			})
+	for _, r := range parsed {
+		debtID, ok := debtIDs[r.debtNumber]
+		if !ok {
+			fail(r.id, r.payload, "debt not found: "+r.debtNumber)
 			continue
 		}
-
-		// 2) INSERT team
-		if _, err := br.Exec(); err != nil {
-			br.Close()
-			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
-				ImportRecordID: importRecordID,
-				ModelType:      modelType,
-				ModelID:        r.id,
-				Payload:        r.payload,
-				Errors:         "ensure team: " + err.Error(),
-			})
+		u, ok := users[r.username]
+		if !ok {
+			fail(r.id, r.payload, "username not found: "+r.username)
 			continue
 		}
-
-		// 3) SELECT team_id, name
-		var teamID int64
-		var teamName string
-		if err := br.QueryRow().Scan(&teamID, &teamName); err != nil {
-			br.Close()
-			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
-				ImportRecordID: importRecordID,
-				ModelType:      modelType,
-				ModelID:        r.id,
-				Payload:        r.payload,
-				Errors:         "select team_id: " + err.Error(),
-			})
+		if u.roleID == nil {
+			fail(r.id, r.payload, "user has no role in app team")
 			continue
 		}
-		br.Close()
 
-		if !strings.HasPrefix(teamName, debtTeamPrefix) {
-			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
-				ImportRecordID: importRecordID,
-				ModelType:      modelType,
-				ModelID:        r.id,
-				Payload:        r.payload,
-				Errors:         "team name not debt/*: " + teamName,
-			})
-			continue
+		reason := strings.TrimSpace(r.payload["reason"])
+		if reason == "" {
+			reason = modelType
 		}
 
-		// Удаляем неправильные записи role_user
-		_, err := p.PG.Pool.Exec(ctx,
-			`DELETE FROM `+roleUserTable+` ru
-			   USING `+teamsTable+` tm, `+debtsTable+` d
-			 WHERE ru.team_id = tm.id
-			   AND tm.id = $1
-			   AND tm.name LIKE 'debt/%'
-			   AND d.id = $2::uuid
-			   AND ru.team_id <> $4
-			   AND (ru.user_id <> d.user_id OR (ru.user_id = d.user_id AND ru.role_id <> $3))`,
-			teamID, r.debtID, r.roleID, p.SystemTeamID,
-		)
-		if err != nil {
-			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
-				ImportRecordID: importRecordID,
-				ModelType:      modelType,
-				ModelID:        r.id,
-				Payload:        r.payload,
-				Errors:         "delete wrong role_user: " + err.Error(),
-			})
-			continue
+		if prev, ok := lastByDebt[debtID]; ok {
+			readyRows[prev].superseded = "superseded by a later row for debt " + r.debtNumber
+			readyRows[prev].a.debtID = ""
 		}
+		lastByDebt[debtID] = len(readyRows)
+		readyRows = append(readyRows, ready{
+			row: r,
+			a:   assignment{debtID: debtID, userID: u.id, roleID: *u.roleID, reason: reason},
+		})
+	}
 
-		// Добавляем корректную запись role_user
-		_, err = p.PG.Pool.Exec(ctx,
-			`INSERT INTO `+roleUserTable+` (user_id, role_id, user_type, team_id)
-			   SELECT $1, $2, $4, $3
-			   WHERE NOT EXISTS (
-			     SELECT 1 FROM `+roleUserTable+` ru
-			      WHERE ru.user_id = $1 AND ru.role_id = $2 AND ru.team_id = $3
-			   )`,
-			r.userID, r.roleID, teamID, defaultUserType,
-		)
-		if err != nil {
-			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+	assignments := make([]assignment, 0, len(readyRows))
+	for _, r := range readyRows {
+		if r.a.debtID != "" {
+			assignments = append(assignments, r.a)
+		}
+	}
+
+	// ---------------------------------------------------------------------
+	// 3. Применяем батч набором запросов; при ошибке — по одной строке,
+	//    чтобы ошибка одного долга не отменяла остальные
+	// ---------------------------------------------------------------------
+	var rowErrs map[string]error
+	if len(assignments) > 0 {
+		if err := p.applyAssignments(ctx, assignments, importRecordID); err != nil {
+			log.Printf("[PROC][redistribute][WARN] rows=%d batch apply failed, retry per row: %v", len(assignments), err)
+			rowErrs = make(map[string]error)
+			for _, a := range assignments {
+				if err := p.applyAssignments(ctx, []assignment{a}, importRecordID); err != nil {
+					rowErrs[a.debtID] = err
+				}
+			}
+		}
+	}
+
+	fixed := 0
+	for _, r := range readyRows {
+		if r.superseded != "" {
+			// строка ничего не меняет, но и ошибкой не является
+			importitems.LogMongo(ctx, p.MG, importitems.LogParams{
 				ImportRecordID: importRecordID,
 				ModelType:      modelType,
 				ModelID:        r.id,
 				Payload:        r.payload,
-				Errors:         "insert correct role_user: " + err.Error(),
+				Status:         "done",
+				Errors:         r.superseded,
 			})
 			continue
 		}
+		if err := rowErrs[r.a.debtID]; err != nil {
+			fail(r.id, r.payload, err.Error())
+			continue
+		}
 
 		fixed++
-
-		// Успешная запись
 		importitems.LogMongo(ctx, p.MG, importitems.LogParams{
 			ImportRecordID: importRecordID,
 			ModelType:      modelType,
@@ -387,10 +242,137 @@ func (p *DistributionDebtsProcessor) ProcessBatch(ctx context.Context, batch []m
 		})
 	}
 
-	log.Printf("[PROC][redistribute][DONE] total=%d fixed=%d", len(rows), fixed)
+	log.Printf("[PROC][redistribute][DONE] total=%d fixed=%d", len(parsed), fixed)
 
 	if err := importitems.UpdateImportRecordStatusDone(ctx, p.MG, importRecordID); err != nil {
 		log.Printf("[PROC][redistribute][ERR] error change status: %v", err)
 	}
 	return nil
 }
+
+// appTeamID возвращает id команды приложения (app), в которой у
+// пользователей хранятся их роли.
+func (p *DistributionDebtsProcessor) appTeamID(ctx context.Context) (int64, error) {
+	var id int64
+	err := p.PG.Pool.QueryRow(ctx,
+		`SELECT id FROM teams WHERE name = $1 LIMIT 1`, defaultAppTeam,
+	).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("app team not found: %s", defaultAppTeam)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("lookup app team failed: %w", err)
+	}
+	return id, nil
+}
+
+// resolveUsers — логин → id и роль в команде app одним запросом.
+func (p *DistributionDebtsProcessor) resolveUsers(ctx context.Context, appTeamID int64, usernames []string) (map[string]distUserRef, error) {
+	rows, err := p.PG.Pool.Query(ctx, `
+		SELECT DISTINCT ON (u.username) u.username, u.id, ru.role_id
+		FROM users u
+		LEFT JOIN role_user ru ON ru.user_id = u.id AND ru.team_id = $2
+		WHERE u.username = ANY($1)
+		ORDER BY u.username, u.id, ru.role_id`,
+		usernames, appTeamID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("user lookup error: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string]distUserRef, len(usernames))
+	for rows.Next() {
+		var username string
+		var u distUserRef
+		if err := rows.Scan(&username, &u.id, &u.roleID); err != nil {
+			return nil, err
+		}
+		out[username] = u
+	}
+	return out, rows.Err()
+}
+
+// applyAssignments назначает долги пользователям в одной транзакции:
+// назначения копируются во временную таблицу, затем набором запросов
+// обновляются debts (с записью истории назначений), создаются команды
+// debt/<id>, удаляются чужие записи role_user и добавляются записи
+// ответственных с их ролью из команды app. Долг в assignments должен
+// встречаться не более одного раза.
+func (p *DistributionDebtsProcessor) applyAssignments(ctx context.Context, assignments []assignment, importRecordID string) error {
+	tx, err := p.PG.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	src := make([][]any, len(assignments))
+	for i, a := range assignments {
+		src[i] = []any{a.debtID, a.userID, a.roleID, a.reason, debtTeamPrefix + a.debtID}
+	}
+	if err := distributionStage.Load(ctx, tx, src); err != nil {
+		return err
+	}
+
+	// 1) UPDATE debts + история назначений
+	if _, err := tx.Exec(ctx, `
+		WITH prev AS (
+		    SELECT d.id, d.user_id
+		    FROM debts d
+		    JOIN `+distributionStage.Table+` t ON d.id = t.debt_id::uuid
+		    FOR UPDATE OF d
+		), upd AS (
+		    UPDATE debts d
+		    SET user_id = t.user_id,
+		        user_assigned_at = (NOW() AT TIME ZONE 'Asia/Almaty')
+		    FROM `+distributionStage.Table+` t, prev
+		    WHERE d.id = t.debt_id::uuid
+		      AND prev.id = d.id
+		      AND prev.user_id IS DISTINCT FROM t.user_id
+		    RETURNING d.id, prev.user_id AS previous_user_id, d.user_id AS new_user_id, t.reason
+		)
+		`+database.RecordAssignmentSQL("$1", "reason"),
+		importRecordID,
+	); err != nil {
+		return fmt.Errorf("update debts: %w", err)
+	}
+
+	// 2) команды debt/<id>
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO teams (name)
+		SELECT team_name FROM `+distributionStage.Table+`
+		ON CONFLICT (name) DO NOTHING`,
+	); err != nil {
+		return fmt.Errorf("ensure team: %w", err)
+	}
+
+	// 3) удаляем неправильные записи role_user
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM role_user ru
+		USING teams tm, `+distributionStage.Table+` t
+		WHERE tm.name = t.team_name
+		  AND ru.team_id = tm.id
+		  AND ru.team_id <> $1
+		  AND (ru.user_id <> t.user_id OR ru.role_id <> t.role_id)`,
+		p.SystemTeamID,
+	); err != nil {
+		return fmt.Errorf("delete wrong role_user: %w", err)
+	}
+
+	// 4) добавляем корректные записи role_user
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO role_user (user_id, role_id, user_type, team_id)
+		SELECT t.user_id, t.role_id, $1, tm.id
+		FROM `+distributionStage.Table+` t
+		JOIN teams tm ON tm.name = t.team_name
+		WHERE NOT EXISTS (
+		    SELECT 1 FROM role_user ru
+		    WHERE ru.user_id = t.user_id AND ru.role_id = t.role_id AND ru.team_id = tm.id
+		)`,
+		defaultUserType,
+	); err != nil {
+		return fmt.Errorf("insert correct role_user: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
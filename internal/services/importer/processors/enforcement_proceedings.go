@@ -2,6 +2,7 @@ package processors
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"strings"
 
@@ -9,18 +10,27 @@ import (
 	"debtster_import/internal/ports"
 	"debtster_import/internal/repository/database"
 	importitems "debtster_import/internal/repository/imports"
+	"debtster_import/internal/validation"
 
 	"github.com/google/uuid"
 )
 
 type EnforcementProceedingsProcessor struct {
 	*BaseProcessor
-	EnfProcRepo *database.EnforcementProceedingsRepo
-	DebtsRepo   *database.DebtsRepo
+	EnfProcRepo  *database.EnforcementProceedingsRepo
+	DebtsRepo    *database.DebtsRepo
+	ExecDocsRepo *database.ExecutiveDocumentsRepo
+
+	// Strict — отклонять строки, для которых не найден исполнительный документ.
+	// Включается также опцией импорта strict=true.
+	Strict bool
 }
 
 func (p EnforcementProceedingsProcessor) Type() string { return "import_enforcement_proceedings" }
 
+// OrderSensitive — батчи по одному: статусы производств меняются в порядке файла.
+func (p EnforcementProceedingsProcessor) OrderSensitive() bool { return true }
+
 func (p *EnforcementProceedingsProcessor) ProcessBatch(ctx context.Context, batch []map[string]string) error {
 	if err := CheckDeps(p); err != nil {
 		return err
@@ -38,7 +48,16 @@ func (p *EnforcementProceedingsProcessor) ProcessBatch(ctx context.Context, batc
 
 	modelType := importitems.PHPModelByTable(p.EnfProcRepo.GetTableName())
 
-	log.Printf("[PROC][enf_proc][START] rows=%d import_record_id=%s", len(batch), importRecordID)
+	strict := p.Strict || ports.ImportFlag(ctx, "strict")
+
+	log.Printf("[PROC][enf_proc][START] rows=%d import_record_id=%s strict=%t", len(batch), importRecordID, strict)
+
+	debtIDs, err := p.DebtsRepo.ResolveDebtIDs(ctx, columnValues(batch, "debt_number"))
+	if err != nil {
+		return fmt.Errorf("resolve debts: %w", err)
+	}
+
+	success, failed, statusChanges := 0, 0, 0
 
 	// ------------------------------------------------------------------
 	// Начинаем обработку
@@ -47,8 +66,9 @@ func (p *EnforcementProceedingsProcessor) ProcessBatch(ctx context.Context, batc
 		modelID := uuid.NewString()
 		f := func(key string) string { return strings.TrimSpace(m[key]) }
 
-		debtNumber := strings.ReplaceAll(f("debt_number"), " ", "")
+		debtNumber := validation.NormalizeDebtNumber(f("debt_number"))
 		if debtNumber == "" {
+			failed++
 			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
 				ImportRecordID: importRecordID,
 				ModelType:      modelType,
@@ -62,19 +82,58 @@ func (p *EnforcementProceedingsProcessor) ProcessBatch(ctx context.Context, batc
 		// ------------------------------------------------------------------
 		// Ищем debt
 		// ------------------------------------------------------------------
-		debtUUID, err := p.DebtsRepo.GetIDByNumber(ctx, debtNumber)
-		if err != nil || debtUUID == nil {
-			msg := "debt not found: " + debtNumber
-			if err != nil {
-				msg += " (" + err.Error() + ")"
-			}
+		debtID, ok := debtIDs[debtNumber]
+		if !ok {
+			failed++
+			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+				ImportRecordID: importRecordID,
+				ModelType:      modelType,
+				ModelID:        modelID,
+				Payload:        m,
+				Errors:         "debt not found: " + debtNumber,
+			})
+			continue
+		}
+		debtUUID := &debtID
 
+		// ------------------------------------------------------------------
+		// Исполнительный документ, по которому открыто производство
+		// ------------------------------------------------------------------
+		var warnings []string
+		var execDocID *string
+		if serial := f("executive_document_serial_number"); serial != "" && p.ExecDocsRepo != nil {
+			id, err := p.ExecDocsRepo.FindIDBySerial(ctx, *debtUUID, serial)
+			msg := ""
+			switch {
+			case err != nil:
+				msg = "executive document lookup error: " + err.Error()
+			case id == nil:
+				msg = "executive document not found: " + serial
+			default:
+				execDocID = id
+			}
+			if msg != "" {
+				if strict {
+					failed++
+					importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+						ImportRecordID: importRecordID,
+						ModelType:      modelType,
+						ModelID:        modelID,
+						Payload:        m,
+						Errors:         msg,
+					})
+					continue
+				}
+				warnings = append(warnings, msg+" -> executive_document_id unchanged")
+			}
+		} else if strict {
+			failed++
 			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
 				ImportRecordID: importRecordID,
 				ModelType:      modelType,
 				ModelID:        modelID,
 				Payload:        m,
-				Errors:         msg,
+				Errors:         "missing executive_document_serial_number",
 			})
 			continue
 		}
@@ -85,18 +144,22 @@ func (p *EnforcementProceedingsProcessor) ProcessBatch(ctx context.Context, batc
 		row := models.EnforcementProceeding{
 			SerialNumber:         nullIfEmpty(f("enforcement_proceeding_serial_number")),
 			DebtID:               debtUUID,
+			ExecutiveDocumentID:  execDocID,
 			Amount:               normalizeAmount(f("enforcement_proceeding_amount")),
 			PrivateBailiffName:   nullIfEmpty(f("enforcement_proceeding_private_bailiff_name")),
 			PrivateBailiffRegion: nullIfEmpty(f("enforcement_proceeding_private_bailiff_region")),
 			StartDate:            parseDateStrict(f("enforcement_proceeding_start_date")),
 			StatusAISOIP:         nullIfEmpty(f("enforcement_proceeding_status_ais_oip")),
+			StatusChangedAt:      parseTimeLoose(f("enforcement_proceeding_status_date")),
 			CreatedAt:            nowPtr(),
 		}
 
 		// ------------------------------------------------------------------
 		// Upsert
 		// ------------------------------------------------------------------
-		if _, err := p.EnfProcRepo.Upsert(ctx, row); err != nil {
+		saved, changed, err := p.EnfProcRepo.Upsert(ctx, row, importRecordID)
+		if err != nil {
+			failed++
 			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
 				ImportRecordID: importRecordID,
 				ModelType:      modelType,
@@ -110,17 +173,21 @@ func (p *EnforcementProceedingsProcessor) ProcessBatch(ctx context.Context, batc
 		// ------------------------------------------------------------------
 		// Успешная запись
 		// ------------------------------------------------------------------
+		success++
+		if changed {
+			statusChanges++
+		}
 		importitems.LogMongo(ctx, p.MG, importitems.LogParams{
 			ImportRecordID: importRecordID,
 			ModelType:      modelType,
-			ModelID:        modelID,
+			ModelID:        saved.ID,
 			Payload:        m,
 			Status:         "done",
-			Errors:         "",
+			Errors:         strings.Join(warnings, "; "),
 		})
 	}
 
-	log.Printf("[PROC][enf_proc][DONE] total=%d", len(batch))
+	log.Printf("[PROC][enf_proc][DONE] total=%d success=%d failed=%d status_changes=%d", len(batch), success, failed, statusChanges)
 
 	// ------------------------------------------------------------------
 	// Обновляем статус import_record
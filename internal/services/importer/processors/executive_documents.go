@@ -2,6 +2,7 @@ package processors
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"strings"
 
@@ -9,6 +10,7 @@ import (
 	"debtster_import/internal/ports"
 	"debtster_import/internal/repository/database"
 	importitems "debtster_import/internal/repository/imports"
+	"debtster_import/internal/validation"
 
 	"github.com/google/uuid"
 )
@@ -17,10 +19,18 @@ type ExecutiveDocumentsProcessor struct {
 	*BaseProcessor
 	ExecDocsRepo *database.ExecutiveDocumentsRepo
 	DebtsRepo    *database.DebtsRepo
+
+	// Strict — отклонять строки, для которых не найден долг (иначе debt_id=NULL
+	// с предупреждением). Включается также опцией импорта strict=true.
+	Strict bool
 }
 
 func (p ExecutiveDocumentsProcessor) Type() string { return "import_executive_documents" }
 
+// OrderSensitive — батчи по одному: при повторе документа (долг, тип, серия) в файле
+// побеждает последняя строка.
+func (p ExecutiveDocumentsProcessor) OrderSensitive() bool { return true }
+
 func (p *ExecutiveDocumentsProcessor) ProcessBatch(ctx context.Context, batch []map[string]string) error {
 	if err := CheckDeps(p); err != nil {
 		return err
@@ -42,7 +52,16 @@ func (p *ExecutiveDocumentsProcessor) ProcessBatch(ctx context.Context, batch []
 
 	modelType := "executive_documents"
 
-	log.Printf("[PROC][exec_docs][START] rows=%d import_record_id=%s", len(batch), importRecordID)
+	strict := p.Strict || ports.ImportFlag(ctx, "strict")
+
+	log.Printf("[PROC][exec_docs][START] rows=%d import_record_id=%s strict=%t", len(batch), importRecordID, strict)
+
+	debtIDs, err := p.DebtsRepo.ResolveDebtIDs(ctx, columnValues(batch, "debt_number"))
+	if err != nil {
+		return fmt.Errorf("resolve debts: %w", err)
+	}
+
+	created, updated, failed := 0, 0, 0
 
 	// -----------------------------
 	// Обработка строк
@@ -54,20 +73,32 @@ func (p *ExecutiveDocumentsProcessor) ProcessBatch(ctx context.Context, batch []
 		v := func(key string) string { return strings.TrimSpace(m[key]) }
 
 		// --------------------------------------------------------
-		// debt_number → debt_id
+		// debt_number → debt_id (strict: без долга строка отклоняется)
 		// --------------------------------------------------------
 		var debtUUID *string
-		if dn := strings.ReplaceAll(v("debt_number"), " ", ""); dn != "" {
-			if du, err := p.DebtsRepo.GetIDByNumber(ctx, dn); err == nil {
-				debtUUID = du
-				if du == nil {
-					warnings = append(warnings, "debt not found: "+dn+" -> debt_id=NULL")
-				}
+		var debtErr string
+		if dn := validation.NormalizeDebtNumber(v("debt_number")); dn != "" {
+			if du, ok := debtIDs[dn]; ok {
+				debtUUID = &du
 			} else {
-				warnings = append(warnings, "debt lookup error: "+err.Error()+" -> debt_id=NULL")
+				debtErr = "debt not found: " + dn
 			}
 		} else {
-			warnings = append(warnings, "missing debt_number -> debt_id=NULL")
+			debtErr = "missing debt_number"
+		}
+		if debtErr != "" {
+			if strict {
+				failed++
+				importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+					ImportRecordID: importRecordID,
+					ModelType:      modelType,
+					ModelID:        modelID,
+					Payload:        m,
+					Errors:         debtErr,
+				})
+				continue
+			}
+			warnings = append(warnings, debtErr+" -> debt_id=NULL")
 		}
 
 		// --------------------------------------------------------
@@ -75,6 +106,7 @@ func (p *ExecutiveDocumentsProcessor) ProcessBatch(ctx context.Context, batch []
 		// --------------------------------------------------------
 		docType := v("executive_document_type")
 		if docType == "" {
+			failed++
 			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
 				ImportRecordID: importRecordID,
 				ModelType:      modelType,
@@ -92,34 +124,55 @@ func (p *ExecutiveDocumentsProcessor) ProcessBatch(ctx context.Context, batch []
 			warnings = append(warnings, "document_has_estate provided but column absent -> ignored")
 		}
 
+		// --------------------------------------------------------
+		// Отмена документа
+		// --------------------------------------------------------
+		var isCanceled *bool
+		if raw := v("executive_document_is_canceled"); raw != "" {
+			b := boolLoose(raw)
+			isCanceled = &b
+		}
+		cancellationDate := parseDateStrict(v("executive_document_cancellation_date"))
+		if cancellationDate == nil && v("executive_document_cancellation_date") != "" {
+			warnings = append(warnings, "bad executive_document_cancellation_date -> ignored")
+		}
+
+		amount := ""
+		if raw := v("executive_document_amount"); raw != "" {
+			amount = normalizeAmount(raw)
+		}
+
 		// --------------------------------------------------------
 		// Формируем модель
 		// --------------------------------------------------------
 		doc := models.ExecutiveDocument{
-			ID:                      modelID,
-			DocType:                 docType,
-			SerialNumber:            nullIfEmpty(v("executive_document_serial_number")),
-			DebtID:                  debtUUID,
-			Amount:                  normalizeAmount(v("executive_document_amount")),
-			StartDate:               parseDateStrict(v("executive_document_start_date")),
-			StatusCourt:             nullIfEmpty(v("executive_document_status_court")),
-			IssuingAuthority:        nullIfEmpty(v("executive_document_issuing_authority")),
-			IssuePlace:              nullIfEmpty(v("executive_document_issue_place")),
-			IssueDate:               parseDateStrict(v("executive_document_issue_date")),
-			CreditorReplacement:     nullIfEmpty(v("executive_document_creditor_replacement")),
-			IsCanceled:              boolLoose(v("executive_document_is_canceled")),
-			CancellationNumber:      nullIfEmpty(v("executive_document_cancellation_number")),
-			CancellationDateVarchar: nullIfEmpty(v("executive_document_cancellation_date")),
-			LawyerReceivedAt:        parseDateStrict(v("executive_document_lawyer_received_at")),
-			PrivateBailiffRecvAt:    parseDateStrict(v("executive_document_private_bailiff_received_at")),
-			DVPTransferredAt:        parseDateStrict(v("executive_document_dvp_transferred_at")),
+			ID:                   modelID,
+			DocType:              docType,
+			SerialNumber:         nullIfEmpty(v("executive_document_serial_number")),
+			DebtID:               debtUUID,
+			Amount:               amount,
+			StartDate:            parseDateStrict(v("executive_document_start_date")),
+			StatusCourt:          nullIfEmpty(v("executive_document_status_court")),
+			IssuingAuthority:     nullIfEmpty(v("executive_document_issuing_authority")),
+			IssuePlace:           nullIfEmpty(v("executive_document_issue_place")),
+			IssueDate:            parseDateStrict(v("executive_document_issue_date")),
+			CreditorReplacement:  nullIfEmpty(v("executive_document_creditor_replacement")),
+			IsCanceled:           isCanceled,
+			CancellationNumber:   nullIfEmpty(v("executive_document_cancellation_number")),
+			CancellationDate:     cancellationDate,
+			LawyerReceivedAt:     parseDateStrict(v("executive_document_lawyer_received_at")),
+			PrivateBailiffRecvAt: parseDateStrict(v("executive_document_private_bailiff_received_at")),
+			DVPTransferredAt:     parseDateStrict(v("executive_document_dvp_transferred_at")),
 		}
 
 		// --------------------------------------------------------
-		// Создание записи
+		// Создание или обновление по (debt_id, type, serial_number);
+		// без долга или без серии ключ тот же, с пустым значением
 		// --------------------------------------------------------
-		if err := p.ExecDocsRepo.Create(ctx, doc); err != nil {
-			log.Printf("[PROC][exec_docs][WARN] row=%d insert failed: %v", i, err)
+		docID, isNew, err := p.ExecDocsRepo.UpdateOrCreate(ctx, doc)
+		if err != nil {
+			failed++
+			log.Printf("[PROC][exec_docs][WARN] row=%d upsert failed: %v", i, err)
 
 			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
 				ImportRecordID: importRecordID,
@@ -134,17 +187,22 @@ func (p *ExecutiveDocumentsProcessor) ProcessBatch(ctx context.Context, batch []
 		// --------------------------------------------------------
 		// Успешный лог
 		// --------------------------------------------------------
+		if isNew {
+			created++
+		} else {
+			updated++
+		}
 		importitems.LogMongo(ctx, p.MG, importitems.LogParams{
 			ImportRecordID: importRecordID,
 			ModelType:      modelType,
-			ModelID:        modelID,
+			ModelID:        docID,
 			Payload:        m,
 			Status:         "done",
 			Errors:         strings.Join(warnings, "; "),
 		})
 	}
 
-	log.Printf("[PROC][exec_docs][DONE] total=%d", len(batch))
+	log.Printf("[PROC][exec_docs][DONE] total=%d created=%d updated=%d failed=%d", len(batch), created, updated, failed)
 
 	// -----------------------------
 	// Обновление статуса import_record
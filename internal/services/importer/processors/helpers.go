@@ -1,10 +1,13 @@
 package processors
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"strings"
 	"time"
+
+	"debtster_import/internal/ports"
 )
 
 func firstNonEmpty(s, def string) string {
@@ -90,3 +93,29 @@ func nowPtr() *time.Time {
 	t := time.Now()
 	return &t
 }
+
+// bulkLoad — грузить ли батч через COPY во временную таблицу. По умолчанию
+// решает тип импорта (def), опция bulk=true/false переопределяет.
+func bulkLoad(ctx context.Context, def bool) bool {
+	switch strings.ToLower(ports.ImportOption(ctx, "bulk")) {
+	case "1", "true", "yes", "y", "on":
+		return true
+	case "0", "false", "no", "n", "off":
+		return false
+	}
+	return def
+}
+
+// columnValues — непустые значения колонок keys по всему батчу: ключи для
+// пакетного разрешения (ResolveDebtIDs, ResolveUserIDs…) до цикла по строкам.
+func columnValues(batch []map[string]string, keys ...string) []string {
+	out := make([]string, 0, len(batch))
+	for _, m := range batch {
+		for _, k := range keys {
+			if v := strings.TrimSpace(m[k]); v != "" {
+				out = append(out, v)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,106 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"debtster_import/internal/models"
+	"debtster_import/internal/ports"
+	"debtster_import/internal/repository/database"
+)
+
+// dutyComponents — судебные и прочие расходы, которые гасятся первыми.
+var dutyComponents = []string{
+	"government_duty",
+	"representation_expenses",
+	"notary_fees",
+	"postage",
+}
+
+// defaultAllocationOrder — порядок погашения по умолчанию:
+// расходы → пеня → вознаграждение → основной долг.
+var defaultAllocationOrder = append(append([]string{}, dutyComponents...), "fine", "accrual", "main_debt")
+
+// allocationOrder читает порядок погашения из опции импорта allocation_order,
+// например "duties,fine,accrual,main_debt". Пустое значение — порядок по умолчанию.
+func allocationOrder(ctx context.Context) ([]string, error) {
+	raw := ports.ImportOption(ctx, "allocation_order")
+	if raw == "" {
+		return defaultAllocationOrder, nil
+	}
+
+	known := make(map[string]bool, len(models.PaymentComponents))
+	for _, c := range models.PaymentComponents {
+		known[c] = true
+	}
+
+	seen := make(map[string]bool)
+	order := make([]string, 0, len(models.PaymentComponents))
+	add := func(c string) {
+		if !seen[c] {
+			seen[c] = true
+			order = append(order, c)
+		}
+	}
+
+	for _, part := range strings.Split(raw, ",") {
+		name := strings.ToLower(strings.TrimSpace(part))
+		name = strings.TrimPrefix(name, "amount_")
+		switch {
+		case name == "":
+			continue
+		case name == "duties":
+			for _, c := range dutyComponents {
+				add(c)
+			}
+		case known[name]:
+			add(name)
+		default:
+			return nil, fmt.Errorf("unknown allocation component %q", part)
+		}
+	}
+	if len(order) == 0 {
+		return defaultAllocationOrder, nil
+	}
+	return order, nil
+}
+
+// hasPaymentSplit — в файле указана хотя бы одна ненулевая составляющая платежа.
+func hasPaymentSplit(pay *models.Payment) bool {
+	for _, c := range models.PaymentComponents {
+		if v, err := strconv.ParseFloat(*pay.Component(c), 64); err == nil && v != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// allocatePayment распределяет amount по остаткам долга в заданном порядке.
+// Возвращает разбивку и нераспределённый остаток (переплату).
+func allocatePayment(amount float64, balance database.DebtBalance, order []string) (map[string]float64, float64) {
+	split := make(map[string]float64, len(order))
+	rest := amount
+	for _, c := range order {
+		if rest <= 0 {
+			break
+		}
+		part := math.Min(rest, math.Max(balance[c], 0))
+		if part <= 0 {
+			continue
+		}
+		part = math.Round(part*100) / 100
+		split[c] = part
+		rest = math.Round((rest-part)*100) / 100
+	}
+	return split, rest
+}
+
+// applySplit записывает разбивку в поля платежа; незатронутые составляющие обнуляются.
+func applySplit(pay *models.Payment, split map[string]float64) {
+	for _, c := range models.PaymentComponents {
+		*pay.Component(c) = strconv.FormatFloat(split[c], 'f', 2, 64)
+	}
+}
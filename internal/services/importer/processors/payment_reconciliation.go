@@ -0,0 +1,292 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"debtster_import/internal/ports"
+	"debtster_import/internal/repository/database"
+	importitems "debtster_import/internal/repository/imports"
+	"debtster_import/internal/validation"
+)
+
+// paymentMatcher находит существующий платёж по строке реестра банка:
+// по external_id, либо по debt_number + username + amount +
+// amount_after_subtraction + payment_date.
+type paymentMatcher struct {
+	pay *database.PaymentRepo
+
+	// debtIDs / userIDs — долги и пользователи батча, разрешённые заранее.
+	debtIDs map[string]string
+	userIDs map[string]int64
+}
+
+// newPaymentMatcher разрешает номера долгов и логины батча одним запросом.
+func newPaymentMatcher(
+	ctx context.Context,
+	pay *database.PaymentRepo,
+	debts *database.DebtsRepo,
+	users *database.UserRepo,
+	batch []map[string]string,
+) (paymentMatcher, error) {
+	debtIDs, err := debts.ResolveDebtIDs(ctx, columnValues(batch, "debt_number"))
+	if err != nil {
+		return paymentMatcher{}, fmt.Errorf("resolve debts: %w", err)
+	}
+	userIDs, err := users.ResolveUserIDs(ctx, columnValues(batch, "username"))
+	if err != nil {
+		return paymentMatcher{}, fmt.Errorf("resolve users: %w", err)
+	}
+	return paymentMatcher{pay: pay, debtIDs: debtIDs, userIDs: userIDs}, nil
+}
+
+func (pm paymentMatcher) find(ctx context.Context, m map[string]string) (string, string) {
+	v := func(key string) string { return strings.TrimSpace(m[key]) }
+
+	if ext := v("external_id"); ext != "" {
+		id, err := pm.pay.FindID(ctx, database.PaymentKey{ExternalID: ext})
+		if err != nil {
+			return "", "payment lookup error: " + err.Error()
+		}
+		if id == nil {
+			return "", "payment not found by external_id: " + ext
+		}
+		return *id, ""
+	}
+
+	debtNumber := validation.NormalizeDebtNumber(v("debt_number"))
+	if debtNumber == "" {
+		return "", "missing external_id or debt_number"
+	}
+	debtID, ok := pm.debtIDs[debtNumber]
+	if !ok {
+		return "", "debt not found: " + debtNumber
+	}
+
+	username := v("username")
+	if username == "" {
+		return "", "missing username"
+	}
+	userID, ok := pm.userIDs[username]
+	if !ok {
+		return "", "username not found: " + username
+	}
+
+	paymentDate := parseDateStrict(v("payment_date"))
+	if paymentDate == nil {
+		return "", "bad payment_date"
+	}
+
+	amount := normalizeAmount(v("amount"))
+	if _, err := strconv.ParseFloat(amount, 64); err != nil || amount == "0" {
+		return "", "missing/zero amount"
+	}
+
+	id, err := pm.pay.FindID(ctx, naturalPaymentKey(m, debtID, userID, amount, paymentDate))
+	if err != nil {
+		return "", "payment lookup error: " + err.Error()
+	}
+	if id == nil {
+		return "", "payment not found: " + debtNumber + " " + amount + " " + paymentDate.Format("2006-01-02")
+	}
+	return *id, ""
+}
+
+// naturalPaymentKey — естественный ключ платежа из строки реестра. Суммы
+// приводятся так же, как при загрузке (add_payments): пустая
+// amount_after_subtraction — "0", в базе она совпадает и с 0, и с NULL
+// у старых платежей.
+func naturalPaymentKey(m map[string]string, debtID string, userID int64, amount string, paymentDate *time.Time) database.PaymentKey {
+	return database.PaymentKey{
+		DebtID:                 debtID,
+		UserID:                 strconv.FormatInt(userID, 10),
+		Amount:                 amount,
+		AmountAfterSubtraction: normalizeAmount(m["amount_after_subtraction"]),
+		PaymentDate:            paymentDate,
+	}
+}
+
+// ------------------------------------------------------------
+// confirm_payments
+// ------------------------------------------------------------
+
+// ConfirmPaymentsProcessor подтверждает платежи по реестру банка.
+// С опцией apply_balance подтверждённый платёж уменьшает остатки долга,
+// если ещё не был к ним применён.
+type ConfirmPaymentsProcessor struct {
+	*BaseProcessor
+	PayRepo   *database.PaymentRepo
+	DebtsRepo *database.DebtsRepo
+	UserRepo  *database.UserRepo
+}
+
+func (p ConfirmPaymentsProcessor) Type() string { return "confirm_payments" }
+
+func (p *ConfirmPaymentsProcessor) ProcessBatch(ctx context.Context, batch []map[string]string) error {
+	if err := CheckDeps(p); err != nil {
+		return err
+	}
+
+	var importRecordID string
+	if v := ctx.Value(ports.CtxImportRecordID); v != nil {
+		if s, ok := v.(string); ok {
+			importRecordID = strings.TrimSpace(s)
+		}
+	}
+
+	applyBalance := ports.ImportFlag(ctx, "apply_balance")
+	matcher, err := newPaymentMatcher(ctx, p.PayRepo, p.DebtsRepo, p.UserRepo, batch)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[PROC][confirm_payments][START] rows=%d import_record_id=%s apply_balance=%v",
+		len(batch), importRecordID, applyBalance)
+
+	confirmed, unchanged := 0, 0
+	for _, m := range batch {
+		id, errMsg := matcher.find(ctx, m)
+		if errMsg != "" {
+			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+				ImportRecordID: importRecordID,
+				ModelType:      "payments",
+				Payload:        m,
+				Errors:         errMsg,
+			})
+			continue
+		}
+
+		res, err := p.PayRepo.Confirm(ctx, id, applyBalance)
+		if err != nil {
+			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+				ImportRecordID: importRecordID,
+				ModelType:      "payments",
+				ModelID:        id,
+				Payload:        m,
+				Errors:         err.Error(),
+			})
+			continue
+		}
+
+		item := importitems.LogParams{
+			ImportRecordID: importRecordID,
+			ModelType:      "payments",
+			ModelID:        id,
+			Payload:        m,
+			Status:         "done",
+		}
+		if res.Unchanged {
+			unchanged++
+			item.Errors = "already confirmed"
+		} else {
+			confirmed++
+		}
+		if res.Before != nil {
+			item.Details = map[string]any{
+				"balance_before": res.Before,
+				"balance_after":  res.After,
+			}
+		}
+		importitems.LogMongo(ctx, p.MG, item)
+	}
+
+	log.Printf("[PROC][confirm_payments][DONE] total=%d confirmed=%d unchanged=%d", len(batch), confirmed, unchanged)
+
+	if err := importitems.UpdateImportRecordStatusDone(ctx, p.MG, importRecordID); err != nil {
+		log.Printf("[PROC][confirm_payments][ERR] error change status: %v", err)
+	}
+	return nil
+}
+
+// ------------------------------------------------------------
+// reverse_payments
+// ------------------------------------------------------------
+
+// ReversePaymentsProcessor сторнирует платежи по реестру возвратов банка:
+// создаёт компенсирующую запись и возвращает остатки долга.
+type ReversePaymentsProcessor struct {
+	*BaseProcessor
+	PayRepo   *database.PaymentRepo
+	DebtsRepo *database.DebtsRepo
+	UserRepo  *database.UserRepo
+}
+
+func (p ReversePaymentsProcessor) Type() string { return "reverse_payments" }
+
+func (p *ReversePaymentsProcessor) ProcessBatch(ctx context.Context, batch []map[string]string) error {
+	if err := CheckDeps(p); err != nil {
+		return err
+	}
+
+	var importRecordID string
+	if v := ctx.Value(ports.CtxImportRecordID); v != nil {
+		if s, ok := v.(string); ok {
+			importRecordID = strings.TrimSpace(s)
+		}
+	}
+
+	matcher, err := newPaymentMatcher(ctx, p.PayRepo, p.DebtsRepo, p.UserRepo, batch)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[PROC][reverse_payments][START] rows=%d import_record_id=%s", len(batch), importRecordID)
+
+	reversed, unchanged := 0, 0
+	for _, m := range batch {
+		id, errMsg := matcher.find(ctx, m)
+		if errMsg != "" {
+			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+				ImportRecordID: importRecordID,
+				ModelType:      "payments",
+				Payload:        m,
+				Errors:         errMsg,
+			})
+			continue
+		}
+
+		res, err := p.PayRepo.Reverse(ctx, id, parseDateStrict(m["reversal_date"]))
+		if err != nil {
+			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+				ImportRecordID: importRecordID,
+				ModelType:      "payments",
+				ModelID:        id,
+				Payload:        m,
+				Errors:         err.Error(),
+			})
+			continue
+		}
+
+		item := importitems.LogParams{
+			ImportRecordID: importRecordID,
+			ModelType:      "payments",
+			ModelID:        id,
+			Payload:        m,
+			Status:         "done",
+		}
+		if res.Unchanged {
+			unchanged++
+			item.Errors = "already reversed"
+		} else {
+			reversed++
+			details := map[string]any{"reversal_id": res.ReversalID}
+			if res.Before != nil {
+				details["balance_before"] = res.Before
+				details["balance_after"] = res.After
+			}
+			item.Details = details
+		}
+		importitems.LogMongo(ctx, p.MG, item)
+	}
+
+	log.Printf("[PROC][reverse_payments][DONE] total=%d reversed=%d unchanged=%d", len(batch), reversed, unchanged)
+
+	if err := importitems.UpdateImportRecordStatusDone(ctx, p.MG, importRecordID); err != nil {
+		log.Printf("[PROC][reverse_payments][ERR] error change status: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"debtster_import/internal/repository/database"
+)
+
+func TestNaturalPaymentKey(t *testing.T) {
+	date := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		row  map[string]string
+		want string
+	}{
+		{"empty cell matches zero and legacy NULL", map[string]string{"amount_after_subtraction": ""}, "0"},
+		{"missing column matches zero and legacy NULL", map[string]string{}, "0"},
+		{"spaces only", map[string]string{"amount_after_subtraction": "  "}, "0"},
+		{"spaces and decimal comma", map[string]string{"amount_after_subtraction": " 1 000,50 "}, "1000.50"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := naturalPaymentKey(tt.row, "debt-1", 42, "100", &date)
+			want := database.PaymentKey{
+				DebtID: "debt-1", UserID: "42", Amount: "100",
+				AmountAfterSubtraction: tt.want, PaymentDate: &date,
+			}
+			if got != want {
+				t.Fatalf("key = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
@@ -6,9 +6,15 @@ import (
 	"debtster_import/internal/ports"
 	"debtster_import/internal/repository/database"
 	importitems "debtster_import/internal/repository/imports"
+	"debtster_import/internal/services/agreements"
+	"debtster_import/internal/validation"
+	"fmt"
 	"log"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -18,9 +24,28 @@ type PaymentsProcessor struct {
 	PayRepo   *database.PaymentRepo
 	DebtsRepo *database.DebtsRepo
 	UserRepo  *database.UserRepo
+
+	// Compliance — сверка графиков соглашений по долгам с новыми платежами
+	// (nil — не выполняется; опция skip_agreement_check отключает для импорта).
+	Compliance *agreements.Checker
+
+	// Bulk — загружать батч через COPY (опция импорта bulk переопределяет;
+	// на режим allocate не влияет).
+	Bulk bool
+
+	// paidDebts — долги с новыми платежами по import_record_id; соглашения по
+	// ним сверяются один раз в Finish, когда загружен весь файл.
+	mu        sync.Mutex
+	paidDebts map[string]map[string]bool
+}
+
+type preparedPayment struct {
+	id      string
+	payment models.Payment
+	payload map[string]string
 }
 
-func (p PaymentsProcessor) Type() string { return "add_payments" }
+func (p *PaymentsProcessor) Type() string { return "add_payments" }
 
 func (p *PaymentsProcessor) ProcessBatch(ctx context.Context, batch []map[string]string) error {
 	if err := CheckDeps(p); err != nil {
@@ -49,19 +74,36 @@ func (p *PaymentsProcessor) ProcessBatch(ctx context.Context, batch []map[string
 
 	log.Printf("[PROC][payments][START] rows=%d import_record_id=%s", len(batch), importRecordID)
 
+	prepared := make([]preparedPayment, 0, len(batch))
+
+	purposePattern, err := debtNumberPattern(ctx)
+	if err != nil {
+		return err
+	}
+
 	// -----------------------------------------
-	// Кэши
+	// Пакетное разрешение номеров долгов и логинов
 	// -----------------------------------------
-	debtCache := make(map[string]*string)
-	userCache := make(map[string]*int64)
-
-	type preparedRow struct {
-		id      string
-		payment models.Payment
-		payload map[string]string
+	numbers := columnValues(batch, "debt_number")
+	for _, m := range batch {
+		if strings.TrimSpace(m["debt_number"]) == "" {
+			numbers = append(numbers, purposeCandidates(m["payment_purpose"], purposePattern)...)
+		}
+	}
+	debtIDs, err := p.DebtsRepo.ResolveDebtIDs(ctx, numbers)
+	if err != nil {
+		return fmt.Errorf("resolve debts: %w", err)
 	}
 
-	prepared := make([]preparedRow, 0, len(batch))
+	defaultUsername := ports.ImportOption(ctx, "username")
+	usernames := columnValues(batch, "username")
+	if defaultUsername != "" {
+		usernames = append(usernames, defaultUsername)
+	}
+	userIDs, err := p.UserRepo.ResolveUserIDs(ctx, usernames)
+	if err != nil {
+		return fmt.Errorf("resolve users: %w", err)
+	}
 
 	// -----------------------------------------
 	// 1. Валидация и подготовка записей
@@ -70,8 +112,24 @@ func (p *PaymentsProcessor) ProcessBatch(ctx context.Context, batch []map[string
 		id := uuid.NewString()
 		v := func(key string) string { return strings.TrimSpace(m[key]) }
 
+		// запись выписки, которую не удалось разобрать
+		if rowErr := v(ports.RowError); rowErr != "" {
+			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+				ImportRecordID: importRecordID,
+				ModelType:      "payments",
+				ModelID:        id,
+				Payload:        m,
+				Errors:         rowErr,
+			})
+			continue
+		}
+
 		// ---------------------- debt ----------------------
-		debtNumber := v("debt_number")
+		debtNumber := validation.NormalizeDebtNumber(v("debt_number"))
+		if debtNumber == "" {
+			// банковская выписка: номер договора ищется в назначении платежа
+			debtNumber = debtNumberFromPurpose(v("payment_purpose"), purposePattern, debtIDs)
+		}
 		if debtNumber == "" {
 			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
 				ImportRecordID: importRecordID,
@@ -83,32 +141,20 @@ func (p *PaymentsProcessor) ProcessBatch(ctx context.Context, batch []map[string
 			continue
 		}
 
-		var debtUUID *string
-		if cached, ok := debtCache[debtNumber]; ok {
-			debtUUID = cached
-		} else {
-			var err error
-			debtUUID, err = p.DebtsRepo.GetIDByNumber(ctx, debtNumber)
-			if err != nil || debtUUID == nil {
-				msg := "debt not found: " + debtNumber
-				if err != nil {
-					msg += " (" + err.Error() + ")"
-				}
-
-				importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
-					ImportRecordID: importRecordID,
-					ModelType:      "payments",
-					ModelID:        id,
-					Payload:        m,
-					Errors:         msg,
-				})
-				continue
-			}
-			debtCache[debtNumber] = debtUUID
+		debtID, ok := debtIDs[debtNumber]
+		if !ok {
+			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+				ImportRecordID: importRecordID,
+				ModelType:      "payments",
+				ModelID:        id,
+				Payload:        m,
+				Errors:         "debt not found: " + debtNumber,
+			})
+			continue
 		}
 
 		// ---------------------- user ----------------------
-		username := v("username")
+		username := firstNonEmpty(v("username"), defaultUsername)
 		if username == "" {
 			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
 				ImportRecordID: importRecordID,
@@ -120,28 +166,16 @@ func (p *PaymentsProcessor) ProcessBatch(ctx context.Context, batch []map[string
 			continue
 		}
 
-		var userID *int64
-		if cached, ok := userCache[username]; ok {
-			userID = cached
-		} else {
-			var err error
-			userID, err = p.UserRepo.GetUserBigint(ctx, username)
-			if err != nil || userID == nil {
-				msg := "username not found: " + username
-				if err != nil {
-					msg += " (" + err.Error() + ")"
-				}
-
-				importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
-					ImportRecordID: importRecordID,
-					ModelType:      "payments",
-					ModelID:        id,
-					Payload:        m,
-					Errors:         msg,
-				})
-				continue
-			}
-			userCache[username] = userID
+		userID, ok := userIDs[username]
+		if !ok {
+			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+				ImportRecordID: importRecordID,
+				ModelType:      "payments",
+				ModelID:        id,
+				Payload:        m,
+				Errors:         "username not found: " + username,
+			})
+			continue
 		}
 
 		// ---------------------- date ----------------------
@@ -172,9 +206,10 @@ func (p *PaymentsProcessor) ProcessBatch(ctx context.Context, batch []map[string
 
 		// ---------------------- model ----------------------
 		pay := models.Payment{
-			ID:     id,
-			DebtID: *debtUUID,
-			UserID: strconv.FormatInt(*userID, 10),
+			ID:         id,
+			ExternalID: v("external_id"),
+			DebtID:     debtID,
+			UserID:     strconv.FormatInt(userID, 10),
 
 			Amount:                       amount,
 			AmountAfterSubtraction:       normalizeAmount(v("amount_after_subtraction")),
@@ -191,7 +226,7 @@ func (p *PaymentsProcessor) ProcessBatch(ctx context.Context, batch []map[string
 			Confirmed:   false,
 		}
 
-		prepared = append(prepared, preparedRow{id: id, payment: pay, payload: m})
+		prepared = append(prepared, preparedPayment{id: id, payment: pay, payload: m})
 	}
 
 	if len(prepared) == 0 {
@@ -199,6 +234,19 @@ func (p *PaymentsProcessor) ProcessBatch(ctx context.Context, batch []map[string
 		return nil
 	}
 
+	// -----------------------------------------
+	// 2a. Режим распределения: платёж и остатки долга в одной транзакции
+	// -----------------------------------------
+	if ports.ImportFlag(ctx, "allocate") {
+		if err := p.applyPayments(ctx, importRecordID, prepared); err != nil {
+			return err
+		}
+		if err := importitems.UpdateImportRecordStatusDone(ctx, p.MG, importRecordID); err != nil {
+			log.Printf("[PROC][payments][ERR] error change status: %v", err)
+		}
+		return nil
+	}
+
 	// -----------------------------------------
 	// 2. Сохраняем батч
 	// -----------------------------------------
@@ -207,43 +255,266 @@ func (p *PaymentsProcessor) ProcessBatch(ctx context.Context, batch []map[string
 		payments[i] = pr.payment
 	}
 
-	errs := p.PayRepo.CreateBatch(ctx, payments)
+	bulk := bulkLoad(ctx, p.Bulk)
+
+	var errs []error
+	if bulk {
+		errs = p.PayRepo.CopyBatch(ctx, payments)
+	} else {
+		errs = p.PayRepo.CreateBatch(ctx, payments)
+	}
 
 	// -----------------------------------------
 	// 3. Логирование результатов
 	// -----------------------------------------
 	inserted := 0
+	paidDebts := make([]string, 0, len(prepared))
+	results := make([]importitems.LogParams, 0, len(prepared))
 	for i, pr := range prepared {
+		item := importitems.LogParams{
+			ImportRecordID: importRecordID,
+			ModelType:      "payments",
+			ModelID:        pr.id,
+			Payload:        pr.payload,
+			Status:         "done",
+			Errors:         "",
+		}
 		if errs != nil && errs[i] != nil {
+			item.Status = "failed"
+			item.Errors = errs[i].Error()
+		} else {
+			inserted++
+			paidDebts = append(paidDebts, pr.payment.DebtID)
+		}
+
+		if bulk {
+			results = append(results, item)
+		} else {
+			importitems.LogMongo(ctx, p.MG, item)
+		}
+	}
+	importitems.LogMongoMany(ctx, p.MG, results)
+
+	log.Printf("[PROC][payments][DONE] total=%d inserted=%d bulk=%t", len(prepared), inserted, bulk)
+
+	p.rememberPaidDebts(ctx, paidDebts)
+
+	// -----------------------------------------
+	// update import_record
+	// -----------------------------------------
+	if err := importitems.UpdateImportRecordStatusDone(ctx, p.MG, importRecordID); err != nil {
+		log.Printf("[PROC][payments][ERR] error change status: %v", err)
+	}
+
+	return nil
+}
+
+// applyPayments проводит платежи по одному: если разбивка в файле не указана,
+// сумма распределяется по остаткам долга в порядке allocation_order,
+// затем остатки debts.amount_* уменьшаются. В элементе импорта сохраняются
+// балансы до и после.
+func (p *PaymentsProcessor) applyPayments(ctx context.Context, importRecordID string, prepared []preparedPayment) error {
+	order, err := allocationOrder(ctx)
+	if err != nil {
+		return err
+	}
+
+	applied, skipped := 0, 0
+	paidDebts := make([]string, 0, len(prepared))
+	for _, pr := range prepared {
+		pay := pr.payment
+		var warnings []string
+		var split map[string]float64
+
+		allocate := func(balance database.DebtBalance) error {
+			if hasPaymentSplit(&pay) {
+				return nil
+			}
+			amount, err := strconv.ParseFloat(pay.Amount, 64)
+			if err != nil {
+				return fmt.Errorf("bad amount %q", pay.Amount)
+			}
+			var rest float64
+			split, rest = allocatePayment(amount, balance, order)
+			applySplit(&pay, split)
+			if rest > 0 {
+				warnings = append(warnings, "overpayment "+strconv.FormatFloat(rest, 'f', 2, 64)+" not allocated")
+			}
+			return nil
+		}
+
+		before, after, inserted, err := p.PayRepo.ApplyPayment(ctx, &pay, allocate)
+		if err != nil {
 			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
 				ImportRecordID: importRecordID,
 				ModelType:      "payments",
 				ModelID:        pr.id,
 				Payload:        pr.payload,
-				Errors:         errs[i].Error(),
+				Errors:         err.Error(),
 			})
 			continue
 		}
+		if !inserted {
+			skipped++
+			warnings = append(warnings, "duplicate payment, balance unchanged")
+		} else {
+			applied++
+			paidDebts = append(paidDebts, pay.DebtID)
+		}
+
+		details := map[string]any{
+			"balance_before": before,
+			"balance_after":  after,
+		}
+		if split != nil {
+			details["allocation"] = split
+		}
 
-		inserted++
 		importitems.LogMongo(ctx, p.MG, importitems.LogParams{
 			ImportRecordID: importRecordID,
 			ModelType:      "payments",
 			ModelID:        pr.id,
 			Payload:        pr.payload,
 			Status:         "done",
-			Errors:         "",
+			Errors:         strings.Join(warnings, "; "),
+			Details:        details,
 		})
 	}
 
-	log.Printf("[PROC][payments][DONE] total=%d inserted=%d", len(prepared), inserted)
+	log.Printf("[PROC][payments][DONE] total=%d applied=%d duplicates=%d", len(prepared), applied, skipped)
 
-	// -----------------------------------------
-	// update import_record
-	// -----------------------------------------
-	if err := importitems.UpdateImportRecordStatusDone(ctx, p.MG, importRecordID); err != nil {
-		log.Printf("[PROC][payments][ERR] error change status: %v", err)
+	p.rememberPaidDebts(ctx, paidDebts)
+	return nil
+}
+
+// rememberPaidDebts запоминает долги с новыми платежами до Finish: платежи
+// по графику могут прийти в следующих (или параллельных) батчах файла.
+func (p *PaymentsProcessor) rememberPaidDebts(ctx context.Context, debtIDs []string) {
+	if p.Compliance == nil || len(debtIDs) == 0 {
+		return
+	}
+	importRecordID, _ := ctx.Value(ports.CtxImportRecordID).(string)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.paidDebts == nil {
+		p.paidDebts = make(map[string]map[string]bool)
+	}
+	set := p.paidDebts[importRecordID]
+	if set == nil {
+		set = make(map[string]bool)
+		p.paidDebts[importRecordID] = set
+	}
+	for _, id := range debtIDs {
+		set[id] = true
+	}
+}
+
+// Finish сверяет графики соглашений по долгам, на которые пришли платежи,
+// один раз после загрузки всего файла. Если чтение прервалось, файл загружен
+// не полностью — сверка не выполняется, чтобы не признать соглашение
+// нарушенным из-за платежей, которые не успели загрузиться.
+func (p *PaymentsProcessor) Finish(ctx context.Context, readErr error) error {
+	importRecordID, _ := ctx.Value(ports.CtxImportRecordID).(string)
+
+	p.mu.Lock()
+	set := p.paidDebts[importRecordID]
+	delete(p.paidDebts, importRecordID)
+	p.mu.Unlock()
+
+	if readErr != nil {
+		if len(set) > 0 {
+			log.Printf("[PROC][payments][WARN] agreement compliance skipped: import interrupted, debts=%d", len(set))
+		}
+		return nil
+	}
+	if p.Compliance == nil || len(set) == 0 || ports.ImportFlag(ctx, "skip_agreement_check") {
+		return nil
 	}
 
+	debtIDs := make([]string, 0, len(set))
+	for id := range set {
+		debtIDs = append(debtIDs, id)
+	}
+
+	chk := *p.Compliance
+	if ports.ImportFlag(ctx, "agreement_actions") {
+		chk.CreateActions = true
+	}
+	if _, err := chk.Run(ctx, debtIDs, time.Now()); err != nil {
+		log.Printf("[PROC][payments][WARN] agreement compliance: %v", err)
+	}
 	return nil
 }
+
+// purposeToken — кандидат в номер договора внутри назначения платежа.
+var purposeToken = regexp.MustCompile(`[0-9A-Za-zА-Яа-яЁё][0-9A-Za-zА-Яа-яЁё/\-]{3,}`)
+
+const maxPurposeCandidates = 10
+
+// debtNumberPattern читает опцию импорта debt_number_pattern — регулярное
+// выражение, первая группа которого содержит номер договора.
+func debtNumberPattern(ctx context.Context) (*regexp.Regexp, error) {
+	raw := ports.ImportOption(ctx, "debt_number_pattern")
+	if raw == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(raw)
+	if err != nil {
+		return nil, fmt.Errorf("bad debt_number_pattern: %w", err)
+	}
+	return re, nil
+}
+
+// purposeCandidates — возможные номера договора в назначении платежа:
+// по debt_number_pattern, а без него — слова, содержащие цифры.
+func purposeCandidates(purpose string, pattern *regexp.Regexp) []string {
+	purpose = strings.TrimSpace(purpose)
+	if purpose == "" {
+		return nil
+	}
+
+	if pattern != nil {
+		if m := pattern.FindStringSubmatch(purpose); len(m) > 1 {
+			if n := validation.NormalizeDebtNumber(m[1]); n != "" {
+				return []string{n}
+			}
+		}
+		return nil
+	}
+
+	var out []string
+	for _, tok := range purposeToken.FindAllString(purpose, -1) {
+		if !strings.ContainsAny(tok, "0123456789") {
+			continue
+		}
+		if len(out) >= maxPurposeCandidates {
+			break
+		}
+		// Ключи known — номера после NormalizeDebtNumber, как и в ветке с паттерном.
+		if n := validation.NormalizeDebtNumber(strings.Trim(tok, "/-")); n != "" {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// debtNumberFromPurpose ищет в назначении платежа номер долга: по
+// debt_number_pattern, а без него — первое слово с цифрами, которое есть
+// среди найденных долгов known.
+func debtNumberFromPurpose(purpose string, pattern *regexp.Regexp, known map[string]string) string {
+	candidates := purposeCandidates(purpose, pattern)
+	if pattern != nil {
+		if len(candidates) > 0 {
+			return candidates[0]
+		}
+		return ""
+	}
+
+	for _, tok := range candidates {
+		if _, ok := known[tok]; ok {
+			return tok
+		}
+	}
+	return ""
+}
@@ -0,0 +1,153 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"debtster_import/internal/models"
+	"debtster_import/internal/ports"
+	"debtster_import/internal/repository/database"
+	importitems "debtster_import/internal/repository/imports"
+
+	"github.com/google/uuid"
+)
+
+// Типы телефонов, те же id что и в import_debtors (phones/work_phones/home_phones).
+var phoneTypeAliases = map[string]int{
+	"mobile": 1, "мобильный": 1,
+	"work": 2, "рабочий": 2,
+	"home": 3, "домашний": 3,
+}
+
+var debtorSubjectType = importitems.PHPModelMap[importitems.ModelTypeDebtors]
+
+// PhonesProcessor — телефоны должника без пересылки всей строки import_debtors.
+// Колонки: iin | debt_number, phone, phone_type, operation (add, replace_type, deactivate).
+type PhonesProcessor struct {
+	*BaseProcessor
+
+	DebtorsRepo *database.DebtorRepo
+	DebtsRepo   *database.DebtsRepo
+	PhonesRepo  *database.PhoneRepo
+
+	// PhoneTypesRepo — справочник phone_types для типов, заданных названием.
+	PhoneTypesRepo *database.ReferenceRepo
+}
+
+func (p PhonesProcessor) Type() string { return "import_phones" }
+
+// OrderSensitive — батчи по одному: операции над телефонами применяются в порядке файла.
+func (p PhonesProcessor) OrderSensitive() bool { return true }
+
+func (p *PhonesProcessor) ProcessBatch(ctx context.Context, batch []map[string]string) error {
+	if err := CheckDeps(p); err != nil {
+		return err
+	}
+
+	var importRecordID string
+	if v := ctx.Value(ports.CtxImportRecordID); v != nil {
+		if s, ok := v.(string); ok {
+			importRecordID = strings.TrimSpace(s)
+		}
+	}
+
+	modelType := importitems.PHPModelByTable(p.PhonesRepo.GetTableName())
+
+	log.Printf("[PROC][phones][START] rows=%d import_record_id=%s", len(batch), importRecordID)
+
+	lookup := newDebtorLookup(p.DebtorsRepo, p.DebtsRepo)
+	if err := lookup.prefetch(ctx, batch); err != nil {
+		return err
+	}
+	success, failed := 0, 0
+
+	for i, m := range batch {
+		modelID := uuid.NewString()
+		v := func(key string) string { return strings.TrimSpace(m[key]) }
+
+		fail := func(msg string) {
+			failed++
+			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+				ImportRecordID: importRecordID,
+				ModelType:      modelType,
+				ModelID:        modelID,
+				Payload:        m,
+				Errors:         msg,
+			})
+		}
+
+		op, ok := parseOperation(v("operation"))
+		if !ok {
+			fail("unknown operation: " + v("operation"))
+			continue
+		}
+
+		typeID, typeErr := resolveTypeID(ctx, v("phone_type"), phoneTypeAliases, 1, p.PhoneTypesRepo)
+		if typeErr != "" {
+			fail("phone_type: " + typeErr)
+			continue
+		}
+
+		raw := v("phone")
+		if raw == "" && op != opReplaceType {
+			fail("missing phone")
+			continue
+		}
+
+		debtorID, errMsg := lookup.resolve(ctx, m)
+		if errMsg != "" {
+			fail(errMsg)
+			continue
+		}
+
+		row := models.Phone{
+			SubjectType: debtorSubjectType,
+			SubjectID:   debtorID,
+			PhonesRaw:   raw,
+			TypeID:      &typeID,
+			CreatedAt:   nowPtr(),
+		}
+
+		var res database.PhonesResult
+		var err error
+		switch op {
+		case opAdd:
+			res, err = p.PhonesRepo.AddPhones(ctx, row)
+		case opReplaceType:
+			res, err = p.PhonesRepo.ReplaceType(ctx, row)
+		case opDeactivate:
+			res, err = p.PhonesRepo.Deactivate(ctx, row)
+		}
+		if err != nil {
+			log.Printf("[PROC][phones][ERR] row=%d op=%s err=%v", i, op, err)
+			fail(err.Error())
+			continue
+		}
+		if len(res.Invalid) > 0 && res.Added == 0 && res.Removed == 0 {
+			fail("invalid phone: " + strings.Join(res.Invalid, "; "))
+			continue
+		}
+
+		notes := append([]string{fmt.Sprintf("%s: added=%d deactivated=%d", op, res.Added, res.Removed)}, res.Invalid...)
+
+		success++
+		importitems.LogMongo(ctx, p.MG, importitems.LogParams{
+			ImportRecordID: importRecordID,
+			ModelType:      modelType,
+			ModelID:        debtorID,
+			Payload:        m,
+			Status:         "done",
+			Errors:         strings.Join(notes, "; "),
+		})
+	}
+
+	log.Printf("[PROC][phones][DONE] total=%d success=%d failed=%d", len(batch), success, failed)
+
+	if err := importitems.UpdateImportRecordStatusDone(ctx, p.MG, importRecordID); err != nil {
+		log.Printf("[PROC][phones][ERR] update import_record status: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,214 @@
+package processors
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+
+	"debtster_import/internal/models"
+	"debtster_import/internal/ports"
+	"debtster_import/internal/repository/database"
+	importitems "debtster_import/internal/repository/imports"
+)
+
+// strictReferences — опция strict_references: значения справочников
+// (контрагент, статус, тип соглашения, тип телефона/адреса) должны уже
+// существовать; новые записи не создаются, строка с неизвестным значением
+// отклоняется.
+func strictReferences(ctx context.Context) bool {
+	return ports.ImportFlag(ctx, "strict_references")
+}
+
+// upsertReference — создание или обновление одной записи справочника по строке файла.
+type upsertReference func(ctx context.Context, m map[string]string) (id int64, created bool, err error)
+
+// processReferences — общий цикл импортов справочников: строка за строкой
+// upsert, результат в import_items.
+func processReferences(
+	ctx context.Context,
+	base *BaseProcessor,
+	tag, modelType string,
+	batch []map[string]string,
+	upsert upsertReference,
+) error {
+	var importRecordID string
+	if v := ctx.Value(ports.CtxImportRecordID); v != nil {
+		if s, ok := v.(string); ok {
+			importRecordID = strings.TrimSpace(s)
+		}
+	}
+
+	log.Printf("[PROC][%s][START] rows=%d import_record_id=%s", tag, len(batch), importRecordID)
+
+	created, updated, failed := 0, 0, 0
+	for i, m := range batch {
+		id, isNew, err := upsert(ctx, m)
+		if err != nil {
+			failed++
+			log.Printf("[PROC][%s][WARN] row=%d: %v", tag, i, err)
+			importitems.LogMongoFail(ctx, base.MG, importitems.LogParams{
+				ImportRecordID: importRecordID,
+				ModelType:      modelType,
+				Payload:        m,
+				Errors:         err.Error(),
+			})
+			continue
+		}
+
+		if isNew {
+			created++
+		} else {
+			updated++
+		}
+		importitems.LogMongo(ctx, base.MG, importitems.LogParams{
+			ImportRecordID: importRecordID,
+			ModelType:      modelType,
+			ModelID:        strconv.FormatInt(id, 10),
+			Payload:        m,
+			Status:         "done",
+			Details:        map[string]any{"created": isNew},
+		})
+	}
+
+	log.Printf("[PROC][%s][DONE] total=%d created=%d updated=%d failed=%d", tag, len(batch), created, updated, failed)
+
+	if err := importitems.UpdateImportRecordStatusDone(ctx, base.MG, importRecordID); err != nil {
+		log.Printf("[PROC][%s][ERR] error change status: %v", tag, err)
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------
+// import_counterparties
+// ---------------------------------------------------------------------
+
+// CounterpartiesProcessor — справочник контрагентов.
+// Колонки: counterparty_name, counterparty_bin, counterparty_contract_number, counterparty_contract_date.
+type CounterpartiesProcessor struct {
+	*BaseProcessor
+
+	CounterpartiesRepo *database.CounterpartiesRepo
+}
+
+func (p CounterpartiesProcessor) Type() string { return "import_counterparties" }
+
+// OrderSensitive — батчи по одному: запись справочника ищется по названию
+// и создаётся, если не найдена.
+func (p CounterpartiesProcessor) OrderSensitive() bool { return true }
+
+func (p *CounterpartiesProcessor) ProcessBatch(ctx context.Context, batch []map[string]string) error {
+	if err := CheckDeps(p); err != nil {
+		return err
+	}
+	return processReferences(ctx, p.BaseProcessor, "counterparties", p.CounterpartiesRepo.GetTableName(), batch,
+		func(ctx context.Context, m map[string]string) (int64, bool, error) {
+			name := strings.TrimSpace(m["counterparty_name"])
+			bin := strings.ReplaceAll(strings.TrimSpace(m["counterparty_bin"]), " ", "")
+			if name == "" && bin == "" {
+				return 0, false, errors.New("missing counterparty_name and counterparty_bin")
+			}
+			if bin != "" && !isDigits(bin, 12) {
+				return 0, false, errors.New("bad counterparty_bin: " + bin)
+			}
+			if name == "" {
+				existing, err := p.CounterpartiesRepo.Resolve(ctx, bin)
+				if err != nil {
+					return 0, false, err
+				}
+				if existing == nil {
+					return 0, false, errors.New("missing counterparty_name for new counterparty " + bin)
+				}
+			}
+
+			contractDate := parseDateStrict(m["counterparty_contract_date"])
+			if raw := strings.TrimSpace(m["counterparty_contract_date"]); raw != "" && contractDate == nil {
+				return 0, false, errors.New("bad counterparty_contract_date: " + raw)
+			}
+
+			return p.CounterpartiesRepo.Upsert(ctx, models.Counterparty{
+				Name:           name,
+				BIN:            nullIfEmpty(bin),
+				ContractNumber: nullIfEmpty(strings.TrimSpace(m["counterparty_contract_number"])),
+				ContractDate:   contractDate,
+			})
+		})
+}
+
+// ---------------------------------------------------------------------
+// import_debt_statuses
+// ---------------------------------------------------------------------
+
+// DebtStatusesProcessor — справочник статусов долга.
+// Колонки: status_shortname, status_name.
+type DebtStatusesProcessor struct {
+	*BaseProcessor
+
+	DebtStatusesRepo *database.DebtStatusesRepo
+}
+
+func (p DebtStatusesProcessor) Type() string { return "import_debt_statuses" }
+
+// OrderSensitive — батчи по одному: запись справочника ищется по названию
+// и создаётся, если не найдена.
+func (p DebtStatusesProcessor) OrderSensitive() bool { return true }
+
+func (p *DebtStatusesProcessor) ProcessBatch(ctx context.Context, batch []map[string]string) error {
+	if err := CheckDeps(p); err != nil {
+		return err
+	}
+	return processReferences(ctx, p.BaseProcessor, "debt_statuses", "debt_statuses", batch,
+		func(ctx context.Context, m map[string]string) (int64, bool, error) {
+			shortname := strings.TrimSpace(m["status_shortname"])
+			if shortname == "" {
+				return 0, false, errors.New("missing status_shortname")
+			}
+			return p.DebtStatusesRepo.Upsert(ctx, shortname, strings.TrimSpace(m["status_name"]))
+		})
+}
+
+// ---------------------------------------------------------------------
+// import_agreement_types, import_phone_types, import_address_types
+// ---------------------------------------------------------------------
+
+// ReferenceProcessor — справочник вида (id, name). Колонка: name.
+// Существующие записи (по названию без учёта регистра) не дублируются.
+type ReferenceProcessor struct {
+	*BaseProcessor
+
+	ImportType string
+	Repo       *database.ReferenceRepo
+}
+
+func (p ReferenceProcessor) Type() string { return p.ImportType }
+
+// OrderSensitive — батчи по одному: запись справочника ищется по названию
+// и создаётся, если не найдена.
+func (p ReferenceProcessor) OrderSensitive() bool { return true }
+
+func (p *ReferenceProcessor) ProcessBatch(ctx context.Context, batch []map[string]string) error {
+	if err := CheckDeps(p); err != nil {
+		return err
+	}
+	return processReferences(ctx, p.BaseProcessor, p.Repo.GetTableName(), p.Repo.GetTableName(), batch,
+		func(ctx context.Context, m map[string]string) (int64, bool, error) {
+			name := strings.TrimSpace(m["name"])
+			if name == "" {
+				return 0, false, errors.New("missing name")
+			}
+			return p.Repo.GetOrCreate(ctx, name)
+		})
+}
+
+func isDigits(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,37 @@
+package processors
+
+import (
+	"context"
+	"fmt"
+
+	"debtster_import/internal/repository/database"
+	"debtster_import/internal/services/statuses"
+)
+
+// statusTransition проверяет смену статуса долга fromID -> toID по графу
+// переходов и возвращает shortname обоих статусов (from пустой, если у долга
+// статуса не было). Ошибка оборачивает statuses.ErrIllegalTransition, если
+// переход запрещён.
+func statusTransition(
+	ctx context.Context,
+	repo *database.DebtStatusesRepo,
+	graph *statuses.Graph,
+	fromID *int64,
+	toID int64,
+) (string, string, error) {
+	to, err := repo.GetShortname(ctx, toID)
+	if err != nil {
+		return "", "", fmt.Errorf("status %d lookup: %w", toID, err)
+	}
+	if fromID == nil {
+		return "", to, nil
+	}
+	from, err := repo.GetShortname(ctx, *fromID)
+	if err != nil {
+		return "", "", fmt.Errorf("status %d lookup: %w", *fromID, err)
+	}
+	if err := graph.Check(from, to); err != nil {
+		return from, to, err
+	}
+	return from, to, nil
+}
@@ -2,23 +2,91 @@ package processors
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"strconv"
 	"strings"
 	"time"
 
+	"debtster_import/internal/models"
 	"debtster_import/internal/ports"
+	"debtster_import/internal/repository/database"
 	importitems "debtster_import/internal/repository/imports"
+	"debtster_import/internal/services/statuses"
+	"debtster_import/internal/validation"
 
-	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 )
 
+type debtFieldKind int
+
+const (
+	debtFieldText debtFieldKind = iota
+	debtFieldDate
+	debtFieldAmount
+	debtFieldUser
+	debtFieldStatus
+	debtFieldCounterparty
+)
+
+// debtField — колонка файла update_debts и колонка debts, в которую она пишется.
+// clearable — поле можно обнулить значением-маркером (NULL или -).
+type debtField struct {
+	key       string
+	column    string
+	kind      debtFieldKind
+	clearable bool
+}
+
+// updatableDebtFields — единственный список полей, которые можно менять через update_debts.
+var updatableDebtFields = []debtField{
+	{key: "debt_status", column: "status_id", kind: debtFieldStatus},
+	{key: "debt_end_date", column: "end_date", kind: debtFieldDate, clearable: true},
+	{key: "debt_amount_actual_debt", column: "amount_actual_debt", kind: debtFieldAmount},
+	{key: "debt_amount_main_debt", column: "amount_main_debt", kind: debtFieldAmount},
+	{key: "debt_amount_fine", column: "amount_fine", kind: debtFieldAmount},
+	{key: "debt_amount_accrual", column: "amount_accrual", kind: debtFieldAmount},
+	{key: "debt_username", column: "user_id", kind: debtFieldUser, clearable: true},
+	{key: "debt_counterparty", column: "counterparty_id", kind: debtFieldCounterparty, clearable: true},
+	{key: "debt_currency", column: "amount_currency", kind: debtFieldText, clearable: true},
+}
+
+// isReference — значение поля берётся из справочника (strict_references).
+func (f debtField) isReference() bool {
+	return f.kind == debtFieldStatus || f.kind == debtFieldCounterparty
+}
+
+// isClearMarker — значение ячейки, означающее «очистить поле».
+func isClearMarker(raw string) bool {
+	return raw == "-" || strings.EqualFold(raw, "null")
+}
+
+// fieldChange — изменение одного поля долга, пишется в details элемента импорта.
+type fieldChange struct {
+	Old *string `bson:"old" json:"old"`
+	New *string `bson:"new" json:"new"`
+}
+
+var errDebtNotFound = errors.New("debt not found")
+
 type UpdateDebtsProcessor struct {
 	*BaseProcessor
+
+	UserRepo           *database.UserRepo
+	DebtStatusesRepo   *database.DebtStatusesRepo
+	CounterpartiesRepo *database.CounterpartiesRepo
+	ActionsRepo        *database.ActionRepo
+
+	// Transitions — допустимые переходы статусов; nil — без ограничений.
+	Transitions *statuses.Graph
 }
 
 func (p UpdateDebtsProcessor) Type() string { return "update_debts" }
 
+// OrderSensitive — батчи по одному: следующая строка по тому же долгу должна видеть результат предыдущей.
+func (p UpdateDebtsProcessor) OrderSensitive() bool { return true }
+
 func (p UpdateDebtsProcessor) ProcessBatch(ctx context.Context, batch []map[string]string) error {
 	if err := CheckDeps(p); err != nil {
 		return err
@@ -34,10 +102,25 @@ func (p UpdateDebtsProcessor) ProcessBatch(ctx context.Context, batch []map[stri
 	debtsTable := "debts"
 	log.Printf("[PROC][update_debts][START] rows=%d import_record_id=%s", len(batch), importRecordID)
 
-	updated := 0
+	strict := strictReferences(ctx)
+	updated, unchanged := 0, 0
+
+	// Логины и статусы батча разрешаются одним запросом и попадают в кэши
+	// репозиториев, которые использует resolveDebtField.
+	if p.UserRepo != nil {
+		if _, err := p.UserRepo.ResolveUserIDs(ctx, columnValues(batch, "debt_username")); err != nil {
+			return fmt.Errorf("resolve users: %w", err)
+		}
+	}
+	if p.DebtStatusesRepo != nil {
+		if _, err := p.DebtStatusesRepo.ResolveStatusIDs(ctx, columnValues(batch, "debt_status")); err != nil {
+			return fmt.Errorf("resolve statuses: %w", err)
+		}
+	}
 
+rows:
 	for i, m := range batch {
-		debtNumber := strings.TrimSpace(strings.ReplaceAll(m["debt_number"], " ", ""))
+		debtNumber := validation.NormalizeDebtNumber(m["debt_number"])
 		if debtNumber == "" {
 			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
 				ImportRecordID: importRecordID,
@@ -49,106 +132,352 @@ func (p UpdateDebtsProcessor) ProcessBatch(ctx context.Context, batch []map[stri
 			continue
 		}
 
-		setParts := make([]string, 0)
-		args := make([]any, 0)
-		argIdx := 1
-
-		appendSet := func(col string, val any) {
-			setParts = append(setParts, col+"=$"+strconv.Itoa(argIdx))
-			args = append(args, val)
-			argIdx++
-		}
-
-		// ---------- SAFE CASTS ----------
-		if v := strings.TrimSpace(m["debt_status"]); v != "" {
-			appendSet("status_id", v)
-		}
-		if v := strings.TrimSpace(m["debt_end_date"]); v != "" {
-			appendSet("end_date", parseDateStrict(v))
-		}
-		if v := strings.TrimSpace(m["debt_amount_actual_debt"]); v != "" {
-			appendSet("amount_actual_debt", normalizeAmount(v))
-		}
-		if v := strings.TrimSpace(m["debt_amount_main_debt"]); v != "" {
-			appendSet("amount_main_debt", normalizeAmount(v))
-		}
-		if v := strings.TrimSpace(m["debt_amount_fine"]); v != "" {
-			appendSet("amount_fine", normalizeAmount(v))
-		}
-		if v := strings.TrimSpace(m["debt_amount_accrual"]); v != "" {
-			appendSet("amount_accrual", normalizeAmount(v))
-		}
-		if v := strings.TrimSpace(m["debt_username"]); v != "" {
-			if _, err := uuid.Parse(v); err == nil {
-				appendSet("user_id", v)
+		// ------------------------------------------------------------
+		// 1. Разбор значений файла
+		// ------------------------------------------------------------
+		var (
+			fields   []debtField
+			values   []any
+			warnings []string
+		)
+		for _, f := range updatableDebtFields {
+			raw := strings.TrimSpace(m[f.key])
+			if raw == "" {
+				continue
 			}
-		}
-		if v := strings.TrimSpace(m["debt_counterparty"]); v != "" {
-			if _, err := uuid.Parse(v); err == nil {
-				appendSet("counterparty_id", v)
+			if isClearMarker(raw) {
+				if !f.clearable {
+					warnings = append(warnings, f.key+": field can not be cleared -> skipped")
+					continue
+				}
+				fields = append(fields, f)
+				values = append(values, nil)
+				continue
 			}
-		}
-		if v := strings.TrimSpace(m["debt_currency"]); v != "" {
-			appendSet("currency", v)
+			val, warn, err := p.resolveDebtField(ctx, f, raw)
+			if err != nil {
+				// ошибка базы — не «значение не найдено», строку не применяем
+				log.Printf("[PROC][update_debts][ERR] row=%d %s lookup: %v", i, f.key, err)
+				importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+					ImportRecordID: importRecordID,
+					ModelType:      debtsTable,
+					ModelID:        "",
+					Payload:        m,
+					Errors:         f.key + ": lookup error: " + err.Error(),
+				})
+				continue rows
+			}
+			if warn != "" && strict && f.isReference() {
+				importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+					ImportRecordID: importRecordID,
+					ModelType:      debtsTable,
+					ModelID:        "",
+					Payload:        m,
+					Errors:         f.key + ": " + warn,
+				})
+				continue rows
+			}
+			if warn != "" {
+				warnings = append(warnings, f.key+": "+warn+" -> skipped")
+				continue
+			}
+			fields = append(fields, f)
+			values = append(values, val)
 		}
 
-		if len(setParts) == 0 {
+		if len(fields) == 0 {
+			errText := "no updatable fields found"
+			if len(warnings) > 0 {
+				errText += ": " + strings.Join(warnings, "; ")
+			}
 			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
 				ImportRecordID: importRecordID,
 				ModelType:      debtsTable,
 				ModelID:        "",
 				Payload:        m,
-				Errors:         "no updatable fields found",
+				Errors:         errText,
 			})
 			continue
 		}
 
-		query := `UPDATE ` + debtsTable + ` SET ` + strings.Join(setParts, ", ") +
-			`, updated_at=$` + strconv.Itoa(argIdx) +
-			` WHERE number=$` + strconv.Itoa(argIdx+1)
-		args = append(args, time.Now(), debtNumber)
-
-		ct, err := p.PG.Pool.Exec(ctx, query, args...)
-		if err != nil {
-			importitems.LogMongo(ctx, p.MG, importitems.LogParams{
+		// ------------------------------------------------------------
+		// 2. Сравнение с текущей строкой и UPDATE только изменённых полей
+		// ------------------------------------------------------------
+		debtID, diff, err := p.applyDebtUpdate(ctx, debtsTable, debtNumber, fields, values, importRecordID)
+		if errors.Is(err, errDebtNotFound) {
+			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
 				ImportRecordID: importRecordID,
 				ModelType:      debtsTable,
 				ModelID:        "",
 				Payload:        m,
-				Status:         "failed",
-				Errors:         err.Error(),
+				Errors:         "debt not found: " + debtNumber,
 			})
-			log.Printf("[PROC][update_debts][WARN] row=%d update failed: %v", i, err)
+			log.Printf("[PROC][update_debts][MISS] row=%d debt_number=%s not found", i, debtNumber)
 			continue
 		}
-
-		if ct.RowsAffected() == 0 {
+		if err != nil {
 			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
 				ImportRecordID: importRecordID,
 				ModelType:      debtsTable,
-				ModelID:        "",
+				ModelID:        debtID,
 				Payload:        m,
-				Errors:         "debt not found: " + debtNumber,
+				Errors:         err.Error(),
 			})
-			log.Printf("[PROC][update_debts][MISS] row=%d debt_number=%s not found", i, debtNumber)
+			log.Printf("[PROC][update_debts][WARN] row=%d update failed: %v", i, err)
 			continue
 		}
 
-		updated++
-		importitems.LogMongo(ctx, p.MG, importitems.LogParams{
+		if len(diff) == 0 {
+			unchanged++
+		} else {
+			updated++
+		}
+
+		item := importitems.LogParams{
 			ImportRecordID: importRecordID,
 			ModelType:      debtsTable,
-			ModelID:        "",
+			ModelID:        debtID,
 			Payload:        m,
 			Status:         "done",
-			Errors:         "",
-		})
+			Errors:         strings.Join(warnings, "; "),
+		}
+		if len(diff) > 0 {
+			item.Details = map[string]any{"changes": diff}
+		}
+		importitems.LogMongo(ctx, p.MG, item)
 	}
 
-	log.Printf("[PROC][update_debts][DONE] total=%d updated=%d", len(batch), updated)
+	log.Printf("[PROC][update_debts][DONE] total=%d updated=%d unchanged=%d", len(batch), updated, unchanged)
 
 	if err := importitems.UpdateImportRecordStatusDone(ctx, p.MG, importRecordID); err != nil {
 		log.Printf("[PROC][update_debts][ERR] error change status: %v", err)
 	}
 	return nil
 }
+
+// applyDebtUpdate блокирует строку долга, сравнивает текущие значения с новыми
+// и обновляет только отличающиеся поля. Если отличий нет, UPDATE не выполняется
+// и updated_at не меняется. Смена user_id пишется в историю назначений,
+// смена status_id проверяется по графу переходов и пишется действием-аудитом.
+func (p UpdateDebtsProcessor) applyDebtUpdate(
+	ctx context.Context,
+	table, debtNumber string,
+	fields []debtField,
+	values []any,
+	importRecordID string,
+) (string, map[string]fieldChange, error) {
+	tx, err := p.PG.Pool.Begin(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	cols := make([]string, 0, len(fields)+1)
+	cols = append(cols, "id::text")
+	for _, f := range fields {
+		cols = append(cols, f.column+"::text")
+	}
+
+	var debtID string
+	current := make([]*string, len(fields))
+	dest := make([]any, 0, len(fields)+1)
+	dest = append(dest, &debtID)
+	for i := range current {
+		dest = append(dest, &current[i])
+	}
+
+	err = tx.QueryRow(ctx,
+		`SELECT `+strings.Join(cols, ", ")+` FROM `+table+` WHERE number = $1 FOR UPDATE`,
+		debtNumber,
+	).Scan(dest...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil, errDebtNotFound
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	diff := make(map[string]fieldChange)
+	setParts := make([]string, 0, len(fields))
+	args := make([]any, 0, len(fields)+2)
+	for i, f := range fields {
+		newText := debtValueText(values[i])
+		if sameDebtValue(f.kind, current[i], newText) {
+			continue
+		}
+		diff[f.column] = fieldChange{Old: current[i], New: newText}
+		args = append(args, values[i])
+		setParts = append(setParts, f.column+"=$"+strconv.Itoa(len(args)))
+	}
+
+	if len(setParts) == 0 {
+		return debtID, nil, nil
+	}
+
+	var audit []models.Action
+	if sc, ok := diff["status_id"]; ok && sc.New != nil {
+		toID, _ := strconv.ParseInt(*sc.New, 10, 64)
+		var fromID *int64
+		if sc.Old != nil {
+			if v, err := strconv.ParseInt(*sc.Old, 10, 64); err == nil {
+				fromID = &v
+			}
+		}
+		from, to, err := statusTransition(ctx, p.DebtStatusesRepo, p.Transitions, fromID, toID)
+		if err != nil {
+			return debtID, nil, err
+		}
+		audit = append(audit, statuses.ChangeAction(debtID, toID, from, to, p.Type()))
+	}
+
+	userChange, userChanged := diff["user_id"]
+	if userChanged {
+		setParts = append(setParts, "user_assigned_at=(NOW() AT TIME ZONE 'Asia/Almaty')")
+	}
+
+	args = append(args, time.Now(), debtID)
+	_, err = tx.Exec(ctx,
+		`UPDATE `+table+` SET `+strings.Join(setParts, ", ")+
+			`, updated_at=$`+strconv.Itoa(len(args)-1)+
+			` WHERE id=$`+strconv.Itoa(len(args)),
+		args...,
+	)
+	if err != nil {
+		return debtID, nil, err
+	}
+
+	if userChanged {
+		_, err = tx.Exec(ctx,
+			`INSERT INTO `+database.AssignmentHistoryTable+`
+			   (debt_id, previous_user_id, new_user_id, import_record_id, reason, assigned_at)
+			 VALUES ($1::uuid, $2::bigint, $3::bigint, NULLIF($4, ''), $5, NOW())`,
+			debtID, userChange.Old, userChange.New, importRecordID, p.Type(),
+		)
+		if err != nil {
+			return debtID, nil, err
+		}
+	}
+
+	if len(audit) > 0 && p.ActionsRepo != nil {
+		if err := p.ActionsRepo.InsertActionsTx(ctx, tx, audit); err != nil {
+			return debtID, nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return debtID, nil, err
+	}
+	return debtID, diff, nil
+}
+
+// debtValueText — текстовое представление нового значения для сравнения и дифа.
+func debtValueText(v any) *string {
+	var s string
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case *time.Time:
+		if t == nil {
+			return nil
+		}
+		s = t.Format("2006-01-02")
+	case int64:
+		s = strconv.FormatInt(t, 10)
+	case string:
+		s = t
+	default:
+		return nil
+	}
+	return &s
+}
+
+func sameDebtValue(kind debtFieldKind, cur, next *string) bool {
+	if cur == nil || next == nil {
+		return cur == nil && next == nil
+	}
+	switch kind {
+	case debtFieldAmount:
+		a, errA := strconv.ParseFloat(*cur, 64)
+		b, errB := strconv.ParseFloat(*next, 64)
+		if errA == nil && errB == nil {
+			return a == b
+		}
+	case debtFieldDate:
+		if len(*cur) >= 10 {
+			return (*cur)[:10] == *next
+		}
+	}
+	return *cur == *next
+}
+
+// resolveDebtField приводит значение ячейки к значению колонки debts.
+// Непустой warn означает, что поле нужно пропустить (значение неверное или
+// не найдено); err — ошибка обращения к базе.
+func (p UpdateDebtsProcessor) resolveDebtField(ctx context.Context, f debtField, raw string) (any, string, error) {
+	switch f.kind {
+	case debtFieldDate:
+		d := parseDateStrict(raw)
+		if d == nil {
+			return nil, "bad date " + raw, nil
+		}
+		return d, "", nil
+
+	case debtFieldAmount:
+		v := normalizeAmount(raw)
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			return nil, "bad amount " + raw, nil
+		}
+		return v, "", nil
+
+	case debtFieldUser:
+		if p.UserRepo == nil {
+			return nil, "user lookup not configured", nil
+		}
+		uid, err := p.UserRepo.GetUserBigint(ctx, raw)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, "", err
+		}
+		if uid == nil {
+			return nil, "username not found: " + raw, nil
+		}
+		return *uid, "", nil
+
+	case debtFieldStatus:
+		if p.DebtStatusesRepo == nil {
+			return nil, "status lookup not configured", nil
+		}
+		sid, err := p.DebtStatusesRepo.GetStatusBigint(ctx, raw)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, "", err
+		}
+		if sid != nil {
+			return *sid, "", nil
+		}
+		// как и раньше, принимается id статуса
+		if id, perr := strconv.ParseInt(raw, 10, 64); perr == nil {
+			_, err := p.DebtStatusesRepo.GetShortname(ctx, id)
+			if err == nil {
+				return id, "", nil
+			}
+			if !errors.Is(err, pgx.ErrNoRows) {
+				return nil, "", err
+			}
+		}
+		return nil, "status not found: " + raw, nil
+
+	case debtFieldCounterparty:
+		if p.CounterpartiesRepo == nil {
+			return nil, "counterparty lookup not configured", nil
+		}
+		cid, err := p.CounterpartiesRepo.Resolve(ctx, raw)
+		if err != nil {
+			return nil, "", err
+		}
+		if cid == nil {
+			return nil, "counterparty not found: " + raw, nil
+		}
+		return *cid, "", nil
+	}
+
+	return raw, "", nil
+}
@@ -3,6 +3,7 @@ package processors
 import (
 	"context"
 	"debtster_import/internal/models"
+	"fmt"
 	"log"
 	"strconv"
 	"strings"
@@ -23,6 +24,9 @@ type UserPlansProcessor struct {
 
 func (p UserPlansProcessor) Type() string { return "import_user_plans" }
 
+// OrderSensitive — батчи по одному: план пользователя обновляется последней строкой файла.
+func (p UserPlansProcessor) OrderSensitive() bool { return true }
+
 func (p *UserPlansProcessor) ProcessBatch(ctx context.Context, batch []map[string]string) error {
 	if err := CheckDeps(p); err != nil {
 		return err
@@ -40,6 +44,11 @@ func (p *UserPlansProcessor) ProcessBatch(ctx context.Context, batch []map[strin
 	success, failed := 0, 0
 	modelType := "user_plans" // можно заменить на importitems.PHPModelByTable при необходимости
 
+	userIDs, err := p.UserRepo.ResolveUserIDs(ctx, columnValues(batch, "username"))
+	if err != nil {
+		return fmt.Errorf("resolve users: %w", err)
+	}
+
 	for i, m := range batch {
 
 		modelID := uuid.NewString()
@@ -60,22 +69,19 @@ func (p *UserPlansProcessor) ProcessBatch(ctx context.Context, batch []map[strin
 			continue
 		}
 
-		uid, err := p.UserRepo.GetUserBigint(ctx, username)
-		if err != nil || uid == nil {
+		userID, ok := userIDs[username]
+		if !ok {
 			failed++
-			msg := "username not found: " + username
-			if err != nil {
-				msg += " (" + err.Error() + ")"
-			}
 			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
 				ImportRecordID: importRecordID,
 				ModelType:      modelType,
 				ModelID:        modelID,
 				Payload:        m,
-				Errors:         msg,
+				Errors:         "username not found: " + username,
 			})
 			continue
 		}
+		uid := &userID
 
 		// --------------------------------
 		// 2. amount
@@ -0,0 +1,179 @@
+package processors
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"debtster_import/internal/models"
+	"debtster_import/internal/ports"
+	"debtster_import/internal/repository/database"
+	importitems "debtster_import/internal/repository/imports"
+	"debtster_import/internal/validation"
+
+	"github.com/google/uuid"
+)
+
+// workPhoneTypeID — тип телефона "рабочий", как в import_debtors (work_phones).
+const workPhoneTypeID = 2
+
+type WorkplacesProcessor struct {
+	*BaseProcessor
+
+	DebtorsRepo    *database.DebtorRepo
+	DebtsRepo      *database.DebtsRepo
+	WorkplacesRepo *database.WorkplaceRepo
+	PhonesRepo     *database.PhoneRepo
+}
+
+func (p WorkplacesProcessor) Type() string { return "import_workplaces" }
+
+func (p *WorkplacesProcessor) ProcessBatch(ctx context.Context, batch []map[string]string) error {
+	if err := CheckDeps(p); err != nil {
+		return err
+	}
+
+	var importRecordID string
+	if v := ctx.Value(ports.CtxImportRecordID); v != nil {
+		if s, ok := v.(string); ok {
+			importRecordID = strings.TrimSpace(s)
+		}
+	}
+
+	modelType := importitems.PHPModelByTable(p.WorkplacesRepo.GetTableName())
+
+	log.Printf("[PROC][workplaces][START] rows=%d import_record_id=%s", len(batch), importRecordID)
+
+	lookup := newDebtorLookup(p.DebtorsRepo, p.DebtsRepo)
+	if err := lookup.prefetch(ctx, batch); err != nil {
+		return err
+	}
+	success, failed := 0, 0
+
+	for i, m := range batch {
+		modelID := uuid.NewString()
+
+		// ----------------------------------------------------
+		// 1. Должник по ИИН (или debt_number)
+		// ----------------------------------------------------
+		debtorID, errMsg := lookup.resolve(ctx, m)
+		if errMsg != "" {
+			failed++
+			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+				ImportRecordID: importRecordID,
+				ModelType:      modelType,
+				ModelID:        modelID,
+				Payload:        m,
+				Errors:         errMsg,
+			})
+			continue
+		}
+
+		// ----------------------------------------------------
+		// 2. Место работы + телефон
+		// ----------------------------------------------------
+		wp, ok := workplaceFromRow(m, debtorID)
+		if !ok {
+			failed++
+			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+				ImportRecordID: importRecordID,
+				ModelType:      modelType,
+				ModelID:        modelID,
+				Payload:        m,
+				Errors:         "missing workplace_name",
+			})
+			continue
+		}
+
+		workplaceID, warnings, err := saveWorkplace(ctx, p.WorkplacesRepo, p.PhonesRepo, wp)
+		if err != nil {
+			failed++
+			log.Printf("[PROC][workplaces][ERR] row=%d debtor_id=%s err=%v", i, debtorID, err)
+			importitems.LogMongoFail(ctx, p.MG, importitems.LogParams{
+				ImportRecordID: importRecordID,
+				ModelType:      modelType,
+				ModelID:        modelID,
+				Payload:        m,
+				Errors:         err.Error(),
+			})
+			continue
+		}
+
+		success++
+		importitems.LogMongo(ctx, p.MG, importitems.LogParams{
+			ImportRecordID: importRecordID,
+			ModelType:      modelType,
+			ModelID:        workplaceID,
+			Payload:        m,
+			Status:         "done",
+			Errors:         strings.Join(warnings, "; "),
+		})
+	}
+
+	log.Printf("[PROC][workplaces][DONE] total=%d success=%d failed=%d", len(batch), success, failed)
+
+	if err := importitems.UpdateImportRecordStatusDone(ctx, p.MG, importRecordID); err != nil {
+		log.Printf("[PROC][workplaces][ERR] update import_record status: %v", err)
+	}
+
+	return nil
+}
+
+// workplaceFromRow собирает место работы из колонок workplace_*.
+// Адрес по умолчанию берётся из work_address (формат import_debtors).
+// ok=false, если нет названия работодателя.
+func workplaceFromRow(m map[string]string, debtorID string) (models.WorkPlace, bool) {
+	v := func(key string) string { return strings.TrimSpace(m[key]) }
+
+	name := strings.Join(strings.Fields(v("workplace_name")), " ")
+	if name == "" {
+		return models.WorkPlace{}, false
+	}
+
+	return models.WorkPlace{
+		Name:     name,
+		Position: v("workplace_position"),
+		UIN:      v("workplace_uin"),
+		Address:  firstNonEmpty(v("workplace_address"), v("work_address")),
+		Phone:    v("workplace_phone"),
+		DebtorID: debtorID,
+	}, true
+}
+
+// saveWorkplace сохраняет место работы и привязывает его телефон через phones.
+// Ошибка телефона не роняет строку и возвращается предупреждением.
+func saveWorkplace(ctx context.Context, wpRepo *database.WorkplaceRepo, phRepo *database.PhoneRepo, wp models.WorkPlace) (string, []string, error) {
+	var warnings []string
+
+	if wp.UIN != "" {
+		if bin, err := validation.NormalizeBIN(wp.UIN); err != nil {
+			warnings = append(warnings, "workplace_uin: "+err.Error())
+		} else {
+			wp.UIN = bin
+		}
+	}
+
+	id, err := wpRepo.Upsert(ctx, wp)
+	if err != nil {
+		return "", warnings, err
+	}
+
+	if wp.Phone != "" && phRepo != nil {
+		typeID := workPhoneTypeID
+		res, err := phRepo.AddPhones(ctx, models.Phone{
+			SubjectType: importitems.PHPModelMap[importitems.ModelTypeWorkPlaces],
+			SubjectID:   id,
+			PhonesRaw:   wp.Phone,
+			TypeID:      &typeID,
+			CreatedAt:   nowPtr(),
+		})
+		if err != nil {
+			warnings = append(warnings, "workplace phone: "+err.Error())
+		}
+		for _, inv := range res.Invalid {
+			warnings = append(warnings, "workplace phone: "+inv)
+		}
+	}
+
+	return id, warnings, nil
+}
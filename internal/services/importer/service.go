@@ -3,9 +3,7 @@ package importer
 import (
 	"bufio"
 	"context"
-	"crypto/sha256"
 	"encoding/csv"
-	"encoding/hex"
 	"errors"
 	"io"
 	"log"
@@ -25,6 +23,8 @@ type Request struct {
 	FilePath       string
 	BatchSize      int
 	ImportRecordID string
+	SHA256         string
+	Options        map[string]string
 }
 
 type Result struct {
@@ -43,6 +43,15 @@ type Service struct {
 	Opener     ports.FileOpener
 	Processors map[string]ports.Processor
 	DefaultBS  int
+
+	// TmpDir — каталог для временных копий файлов ("" — os.TempDir()).
+	TmpDir string
+	// Budget — общий для всех импортов лимит оценочной памяти: ограничивает, сколько
+	// импортов идёт одновременно, но не память одного импорта; nil — без ограничений.
+	Budget *MemoryBudget
+	// Workers — сколько батчей одного импорта обрабатывать одновременно
+	// (0 или 1 — последовательно).
+	Workers int
 }
 
 func NewService(opener ports.FileOpener, registry map[string]ports.Processor, defaultBatch int) *Service {
@@ -56,6 +65,7 @@ func (s *Service) Import(ctx context.Context, req Request) (Result, error) {
 	log.Printf("%v", req.ImportRecordID)
 	t0 := time.Now()
 	ctx = context.WithValue(ctx, ports.CtxImportRecordID, req.ImportRecordID)
+	ctx = context.WithValue(ctx, ports.CtxImportOptions, req.Options)
 	log.Printf("[IMP][START] type=%q path=%q batch_size=%d import_record_id=%q", req.Type, req.FilePath, req.BatchSize, req.ImportRecordID)
 
 	proc, ok := s.Processors[req.Type]
@@ -74,8 +84,35 @@ func (s *Service) Import(ctx context.Context, req Request) (Result, error) {
 	format := detectFormat(req.FilePath, meta.ContentType)
 	log.Printf("[IMP] source=%s content_type=%q size=%d detected_format=%s", meta.Source, meta.ContentType, meta.Size, format)
 
-	hasher := sha256.New()
-	tee := io.TeeReader(rc, hasher)
+	// ---------------------------------------------------------------------
+	// Скачиваем во временный файл: с диска можно повторно открыть источник
+	// при fallback на другой формат. Память это не экономит — excelize всё
+	// равно читает zip целиком (OpenFile и OpenReader делают io.ReadAll),
+	// потоково идут только строки листа (Rows).
+	// ---------------------------------------------------------------------
+	expectedSHA := firstNonEmpty(req.SHA256, meta.SHA256)
+	spool, err := spoolToTemp(ctx, rc, s.TmpDir, expectedSHA)
+	if err != nil {
+		log.Printf("[IMP][ERR] spool: %v", err)
+		return Result{}, err
+	}
+	defer spool.Remove()
+	_ = rc.Close()
+
+	// Банковские выписки приходят как .txt/.sta без надёжного content-type.
+	if format != "xlsx" {
+		if sf := sniffStatementFormat(spool); sf != "" {
+			log.Printf("[IMP] statement format detected: %s", sf)
+			format = sf
+		}
+	}
+
+	release, err := s.Budget.Acquire(ctx, estimateMemory(format, spool.Size))
+	if err != nil {
+		log.Printf("[IMP][ERR] memory budget: %v", err)
+		return Result{}, err
+	}
+	defer release()
 
 	batchSize := req.BatchSize
 	if batchSize <= 0 {
@@ -86,32 +123,35 @@ func (s *Service) Import(ctx context.Context, req Request) (Result, error) {
 	var readErr error
 
 	switch format {
+	case formatMT940, format1C:
+		log.Printf("[IMP] using %s statement reader", format)
+		total, readErr = s.streamStatement(ctx, spool, format, proc, batchSize)
 	case "xlsx":
 		log.Printf("[IMP] using XLSX first-sheet reader")
-		total, readErr = s.streamXLSXFirstSheet(ctx, tee, proc, batchSize)
+		total, readErr = s.streamXLSXFirstSheet(ctx, spool.Path, proc, batchSize)
 		if readErr != nil {
 			log.Printf("[IMP][XLSX][ERR] %v — fallback to CSV", readErr)
-			total, readErr = s.streamCSV(ctx, tee, proc, batchSize)
+			total, readErr = s.streamCSVFile(ctx, spool, proc, batchSize)
 			if readErr == nil {
 				format = "csv"
 			}
 		}
 	case "csv":
 		log.Printf("[IMP] using CSV reader")
-		total, readErr = s.streamCSV(ctx, tee, proc, batchSize)
+		total, readErr = s.streamCSVFile(ctx, spool, proc, batchSize)
 		if readErr != nil {
 			log.Printf("[IMP][CSV][ERR] %v — fallback to XLSX", readErr)
-			total, readErr = s.streamXLSXFirstSheet(ctx, tee, proc, batchSize)
+			total, readErr = s.streamXLSXFirstSheet(ctx, spool.Path, proc, batchSize)
 			if readErr == nil {
 				format = "xlsx"
 			}
 		}
 	default:
 		log.Printf("[IMP] unknown format — try XLSX then CSV")
-		total, readErr = s.streamXLSXFirstSheet(ctx, tee, proc, batchSize)
+		total, readErr = s.streamXLSXFirstSheet(ctx, spool.Path, proc, batchSize)
 		if readErr != nil {
 			log.Printf("[IMP][XLSX][ERR] %v — fallback to CSV", readErr)
-			total, readErr = s.streamCSV(ctx, tee, proc, batchSize)
+			total, readErr = s.streamCSVFile(ctx, spool, proc, batchSize)
 			if readErr == nil {
 				format = "csv"
 			}
@@ -120,28 +160,43 @@ func (s *Service) Import(ctx context.Context, req Request) (Result, error) {
 		}
 	}
 
+	if f, ok := proc.(ports.Finisher); ok {
+		if err := f.Finish(ctx, readErr); err != nil && readErr == nil {
+			log.Printf("[IMP][ERR] finish: %v", err)
+			return Result{}, err
+		}
+	}
+
 	if readErr != nil {
 		log.Printf("[IMP][ERR] read pipeline: %v", readErr)
 		return Result{}, readErr
 	}
 
-	sum := hex.EncodeToString(hasher.Sum(nil))
 	dur := time.Since(t0)
-	log.Printf("[IMP][DONE] type=%q fmt=%s rows=%d sha256=%s duration=%s", req.Type, format, total, sum, dur)
+	log.Printf("[IMP][DONE] type=%q fmt=%s rows=%d sha256=%s duration=%s", req.Type, format, total, spool.SHA256, dur)
 
 	return Result{
 		Source:           meta.Source,
 		FilePath:         req.FilePath,
 		Format:           format,
 		RowsProcessed:    total,
-		SHA256FirstChunk: sum,
+		SHA256FirstChunk: spool.SHA256,
 		ContentType:      meta.ContentType,
 		Bucket:           meta.Bucket,
 		Key:              meta.Key,
-		SizeBytes:        meta.Size,
+		SizeBytes:        spool.Size,
 	}, nil
 }
 
+func (s *Service) streamCSVFile(ctx context.Context, spool *spooledFile, proc ports.Processor, batchSize int) (int, error) {
+	f, err := spool.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return s.streamCSV(ctx, f, proc, batchSize)
+}
+
 func (s *Service) streamCSV(ctx context.Context, r io.Reader, proc ports.Processor, batchSize int) (int, error) {
 	start := time.Now()
 	reader := csv.NewReader(bufio.NewReader(r))
@@ -156,19 +211,21 @@ func (s *Service) streamCSV(ctx context.Context, r io.Reader, proc ports.Process
 	hmap := make([]string, len(header))
 	copy(hmap, header)
 
+	workers := s.workers(ctx, proc)
+	pool := newBatchPool(ctx, proc, workers)
+
 	batch := make([]map[string]string, 0, batchSize)
-	total, batches := 0, 0
+	sent, read := 0, 0
 
 	for {
 		record, err := reader.Read()
 		if err == io.EOF {
 			if len(batch) > 0 {
 				log.Printf("[IMP][CSV] send final batch size=%d", len(batch))
-				if e := proc.ProcessBatch(ctx, batch); e != nil {
+				if e := pool.submit(batch); e != nil {
+					total, _, _ := pool.wait()
 					return total, e
 				}
-				total += len(batch)
-				batches++
 			}
 			break
 		}
@@ -178,24 +235,33 @@ func (s *Service) streamCSV(ctx context.Context, r io.Reader, proc ports.Process
 		}
 		row := toMap(hmap, record)
 		batch = append(batch, row)
+		read++
 
 		if len(batch) >= batchSize {
-			log.Printf("[IMP][CSV] send batch #%d size=%d total_so_far=%d", batches+1, len(batch), total)
-			if e := proc.ProcessBatch(ctx, batch); e != nil {
+			sent++
+			log.Printf("[IMP][CSV] send batch #%d size=%d read_so_far=%d workers=%d", sent, len(batch), read, workers)
+			if e := pool.submit(batch); e != nil {
+				total, _, _ := pool.wait()
 				return total, e
 			}
-			total += len(batch)
-			batches++
-			batch = batch[:0]
+			batch = make([]map[string]string, 0, batchSize)
 		}
 	}
-	log.Printf("[IMP][CSV][DONE] total_rows=%d batches=%d duration=%s", total, batches, time.Since(start))
+
+	total, batches, err := pool.wait()
+	if err != nil {
+		return total, err
+	}
+	log.Printf("[IMP][CSV][DONE] total_rows=%d batches=%d workers=%d duration=%s", total, batches, workers, time.Since(start))
 	return total, nil
 }
 
-func (s *Service) streamXLSXFirstSheet(ctx context.Context, r io.Reader, proc ports.Processor, batchSize int) (int, error) {
+func (s *Service) streamXLSXFirstSheet(ctx context.Context, filePath string, proc ports.Processor, batchSize int) (int, error) {
 	start := time.Now()
-	f, err := excelize.OpenReader(r)
+	f, err := excelize.OpenFile(filePath, excelize.Options{
+		UnzipXMLSizeLimit: xlsxXMLMemLimit,
+		TmpDir:            s.TmpDir,
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -229,8 +295,11 @@ func (s *Service) streamXLSXFirstSheet(ctx context.Context, r io.Reader, proc po
 	hmap := make([]string, len(header))
 	copy(hmap, header)
 
+	workers := s.workers(ctx, proc)
+	pool := newBatchPool(ctx, proc, workers)
+
 	batch := make([]map[string]string, 0, batchSize)
-	total, batches := 0, 0
+	sent, read := 0, 0
 
 	for rows.Next() {
 		cols, err := rows.Columns()
@@ -240,29 +309,35 @@ func (s *Service) streamXLSXFirstSheet(ctx context.Context, r io.Reader, proc po
 		}
 		row := toMap(hmap, cols)
 		batch = append(batch, row)
+		read++
 
 		if len(batch) >= batchSize {
-			log.Printf("[IMP][XLSX] send batch #%d size=%d total_so_far=%d", batches+1, len(batch), total)
-			if e := proc.ProcessBatch(ctx, batch); e != nil {
+			sent++
+			log.Printf("[IMP][XLSX] send batch #%d size=%d read_so_far=%d workers=%d", sent, len(batch), read, workers)
+			if e := pool.submit(batch); e != nil {
+				total, _, _ := pool.wait()
 				return total, e
 			}
-			total += len(batch)
-			batches++
-			batch = batch[:0]
+			batch = make([]map[string]string, 0, batchSize)
 		}
 	}
 	if err := rows.Error(); err != nil {
+		total, _, _ := pool.wait()
 		return total, err
 	}
 	if len(batch) > 0 {
 		log.Printf("[IMP][XLSX] send final batch size=%d", len(batch))
-		if e := proc.ProcessBatch(ctx, batch); e != nil {
+		if e := pool.submit(batch); e != nil {
+			total, _, _ := pool.wait()
 			return total, e
 		}
-		total += len(batch)
-		batches++
 	}
-	log.Printf("[IMP][XLSX][DONE] total_rows=%d batches=%d duration=%s", total, batches, time.Since(start))
+
+	total, batches, err := pool.wait()
+	if err != nil {
+		return total, err
+	}
+	log.Printf("[IMP][XLSX][DONE] total_rows=%d batches=%d workers=%d duration=%s", total, batches, workers, time.Since(start))
 	return total, nil
 }
 
@@ -289,6 +364,8 @@ func detectFormat(filePath, contentType string) string {
 		return "xlsx"
 	case "csv":
 		return "csv"
+	case "sta", "mt940":
+		return formatMT940
 	}
 	med, _, _ := mime.ParseMediaType(contentType)
 	switch med {
@@ -299,3 +376,12 @@ func detectFormat(filePath, contentType string) string {
 	}
 	return ""
 }
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
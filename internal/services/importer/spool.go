@@ -0,0 +1,80 @@
+package importer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// spooledFile — локальная копия загруженного файла. Удаляется через Remove.
+type spooledFile struct {
+	Path   string
+	Size   int64
+	SHA256 string
+}
+
+func (f *spooledFile) Open() (*os.File, error) {
+	return os.Open(f.Path)
+}
+
+func (f *spooledFile) Remove() {
+	if f == nil || f.Path == "" {
+		return
+	}
+	if err := os.Remove(f.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("[IMP][SPOOL][WARN] remove %s: %v", f.Path, err)
+	}
+}
+
+// spoolToTemp копирует r во временный файл в dir, считая SHA-256 по пути.
+// Если expectedSHA задан, при несовпадении файл удаляется и возвращается ошибка.
+func spoolToTemp(ctx context.Context, r io.Reader, dir, expectedSHA string) (*spooledFile, error) {
+	start := time.Now()
+
+	tmp, err := os.CreateTemp(dir, "import-*.spool")
+	if err != nil {
+		return nil, fmt.Errorf("spool create: %w", err)
+	}
+	sf := &spooledFile{Path: tmp.Name()}
+
+	hasher := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hasher), ctxReader{ctx: ctx, r: r})
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		sf.Remove()
+		return nil, fmt.Errorf("spool copy: %w", err)
+	}
+
+	sf.Size = n
+	sf.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+
+	if exp := strings.ToLower(strings.TrimSpace(expectedSHA)); exp != "" && exp != sf.SHA256 {
+		sf.Remove()
+		return nil, fmt.Errorf("sha256 mismatch: expected %s, got %s", exp, sf.SHA256)
+	}
+
+	log.Printf("[IMP][SPOOL] path=%s size=%d sha256=%s took=%s", sf.Path, sf.Size, sf.SHA256, time.Since(start))
+	return sf, nil
+}
+
+// ctxReader прерывает копирование при отмене контекста.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
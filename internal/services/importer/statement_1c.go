@@ -0,0 +1,84 @@
+package importer
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// parse1C разбирает файл обмена 1С «Клиент-банк» (1CClientBankExchange),
+// в том числе казахстанский вариант с ИИН/БИН. В платежи попадают документы
+// с заполненной ДатаПоступило (поступления на наш счёт); документ без
+// ДатаПоступило и ДатаСписано отдаётся строкой с ошибкой.
+func parse1C(r io.Reader, emit func(map[string]string) error) error {
+	var doc map[string]string
+
+	return statementLines(r, func(line string) error {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "СекцияДокумент"):
+			doc = make(map[string]string)
+			return nil
+		case line == "КонецДокумента":
+			if doc == nil {
+				return nil
+			}
+			row, ok, err := oneCDocumentRow(doc)
+			raw := oneCDocumentRaw(doc)
+			doc = nil
+			if err != nil {
+				return emit(statementRowError(err, raw))
+			}
+			if !ok {
+				return nil
+			}
+			return emit(row)
+		}
+
+		if doc == nil {
+			return nil
+		}
+		key, val, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil
+		}
+		doc[strings.TrimSpace(key)] = strings.TrimSpace(val)
+		return nil
+	})
+}
+
+// errOneCNoDate — в документе нет ни ДатаПоступило, ни ДатаСписано:
+// направление платежа неизвестно.
+var errOneCNoDate = errors.New("1c: document has neither ДатаПоступило nor ДатаСписано")
+
+// oneCDocumentRow — строка платежа по документу. ok=false для списаний.
+func oneCDocumentRow(doc map[string]string) (map[string]string, bool, error) {
+	date := doc["ДатаПоступило"]
+	if date == "" {
+		if doc["ДатаСписано"] != "" {
+			return nil, false, nil
+		}
+		return nil, false, errOneCNoDate
+	}
+
+	number := doc["Номер"]
+
+	ref := firstNonEmpty(doc["Референс"], doc["ИдентификаторПлатежа"], doc["ИдентификаторДокумента"])
+	if ref == "" {
+		ref = date + "/" + number + "/" + firstNonEmpty(doc["ПлательщикСчет"], doc["ПлательщикИИК"])
+	}
+
+	return map[string]string{
+		"external_id":     "1C:" + ref,
+		"amount":          doc["Сумма"],
+		"payment_date":    date,
+		"payment_purpose": doc["НазначениеПлатежа"],
+		"payer_name":      firstNonEmpty(doc["Плательщик1"], doc["Плательщик"]),
+		"payer_iin":       firstNonEmpty(doc["ПлательщикИИН"], doc["ПлательщикБИН_ИИН"], doc["ПлательщикИНН"], doc["ПлательщикБИН"]),
+	}, true, nil
+}
+
+// oneCDocumentRaw — номер, дата и сумма документа для строки с ошибкой.
+func oneCDocumentRaw(doc map[string]string) string {
+	return "Номер=" + doc["Номер"] + "; Дата=" + doc["Дата"] + "; Сумма=" + doc["Сумма"]
+}
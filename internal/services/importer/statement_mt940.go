@@ -0,0 +1,159 @@
+package importer
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mt940Line61 — строка движения :61:
+// ДатаВалютирования(YYMMDD) [ДатаПроводки(MMDD)] D|C|RD|RC|EC|ED [код средств] Сумма N+код Референс[//РеференсБанка]
+// (EC/ED — ожидаемые поступление/списание).
+var mt940Line61 = regexp.MustCompile(`^(\d{6})(\d{4})?(RC|RD|EC|ED|C|D)([A-Z])?([\d,]+)([NSF][A-Z0-9]{3})([^/]*)(?://(.*))?$`)
+
+// mt940Tag — тег в начале строки: :20:, :61:, :86: и т.д.
+var mt940Tag = regexp.MustCompile(`^:(\d{2}[A-Z]?):(.*)$`)
+
+// parseMT940 разбирает выписку SWIFT MT940. В платежи попадают только
+// поступления (C), назначение берётся из следующего за :61: поля :86:.
+// Поле :61: может продолжаться на следующих строках; если его не удаётся
+// разобрать, запись отдаётся строкой с ошибкой (statementRowError), а
+// разбор выписки продолжается.
+func parseMT940(r io.Reader, emit func(map[string]string) error) error {
+	var (
+		statementRef string
+		cur          map[string]string
+		curTag       string
+		purpose      []string
+		seq          int
+
+		// entry, entryCont — первая строка текущего :61: и её продолжения
+		entry     string
+		entryCont []string
+	)
+
+	flush := func() error {
+		if cur == nil {
+			return nil
+		}
+		cur["payment_purpose"] = strings.TrimSpace(strings.Join(purpose, " "))
+		row := cur
+		cur, purpose = nil, nil
+		return emit(row)
+	}
+
+	// resolveEntry разбирает накопленное поле :61:: сначала первую строку
+	// (следующие строки — дополнительные сведения), затем, если она не
+	// разбирается, вместе с перенесёнными строками.
+	resolveEntry := func() error {
+		if curTag != "61" {
+			return nil
+		}
+		seq++
+		row, ok, err := parseMT940Entry(entry, statementRef, seq)
+		if err != nil && len(entryCont) > 0 {
+			row, ok, err = parseMT940Entry(entry+strings.Join(entryCont, ""), statementRef, seq)
+		}
+		raw := strings.Join(append([]string{":61:" + entry}, entryCont...), "\n")
+		entry, entryCont = "", nil
+		if err != nil {
+			return emit(statementRowError(err, raw))
+		}
+		if ok {
+			cur = row
+		}
+		return nil
+	}
+
+	err := statementLines(r, func(line string) error {
+		// блоки заголовка SWIFT {1:...}{2:...}{4: и конец блока -}
+		if strings.HasPrefix(line, "{") || line == "-}" || line == "-" {
+			return nil
+		}
+
+		m := mt940Tag.FindStringSubmatch(line)
+		if m == nil {
+			// продолжение предыдущего поля
+			switch {
+			case curTag == "61":
+				entryCont = append(entryCont, strings.TrimSpace(line))
+			case curTag == "86" && cur != nil:
+				purpose = append(purpose, strings.TrimSpace(line))
+			}
+			return nil
+		}
+
+		if err := resolveEntry(); err != nil {
+			return err
+		}
+
+		curTag = m[1]
+		value := strings.TrimSpace(m[2])
+
+		switch curTag {
+		case "20":
+			if err := flush(); err != nil {
+				return err
+			}
+			statementRef = value
+		case "61":
+			if err := flush(); err != nil {
+				return err
+			}
+			entry = value
+		case "86":
+			if cur != nil {
+				purpose = append(purpose, value)
+			}
+		default:
+			curTag = ""
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := resolveEntry(); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// parseMT940Entry разбирает поле :61:. ok=false для списаний, сторно и
+// ожидаемых (EC/ED) движений.
+func parseMT940Entry(value, statementRef string, seq int) (map[string]string, bool, error) {
+	m := mt940Line61.FindStringSubmatch(value)
+	if m == nil {
+		return nil, false, fmt.Errorf("mt940: bad :61: line %q", value)
+	}
+	if m[3] != "C" {
+		return nil, false, nil
+	}
+
+	date, err := time.Parse("060102", m[1])
+	if err != nil {
+		return nil, false, fmt.Errorf("mt940: bad value date %q", m[1])
+	}
+
+	amount := strings.Replace(m[5], ",", ".", 1)
+	if _, err := strconv.ParseFloat(amount, 64); err != nil {
+		return nil, false, fmt.Errorf("mt940: bad amount %q", m[5])
+	}
+
+	ref := strings.TrimSpace(m[7])
+	if ref == "" || strings.EqualFold(ref, "NONREF") {
+		ref = strings.TrimSpace(m[8])
+	}
+	if ref == "" || strings.EqualFold(ref, "NONREF") {
+		ref = statementRef + "/" + strconv.Itoa(seq)
+	}
+
+	return map[string]string{
+		"external_id":  "MT940:" + ref,
+		"amount":       amount,
+		"payment_date": date.Format("2006-01-02"),
+	}, true, nil
+}
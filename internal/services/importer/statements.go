@@ -0,0 +1,152 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"debtster_import/internal/ports"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Банковские выписки (MT940 и 1С «Клиент-банк») превращаются в строки
+// того же вида, что и таблица add_payments:
+//
+//	external_id, amount, payment_date, payment_purpose, payer_name, payer_iin
+//
+// debt_number и username по выписке обычно неизвестны — их определяет
+// PaymentsProcessor (по назначению платежа и опции импорта username).
+
+const (
+	formatMT940 = "mt940"
+	format1C    = "1c"
+
+	statementSniffBytes = 4096
+)
+
+// sniffStatementFormat определяет формат выписки по началу файла.
+func sniffStatementFormat(spool *spooledFile) string {
+	f, err := spool.Open()
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	head := make([]byte, statementSniffBytes)
+	n, _ := io.ReadFull(f, head)
+	head = bytes.TrimLeft(head[:n], "\xEF\xBB\xBF \r\n\t")
+
+	switch {
+	case bytes.HasPrefix(head, []byte("1CClientBankExchange")):
+		return format1C
+	case bytes.HasPrefix(head, []byte("{1:")),
+		bytes.HasPrefix(head, []byte(":20:")),
+		bytes.Contains(head, []byte("\n:20:")) && bytes.Contains(head, []byte("\n:61:")):
+		return formatMT940
+	}
+	return ""
+}
+
+// statementBatcher копит строки выписки и отдаёт их пулу батчами.
+type statementBatcher struct {
+	pool  *batchPool
+	size  int
+	batch []map[string]string
+}
+
+func (b *statementBatcher) add(row map[string]string) error {
+	b.batch = append(b.batch, row)
+	if len(b.batch) >= b.size {
+		return b.flush()
+	}
+	return nil
+}
+
+func (b *statementBatcher) flush() error {
+	if len(b.batch) == 0 {
+		return nil
+	}
+	if err := b.pool.submit(b.batch); err != nil {
+		return err
+	}
+	b.batch = make([]map[string]string, 0, b.size)
+	return nil
+}
+
+// statementRowError — строка с ошибкой разбора одной записи выписки:
+// запись попадает в import_record_items как failed, импорт продолжается.
+func statementRowError(err error, raw string) map[string]string {
+	return map[string]string{
+		ports.RowError: err.Error(),
+		"raw":          raw,
+	}
+}
+
+// streamStatement разбирает выписку и передаёт платежи процессору.
+func (s *Service) streamStatement(ctx context.Context, spool *spooledFile, format string, proc ports.Processor, batchSize int) (int, error) {
+	start := time.Now()
+	f, err := spool.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	workers := s.workers(ctx, proc)
+	b := &statementBatcher{pool: newBatchPool(ctx, proc, workers), size: batchSize}
+	switch format {
+	case formatMT940:
+		err = parseMT940(f, b.add)
+	case format1C:
+		err = parse1C(f, b.add)
+	}
+	if err == nil {
+		err = b.flush()
+	}
+
+	total, batches, poolErr := b.pool.wait()
+	if err != nil {
+		return total, err
+	}
+	if poolErr != nil {
+		return total, poolErr
+	}
+
+	log.Printf("[IMP][%s][DONE] total_rows=%d batches=%d workers=%d duration=%s",
+		strings.ToUpper(format), total, batches, workers, time.Since(start))
+	return total, nil
+}
+
+// statementLines читает строки выписки, перекодируя Windows-1251/CP866 в UTF-8.
+// Кодировка берётся из заголовка 1С (Кодировка=Windows|DOS); если строка уже
+// валидный UTF-8, она возвращается как есть.
+func statementLines(r io.Reader, fn func(line string) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	cm := charmap.Windows1251
+	for sc.Scan() {
+		raw := sc.Bytes()
+		line := string(raw)
+		if !utf8.Valid(raw) {
+			// Заголовок «Кодировка=DOS» сам записан в CP866.
+			if dos, err := charmap.CodePage866.NewDecoder().Bytes(raw); err == nil &&
+				strings.HasPrefix(string(dos), "Кодировка=") {
+				cm = charmap.CodePage866
+			}
+			if out, err := cm.NewDecoder().Bytes(raw); err == nil {
+				line = string(out)
+			}
+		}
+		line = strings.TrimRight(strings.TrimPrefix(line, "\uFEFF"), "\r")
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
@@ -0,0 +1,182 @@
+package importer
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"debtster_import/internal/ports"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+func collectRows(t *testing.T, parse func(io.Reader, func(map[string]string) error) error, in string) []map[string]string {
+	t.Helper()
+	var rows []map[string]string
+	if err := parse(strings.NewReader(in), func(m map[string]string) error {
+		rows = append(rows, m)
+		return nil
+	}); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return rows
+}
+
+func TestParseMT940(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []map[string]string
+	}{
+		{
+			name: "credit with reference and multi-line purpose",
+			in: "{1:F01BANK}{2:I940}{4:\n:20:STMT1\n:25:KZ00ACC\n" +
+				":61:2401150115C1250,50NTRFREF1//BANKREF\n:86:Оплата по договору\nKD-1\n-}",
+			want: []map[string]string{{
+				"external_id": "MT940:REF1", "amount": "1250.50", "payment_date": "2024-01-15",
+				"payment_purpose": "Оплата по договору KD-1",
+			}},
+		},
+		{
+			name: "debits, reversals and expected entries are skipped",
+			in: ":20:STMT1\n" +
+				":61:240115D10,00NTRFOUT1\n:86:списание\n" +
+				":61:240115RC10,00NTRFREV1\n:86:сторно\n" +
+				":61:240115EC10,00NTRFEXP1\n:86:ожидается\n" +
+				":61:240115ED10,00NTRFEXP2\n:86:ожидается\n" +
+				":61:240116C20,00NTRFIN1\n:86:поступление\n",
+			want: []map[string]string{{
+				"external_id": "MT940:IN1", "amount": "20.00", "payment_date": "2024-01-16",
+				"payment_purpose": "поступление",
+			}},
+		},
+		{
+			name: "NONREF falls back to the bank reference, then to statement and sequence",
+			in: ":20:STMT7\n" +
+				":61:240115C1,00NTRFNONREF//BANK1\n:86:a\n" +
+				":61:240115C2,00NTRFNONREF\n:86:b\n",
+			want: []map[string]string{
+				{"external_id": "MT940:BANK1", "amount": "1.00", "payment_date": "2024-01-15", "payment_purpose": "a"},
+				{"external_id": "MT940:STMT7/2", "amount": "2.00", "payment_date": "2024-01-15", "payment_purpose": "b"},
+			},
+		},
+		{
+			name: "supplementary details line of :61: is not part of the purpose",
+			in:   ":20:S\n:61:240115C5,00NTRFREF5//B\nSUPPLEMENTARY\n:86:назначение\n",
+			want: []map[string]string{{
+				"external_id": "MT940:REF5", "amount": "5.00", "payment_date": "2024-01-15",
+				"payment_purpose": "назначение",
+			}},
+		},
+		{
+			name: ":61: wrapped onto the next line is joined",
+			in:   ":20:S\n:61:240115C5,00\nNTRFREF6\n:86:назначение\n",
+			want: []map[string]string{{
+				"external_id": "MT940:REF6", "amount": "5.00", "payment_date": "2024-01-15",
+				"payment_purpose": "назначение",
+			}},
+		},
+		{
+			name: "broken :61: becomes a row error and parsing continues",
+			in:   ":20:S\n:61:garbage\n:86:ignored\n:61:240115C7,00NTRFREF7\n:86:ok\n",
+			want: []map[string]string{
+				{ports.RowError: `mt940: bad :61: line "garbage"`, "raw": ":61:garbage"},
+				{"external_id": "MT940:REF7", "amount": "7.00", "payment_date": "2024-01-15", "payment_purpose": "ok"},
+			},
+		},
+		{
+			name: "impossible value date becomes a row error",
+			in:   ":20:S\n:61:241399C7,00NTRFREF8\n",
+			want: []map[string]string{
+				{ports.RowError: `mt940: bad value date "241399"`, "raw": ":61:241399C7,00NTRFREF8"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := collectRows(t, parseMT940, tt.in)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("rows:\n got  %v\n want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse1C(t *testing.T) {
+	doc := func(lines ...string) string {
+		return "СекцияДокумент=Платежное поручение\n" + strings.Join(lines, "\n") + "\nКонецДокумента\n"
+	}
+	header := "1CClientBankExchange\nВерсияФормата=1.03\n"
+
+	tests := []struct {
+		name string
+		in   string
+		want []map[string]string
+	}{
+		{
+			name: "incoming document with reference and payer IIN",
+			in: header + doc(
+				"Номер=15", "Дата=01.02.2024", "ДатаПоступило=02.02.2024", "Сумма=1500.00",
+				"Референс=R-15", "Плательщик1=Иванов И.И.", "ПлательщикИИН=900101300123",
+				"НазначениеПлатежа=Погашение KD-1",
+			),
+			want: []map[string]string{{
+				"external_id": "1C:R-15", "amount": "1500.00", "payment_date": "02.02.2024",
+				"payment_purpose": "Погашение KD-1", "payer_name": "Иванов И.И.", "payer_iin": "900101300123",
+			}},
+		},
+		{
+			name: "without reference the key is built from date, number and payer account",
+			in:   header + doc("Номер=7", "ДатаПоступило=03.02.2024", "Сумма=10", "ПлательщикИИК=KZ01", "Плательщик=ТОО Ромашка", "ПлательщикБИН=100140000001"),
+			want: []map[string]string{{
+				"external_id": "1C:03.02.2024/7/KZ01", "amount": "10", "payment_date": "03.02.2024",
+				"payment_purpose": "", "payer_name": "ТОО Ромашка", "payer_iin": "100140000001",
+			}},
+		},
+		{
+			name: "outgoing document is skipped",
+			in:   header + doc("Номер=8", "Дата=03.02.2024", "ДатаСписано=03.02.2024", "Сумма=10"),
+		},
+		{
+			name: "document without either date is a row error",
+			in:   header + doc("Номер=9", "Дата=03.02.2024", "Сумма=10"),
+			want: []map[string]string{{
+				ports.RowError: errOneCNoDate.Error(),
+				"raw":          "Номер=9; Дата=03.02.2024; Сумма=10",
+			}},
+		},
+		{
+			name: "lines outside documents are ignored",
+			in:   header + "РасчСчет=KZ00\n" + doc("Номер=10", "ДатаПоступило=04.02.2024", "Сумма=5", "Референс=R-10"),
+			want: []map[string]string{{
+				"external_id": "1C:R-10", "amount": "5", "payment_date": "04.02.2024",
+				"payment_purpose": "", "payer_name": "", "payer_iin": "",
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := collectRows(t, parse1C, tt.in)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("rows:\n got  %v\n want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse1CWindows1251(t *testing.T) {
+	in := "1CClientBankExchange\nКодировка=Windows\nСекцияДокумент=Платежное поручение\n" +
+		"ДатаПоступило=05.02.2024\nСумма=1\nРеференс=R-1\nНазначениеПлатежа=Оплата\nКонецДокумента\n"
+	encoded, err := charmap.Windows1251.NewEncoder().String(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := collectRows(t, parse1C, encoded)
+	if len(got) != 1 || got[0]["payment_purpose"] != "Оплата" || got[0]["external_id"] != "1C:R-1" {
+		t.Fatalf("rows = %v", got)
+	}
+}
@@ -0,0 +1,123 @@
+package importer
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"debtster_import/internal/ports"
+)
+
+// workers — сколько батчей импорта обрабатывать одновременно. Service.Workers —
+// верхняя граница, опция импорта workers может её уменьшить; процессоры
+// ports.OrderSensitive всегда работают по одному батчу.
+func (s *Service) workers(ctx context.Context, proc ports.Processor) int {
+	if o, ok := proc.(ports.OrderSensitive); ok && o.OrderSensitive() {
+		return 1
+	}
+	n := s.Workers
+	if v, err := strconv.Atoi(ports.ImportOption(ctx, "workers")); err == nil && v > 0 && v < n {
+		n = v
+	}
+	return max(n, 1)
+}
+
+// batchPool передаёт батчи процессору: при workers > 1 — нескольким горутинам,
+// иначе в вызывающей горутине, строго по порядку. Первая ошибка батча отменяет
+// контекст пула — читатель и остальные воркеры останавливаются.
+type batchPool struct {
+	proc   ports.Processor
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	jobs   chan []map[string]string
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	rows    int // строк в успешно обработанных батчах
+	batches int
+	err     error
+}
+
+func newBatchPool(ctx context.Context, proc ports.Processor, workers int) *batchPool {
+	ctx, cancel := context.WithCancelCause(ctx)
+	p := &batchPool{proc: proc, ctx: ctx, cancel: cancel}
+	if workers > 1 {
+		// очередь не длиннее числа воркеров: в памяти не больше 2*workers батчей
+		p.jobs = make(chan []map[string]string, workers)
+		for range workers {
+			p.wg.Add(1)
+			go p.worker()
+		}
+	}
+	return p
+}
+
+// submit передаёт батч процессору. После вызова батч принадлежит пулу —
+// читатель должен начинать следующий батч с нового среза.
+func (p *batchPool) submit(batch []map[string]string) error {
+	if err := p.failure(); err != nil {
+		return err
+	}
+	if p.jobs == nil {
+		p.run(batch)
+		return p.failure()
+	}
+	select {
+	case p.jobs <- batch:
+		return nil
+	case <-p.ctx.Done():
+		return p.failure()
+	}
+}
+
+// wait дожидается обработки отправленных батчей. rows — строки успешно
+// обработанных батчей.
+func (p *batchPool) wait() (rows, batches int, err error) {
+	if p.jobs != nil {
+		close(p.jobs)
+		p.wg.Wait()
+	}
+	err = p.failure()
+	p.cancel(nil)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.rows, p.batches, err
+}
+
+func (p *batchPool) worker() {
+	defer p.wg.Done()
+	for batch := range p.jobs {
+		if p.ctx.Err() != nil {
+			continue // отменено: только вычитываем очередь
+		}
+		p.run(batch)
+	}
+}
+
+func (p *batchPool) run(batch []map[string]string) {
+	if err := p.proc.ProcessBatch(p.ctx, batch); err != nil {
+		p.mu.Lock()
+		if p.err == nil {
+			p.err = err
+		}
+		p.mu.Unlock()
+		p.cancel(err)
+		return
+	}
+	p.mu.Lock()
+	p.rows += len(batch)
+	p.batches++
+	p.mu.Unlock()
+}
+
+// failure — первая ошибка батча или причина отмены контекста.
+func (p *batchPool) failure() error {
+	p.mu.Lock()
+	err := p.err
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return context.Cause(p.ctx)
+}
@@ -0,0 +1,103 @@
+package statuses
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"debtster_import/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// ActionStatusChanged — тип действия-аудита, создаваемого при смене статуса долга.
+const ActionStatusChanged = "status_changed"
+
+// anyStatus — ключ графа, правила которого действуют для статусов без своей записи.
+const anyStatus = "*"
+
+var ErrIllegalTransition = errors.New("illegal status transition")
+
+// Graph — допустимые переходы между статусами долга по debt_statuses.shortname.
+//
+// Формат файла (JSON): {"new": ["in_work", "closed"], "closed": [], "*": ["*"]}.
+// Статус-ключ с пустым списком — конечный, из него никуда нельзя.
+// "*" в списке разрешает переход в любой статус, ключ "*" задаёт правила
+// для статусов, не перечисленных отдельно. Пустой граф разрешает всё.
+type Graph struct {
+	allowed map[string]map[string]bool
+}
+
+// LoadGraph читает граф переходов из JSON-файла. Пустой путь — граф без ограничений.
+func LoadGraph(path string) (*Graph, error) {
+	if strings.TrimSpace(path) == "" {
+		return &Graph{}, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read status transitions: %w", err)
+	}
+	var spec map[string][]string
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return nil, fmt.Errorf("parse status transitions: %w", err)
+	}
+	return NewGraph(spec), nil
+}
+
+// NewGraph строит граф из списка переходов from -> []to.
+func NewGraph(spec map[string][]string) *Graph {
+	g := &Graph{allowed: make(map[string]map[string]bool, len(spec))}
+	for from, to := range spec {
+		set := make(map[string]bool, len(to))
+		for _, t := range to {
+			set[normalize(t)] = true
+		}
+		g.allowed[normalize(from)] = set
+	}
+	return g
+}
+
+// Check проверяет переход from -> to. Переход из пустого статуса (у долга
+// статуса ещё нет) и в тот же самый статус всегда допустим.
+func (g *Graph) Check(from, to string) error {
+	from, to = normalize(from), normalize(to)
+	if g == nil || len(g.allowed) == 0 || from == "" || from == to {
+		return nil
+	}
+	set, ok := g.allowed[from]
+	if !ok {
+		if set, ok = g.allowed[anyStatus]; !ok {
+			return nil
+		}
+	}
+	if set[to] || set[anyStatus] {
+		return nil
+	}
+	return fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, from, to)
+}
+
+// ChangeAction — действие-аудит смены статуса долга с from на to.
+// source — тип импорта, которым сделано изменение.
+func ChangeAction(debtID string, toID int64, from, to, source string) models.Action {
+	typ := ActionStatusChanged
+	if from == "" {
+		from = "—"
+	}
+	comment := fmt.Sprintf("Статус изменён: %s → %s (%s)", from, to, source)
+	now := time.Now()
+	return models.Action{
+		ID:           uuid.NewString(),
+		DebtID:       &debtID,
+		DebtStatusID: &toID,
+		Type:         &typ,
+		Comment:      &comment,
+		CreatedAt:    &now,
+	}
+}
+
+func normalize(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
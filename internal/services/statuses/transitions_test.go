@@ -0,0 +1,50 @@
+package statuses
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGraphCheck(t *testing.T) {
+	g := NewGraph(map[string][]string{
+		"new":     {"in_work", "Closed"},
+		"in_work": {"*"},
+		"closed":  {},
+		"*":       {"in_work"},
+	})
+	noWildcard := NewGraph(map[string][]string{
+		"new": {"in_work"},
+	})
+
+	tests := []struct {
+		name     string
+		g        *Graph
+		from, to string
+		ok       bool
+	}{
+		{"listed transition", g, "new", "in_work", true},
+		{"case and spaces are ignored", g, " NEW ", "closed", true},
+		{"unlisted transition", g, "new", "sold", false},
+		{"wildcard target allows any status", g, "in_work", "sold", true},
+		{"final status allows nothing", g, "closed", "new", false},
+		{"same status is always allowed", g, "closed", "Closed", true},
+		{"empty from is always allowed", g, "", "closed", true},
+		{"wildcard key applies to unlisted status", g, "sold", "in_work", true},
+		{"wildcard key restricts unlisted status", g, "sold", "new", false},
+		{"unlisted status without wildcard key is unrestricted", noWildcard, "sold", "new", true},
+		{"nil graph allows everything", nil, "closed", "new", true},
+		{"empty graph allows everything", &Graph{}, "closed", "new", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.g.Check(tt.from, tt.to)
+			if tt.ok && err != nil {
+				t.Fatalf("Check(%q, %q) = %v, want nil", tt.from, tt.to, err)
+			}
+			if !tt.ok && !errors.Is(err, ErrIllegalTransition) {
+				t.Fatalf("Check(%q, %q) = %v, want ErrIllegalTransition", tt.from, tt.to, err)
+			}
+		})
+	}
+}
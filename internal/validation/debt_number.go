@@ -0,0 +1,18 @@
+package validation
+
+import "strings"
+
+// NormalizeDebtNumber приводит номер долга к виду, в котором он хранится в
+// debts.number: без пробелов любого вида (включая неразрывный) и невидимых
+// символов, которые приносят выгрузки из Excel и банковских систем.
+// Уже сохранённые номера приводятся к тому же виду миграцией 009.
+func NormalizeDebtNumber(raw string) string {
+	s := strings.Join(strings.Fields(raw), "")
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '\u200b', '\u200c', '\u200d', '\u2060', '\ufeff':
+			return -1
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,158 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrIINEmpty    = errors.New("empty iin")
+	ErrIINDigits   = errors.New("iin must contain only digits")
+	ErrIINLength   = errors.New("iin must have 12 digits")
+	ErrIINChecksum = errors.New("iin checksum mismatch")
+	ErrIINCentury  = errors.New("iin has unknown century/gender digit")
+	ErrIINDate     = errors.New("iin has impossible birth date")
+	ErrBINType     = errors.New("bin has unknown entity type digit")
+)
+
+// IIN — разобранный ИИН физического лица или БИН юрлица/ИП.
+type IIN struct {
+	Value string
+	// BIN — идентификатор оказался БИНом; дата рождения, век и пол не заполняются.
+	BIN       bool
+	BirthDate time.Time // в UTC
+	Century   int       // 19, 20 или 21
+	Gender    string
+	// Repaired — ИИН пришёл из 11 цифр (Excel съел ведущий ноль) и был восстановлен.
+	Repaired bool
+}
+
+// ParseIIN проверяет ИИН (12 цифр + контрольный разряд) и извлекает дату рождения,
+// век и пол из 7-го разряда. 11-значный ИИН дополняется ведущим нулём, если после
+// этого сходится контрольная сумма. БИН (4, 5 или 6 в 5-м разряде) принимается
+// с BIN=true — у юрлиц и ИП даты рождения в номере нет.
+func ParseIIN(raw string) (IIN, error) {
+	digits, repaired, err := cleanIdentifier(raw)
+	if err != nil {
+		return IIN{}, err
+	}
+	if bin, err := NormalizeBIN(digits); err == nil {
+		return IIN{Value: bin, BIN: true, Repaired: repaired}, nil
+	}
+	if !checksumOK(digits) {
+		return IIN{}, fmt.Errorf("%w: %s", ErrIINChecksum, digits)
+	}
+
+	var century int
+	var gender string
+	switch digits[6] {
+	case '1', '2':
+		century = 19
+	case '3', '4':
+		century = 20
+	case '5', '6':
+		century = 21
+	default:
+		return IIN{}, fmt.Errorf("%w: %s", ErrIINCentury, digits)
+	}
+	if (digits[6]-'0')%2 == 1 {
+		gender = "male"
+	} else {
+		gender = "female"
+	}
+
+	yy := atoi2(digits[0:2])
+	mm := atoi2(digits[2:4])
+	dd := atoi2(digits[4:6])
+	year := (century-1)*100 + yy
+	birth := time.Date(year, time.Month(mm), dd, 0, 0, 0, 0, time.UTC)
+	if mm < 1 || mm > 12 || birth.Day() != dd || birth.Month() != time.Month(mm) {
+		return IIN{}, fmt.Errorf("%w: %s", ErrIINDate, digits)
+	}
+
+	return IIN{
+		Value:     digits,
+		BirthDate: birth,
+		Century:   century,
+		Gender:    gender,
+		Repaired:  repaired,
+	}, nil
+}
+
+// NormalizeBIN проверяет БИН юрлица/ИП: 12 цифр, тип в 5-м разряде (4 — резидент,
+// 5 — нерезидент, 6 — ИП/совместное предпринимательство) и контрольный разряд.
+func NormalizeBIN(raw string) (string, error) {
+	digits, _, err := cleanIdentifier(raw)
+	if err != nil {
+		return "", err
+	}
+	switch digits[4] {
+	case '4', '5', '6':
+	default:
+		return "", fmt.Errorf("%w: %s", ErrBINType, digits)
+	}
+	if !checksumOK(digits) {
+		return "", fmt.Errorf("%w: %s", ErrIINChecksum, digits)
+	}
+	return digits, nil
+}
+
+// cleanIdentifier убирает пробелы и артефакты Excel (".0" у числовой ячейки),
+// возвращает ровно 12 цифр.
+func cleanIdentifier(raw string) (string, bool, error) {
+	s := strings.Join(strings.Fields(raw), "")
+	s = strings.TrimSuffix(s, ".0")
+	if s == "" {
+		return "", false, ErrIINEmpty
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return "", false, fmt.Errorf("%w: %q", ErrIINDigits, raw)
+		}
+	}
+
+	switch len(s) {
+	case 12:
+		return s, false, nil
+	case 11:
+		if fixed := "0" + s; checksumOK(fixed) {
+			return fixed, true, nil
+		}
+		return "", false, fmt.Errorf("%w: %q (11 digits, leading zero repair failed checksum)", ErrIINLength, raw)
+	default:
+		return "", false, fmt.Errorf("%w: %q (%d digits)", ErrIINLength, raw, len(s))
+	}
+}
+
+// checksumOK — официальный двухпроходный алгоритм контрольного разряда ИИН/БИН:
+// веса 1..11, при остатке 10 — веса 3..11,1,2; остаток 10 на втором проходе — недопустим.
+func checksumOK(digits string) bool {
+	if len(digits) != 12 {
+		return false
+	}
+	w1 := [11]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}
+	w2 := [11]int{3, 4, 5, 6, 7, 8, 9, 10, 11, 1, 2}
+
+	sum := func(w [11]int) int {
+		s := 0
+		for i := 0; i < 11; i++ {
+			s += int(digits[i]-'0') * w[i]
+		}
+		return s % 11
+	}
+
+	c := sum(w1)
+	if c == 10 {
+		c = sum(w2)
+		if c == 10 {
+			return false
+		}
+	}
+	return c == int(digits[11]-'0')
+}
+
+func atoi2(s string) int {
+	return int(s[0]-'0')*10 + int(s[1]-'0')
+}
@@ -0,0 +1,189 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseIIN(t *testing.T) {
+	type want struct {
+		value    string
+		bin      bool
+		birth    string // "" — дата не заполняется (БИН)
+		century  int
+		gender   string
+		repaired bool
+	}
+
+	tests := []struct {
+		name    string
+		raw     string
+		want    want
+		wantErr error
+	}{
+		{
+			name: "male born in the 20th century",
+			raw:  "900101300126",
+			want: want{value: "900101300126", birth: "1990-01-01", century: 20, gender: "male"},
+		},
+		{
+			name: "female born in the 19th century",
+			raw:  "850515200347",
+			want: want{value: "850515200347", birth: "1885-05-15", century: 19, gender: "female"},
+		},
+		{
+			name: "male born in the 21st century",
+			raw:  "050203500114",
+			want: want{value: "050203500114", birth: "2005-02-03", century: 21, gender: "male"},
+		},
+		{
+			name: "check digit from the second weight pass",
+			raw:  "900101300811",
+			want: want{value: "900101300811", birth: "1990-01-01", century: 20, gender: "male"},
+		},
+		{
+			name: "spaces and Excel .0 suffix are stripped",
+			raw:  " 9001 0130 0126.0 ",
+			want: want{value: "900101300126", birth: "1990-01-01", century: 20, gender: "male"},
+		},
+		{
+			name: "11 digits: leading zero eaten by Excel is restored",
+			raw:  "50203500114",
+			want: want{value: "050203500114", birth: "2005-02-03", century: 21, gender: "male", repaired: true},
+		},
+		{
+			name:    "11 digits: repair does not fix the checksum",
+			raw:     "50203500115",
+			wantErr: ErrIINLength,
+		},
+		{
+			name: "resident BIN falls back to BIN without birth date",
+			raw:  "100140000003",
+			want: want{value: "100140000003", bin: true},
+		},
+		{
+			name: "individual entrepreneur BIN",
+			raw:  "100160000032",
+			want: want{value: "100160000032", bin: true},
+		},
+		{
+			name: "BIN with check digit from the second weight pass",
+			raw:  "100140000408",
+			want: want{value: "100140000408", bin: true},
+		},
+		{
+			name:    "wrong check digit, first pass",
+			raw:     "900101300127",
+			wantErr: ErrIINChecksum,
+		},
+		{
+			name:    "wrong check digit, second pass",
+			raw:     "900101300812",
+			wantErr: ErrIINChecksum,
+		},
+		{
+			name:    "both weight passes give 10",
+			raw:     "900101300800",
+			wantErr: ErrIINChecksum,
+		},
+		{
+			name:    "BIN with wrong check digit is not accepted as IIN either",
+			raw:     "100140000004",
+			wantErr: ErrIINChecksum,
+		},
+		{
+			name:    "century/gender digit 0",
+			raw:     "900101000127",
+			wantErr: ErrIINCentury,
+		},
+		{
+			name:    "century/gender digit 7",
+			raw:     "900101700121",
+			wantErr: ErrIINCentury,
+		},
+		{
+			name:    "February 30",
+			raw:     "900230300128",
+			wantErr: ErrIINDate,
+		},
+		{
+			name:    "month 13",
+			raw:     "901313300121",
+			wantErr: ErrIINDate,
+		},
+		{
+			name:    "empty",
+			raw:     "  ",
+			wantErr: ErrIINEmpty,
+		},
+		{
+			name:    "letters",
+			raw:     "90010130012A",
+			wantErr: ErrIINDigits,
+		},
+		{
+			name:    "too short",
+			raw:     "9001013",
+			wantErr: ErrIINLength,
+		},
+		{
+			name:    "too long",
+			raw:     "9001013001260",
+			wantErr: ErrIINLength,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseIIN(tt.raw)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseIIN(%q) err = %v, want %v", tt.raw, err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			birth := ""
+			if !got.BirthDate.IsZero() {
+				birth = got.BirthDate.Format("2006-01-02")
+			}
+			g := want{
+				value: got.Value, bin: got.BIN, birth: birth,
+				century: got.Century, gender: got.Gender, repaired: got.Repaired,
+			}
+			if g != tt.want {
+				t.Fatalf("ParseIIN(%q) = %+v, want %+v", tt.raw, g, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeBIN(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    string
+		wantErr error
+	}{
+		{"resident legal entity", "100140000003", "100140000003", nil},
+		{"non-resident legal entity", "100150000028", "100150000028", nil},
+		{"individual entrepreneur", "100160000032", "100160000032", nil},
+		{"11 digits: leading zero is restored", "50140000001", "050140000001", nil},
+		{"IIN is not a BIN", "900101300126", "", ErrBINType},
+		{"unknown entity type digit", "100170000007", "", ErrBINType},
+		{"wrong check digit", "100140000004", "", ErrIINChecksum},
+		{"empty", "", "", ErrIINEmpty},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeBIN(tt.raw)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NormalizeBIN(%q) err = %v, want %v", tt.raw, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("NormalizeBIN(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type PhoneKind string
+
+const (
+	PhoneMobile   PhoneKind = "mobile"
+	PhoneLandline PhoneKind = "landline"
+)
+
+// Phone — номер в канонической форме.
+type Phone struct {
+	// Digits — E.164 без "+": 11 цифр, начиная с 7. В таком виде номер хранится в phones.phone.
+	Digits  string
+	Country string
+	Kind    PhoneKind
+}
+
+func (p Phone) E164() string { return "+" + p.Digits }
+
+// Variants — формы, в которых этот же номер мог быть сохранён до нормализации
+// (8XXXXXXXXXX, XXXXXXXXXX, +7XXXXXXXXXX). Нужны для поиска дублей среди старых записей.
+func (p Phone) Variants() []string {
+	local := p.Digits[1:]
+	return []string{p.Digits, "8" + local, local, "+" + p.Digits}
+}
+
+var (
+	ErrPhoneEmpty  = errors.New("empty phone")
+	ErrPhoneLength = errors.New("impossible phone length")
+	ErrPhoneCode   = errors.New("unknown operator/area code")
+)
+
+// Коды мобильных операторов Казахстана (+7 7xx).
+var kzMobileCodes = map[string]struct{}{
+	"700": {}, "701": {}, "702": {}, "705": {}, "706": {}, "707": {}, "708": {},
+	"747": {}, "771": {}, "775": {}, "776": {}, "777": {}, "778": {},
+}
+
+var phoneNonDigits = regexp.MustCompile(`\D+`)
+
+// NormalizePhone приводит казахстанский/российский номер к виду 7XXXXXXXXXX:
+// 8 → 7 в начале, 10-значный номер дополняется 7. Номер классифицируется
+// как мобильный или городской по коду оператора/города.
+func NormalizePhone(raw string) (Phone, error) {
+	digits := phoneNonDigits.ReplaceAllString(strings.TrimSpace(raw), "")
+	if digits == "" {
+		return Phone{}, ErrPhoneEmpty
+	}
+
+	switch {
+	case len(digits) == 10:
+		digits = "7" + digits
+	case len(digits) == 11 && digits[0] == '8':
+		digits = "7" + digits[1:]
+	case len(digits) == 11 && digits[0] == '7':
+	default:
+		return Phone{}, fmt.Errorf("%w: %q (%d digits)", ErrPhoneLength, raw, len(digits))
+	}
+
+	code := digits[1:4]
+	p := Phone{Digits: digits}
+
+	switch code[0] {
+	case '7':
+		p.Country = "KZ"
+		if _, ok := kzMobileCodes[code]; ok {
+			p.Kind = PhoneMobile
+		} else if code[1] == '1' || code[1] == '2' {
+			p.Kind = PhoneLandline
+		} else {
+			return Phone{}, fmt.Errorf("%w: %q (code %s)", ErrPhoneCode, raw, code)
+		}
+	case '9':
+		p.Country = "RU"
+		p.Kind = PhoneMobile
+	case '3', '4', '8':
+		p.Country = "RU"
+		p.Kind = PhoneLandline
+	default:
+		return Phone{}, fmt.Errorf("%w: %q (code %s)", ErrPhoneCode, raw, code)
+	}
+
+	return p, nil
+}
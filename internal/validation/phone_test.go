@@ -0,0 +1,56 @@
+package validation
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    Phone
+		wantErr error
+	}{
+		{"international format with punctuation", "+7 (701) 123-45-67", Phone{"77011234567", "KZ", PhoneMobile}, nil},
+		{"leading 8 becomes 7", "8 701 123 45 67", Phone{"77011234567", "KZ", PhoneMobile}, nil},
+		{"10 digits get country code 7", "7011234567", Phone{"77011234567", "KZ", PhoneMobile}, nil},
+		{"KZ mobile 747", "87471234567", Phone{"77471234567", "KZ", PhoneMobile}, nil},
+		{"KZ mobile 771", "77711234567", Phone{"77711234567", "KZ", PhoneMobile}, nil},
+		{"KZ landline 727 (Almaty)", "87272501234", Phone{"77272501234", "KZ", PhoneLandline}, nil},
+		{"KZ landline 717 (Astana)", "7172501234", Phone{"77172501234", "KZ", PhoneLandline}, nil},
+		{"KZ 7xx that is neither mobile nor landline", "87601234567", Phone{}, ErrPhoneCode},
+		{"RU mobile 9xx", "8 916 123-45-67", Phone{"79161234567", "RU", PhoneMobile}, nil},
+		{"RU landline 495", "+7 495 123 45 67", Phone{"74951234567", "RU", PhoneLandline}, nil},
+		{"RU landline 3xx", "73432123456", Phone{"73432123456", "RU", PhoneLandline}, nil},
+		{"RU landline 812", "8121234567", Phone{"78121234567", "RU", PhoneLandline}, nil},
+		{"unknown code 5xx", "75001234567", Phone{}, ErrPhoneCode},
+		{"unknown code 6xx", "6001234567", Phone{}, ErrPhoneCode},
+		{"empty", " ", Phone{}, ErrPhoneEmpty},
+		{"no digits at all", "нет", Phone{}, ErrPhoneEmpty},
+		{"too short", "701123456", Phone{}, ErrPhoneLength},
+		{"too long", "877011234567", Phone{}, ErrPhoneLength},
+		{"11 digits not starting with 7 or 8", "97011234567", Phone{}, ErrPhoneLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizePhone(tt.raw)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NormalizePhone(%q) err = %v, want %v", tt.raw, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("NormalizePhone(%q) = %+v, want %+v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPhoneVariants(t *testing.T) {
+	p := Phone{Digits: "77011234567"}
+	want := []string{"77011234567", "87011234567", "7011234567", "+77011234567"}
+	if got := p.Variants(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Variants() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,42 @@
+-- Связь исполнительного производства с исполнительным документом
+-- и история статусов АИС ОИП (append-only).
+
+ALTER TABLE enforcement_proceedings
+    ADD COLUMN IF NOT EXISTS executive_document_id uuid NULL REFERENCES executive_documents (id) ON DELETE SET NULL;
+
+CREATE TABLE IF NOT EXISTS enforcement_proceeding_status_history (
+    id                        uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    enforcement_proceeding_id uuid         NOT NULL REFERENCES enforcement_proceedings (id) ON DELETE CASCADE,
+    status_from               varchar(255) NULL,
+    status_to                 varchar(255) NULL,
+    changed_at                timestamp    NOT NULL,
+    import_record_id          varchar(64)  NULL,
+    created_at                timestamp    NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS enforcement_proceeding_status_history_ep_idx
+    ON enforcement_proceeding_status_history (enforcement_proceeding_id, changed_at);
+
+-- Начальная запись для производств, созданных до истории: текущий статус
+-- с момента последнего изменения строки. Производства без статуса и уже
+-- имеющие историю не трогаем — повторный запуск ничего не добавит.
+INSERT INTO enforcement_proceeding_status_history (
+    enforcement_proceeding_id, status_from, status_to, changed_at, import_record_id
+)
+SELECT ep.id, NULL, ep.status_ais_oip, COALESCE(ep.updated_at, ep.created_at, NOW()), NULL
+FROM enforcement_proceedings ep
+WHERE ep.status_ais_oip IS NOT NULL
+  AND NOT EXISTS (
+      SELECT 1 FROM enforcement_proceeding_status_history h
+      WHERE h.enforcement_proceeding_id = ep.id
+  );
+
+-- Сколько производство пробыло в каждом статусе (текущий статус — до NOW()).
+CREATE OR REPLACE VIEW enforcement_proceeding_status_durations AS
+SELECT h.enforcement_proceeding_id,
+       h.status_to                                                   AS status_ais_oip,
+       h.changed_at                                                  AS entered_at,
+       LEAD(h.changed_at) OVER w                                     AS left_at,
+       COALESCE(LEAD(h.changed_at) OVER w, NOW()) - h.changed_at     AS duration
+FROM enforcement_proceeding_status_history h
+WINDOW w AS (PARTITION BY h.enforcement_proceeding_id ORDER BY h.changed_at);
@@ -0,0 +1,12 @@
+-- Сверка платежей с банком: внешний идентификатор, подтверждение, сторно
+-- и отметка о том, что платёж уже уменьшил остатки долга.
+
+ALTER TABLE payments
+    ADD COLUMN IF NOT EXISTS external_id         varchar(255) NULL,
+    ADD COLUMN IF NOT EXISTS balance_applied_at  timestamp    NULL,
+    ADD COLUMN IF NOT EXISTS reversed_at         timestamp    NULL,
+    ADD COLUMN IF NOT EXISTS reversal_of_id      uuid         NULL REFERENCES payments (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS payments_external_id_idx
+    ON payments (external_id)
+    WHERE external_id IS NOT NULL;
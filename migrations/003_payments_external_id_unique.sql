@@ -0,0 +1,41 @@
+-- external_id (референс банковской транзакции) становится ключом дедупликации.
+-- Естественный ключ (debt_id, user_id, amount, amount_after_subtraction, payment_date)
+-- остаётся уникальным только для платежей без external_id: два разных платежа
+-- на одну сумму в один день с разными референсами больше не схлопываются.
+
+DO $$
+DECLARE
+    idx record;
+BEGIN
+    FOR idx IN
+        SELECT i.indexrelid::regclass AS name, c.conname
+        FROM pg_index i
+        LEFT JOIN pg_constraint c ON c.conindid = i.indexrelid
+        WHERE i.indrelid = 'payments'::regclass
+          AND i.indisunique
+          AND NOT i.indisprimary
+          AND i.indpred IS NULL
+          AND (
+              SELECT array_agg(a.attname::text ORDER BY a.attname)
+              FROM pg_attribute a
+              WHERE a.attrelid = i.indrelid AND a.attnum = ANY (i.indkey)
+          ) = ARRAY['amount', 'amount_after_subtraction', 'debt_id', 'payment_date', 'user_id']
+    LOOP
+        IF idx.conname IS NOT NULL THEN
+            EXECUTE format('ALTER TABLE payments DROP CONSTRAINT %I', idx.conname);
+        ELSE
+            EXECUTE format('DROP INDEX %s', idx.name);
+        END IF;
+    END LOOP;
+END
+$$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS payments_natural_key_uniq
+    ON payments (debt_id, user_id, amount, amount_after_subtraction, payment_date)
+    WHERE external_id IS NULL AND reversal_of_id IS NULL;
+
+DROP INDEX IF EXISTS payments_external_id_idx;
+
+CREATE UNIQUE INDEX IF NOT EXISTS payments_external_id_uniq
+    ON payments (external_id)
+    WHERE external_id IS NOT NULL AND reversal_of_id IS NULL;
@@ -0,0 +1,14 @@
+-- История назначений долгов: кто вёл долг до и после каждой смены ответственного.
+
+CREATE TABLE IF NOT EXISTS debt_assignment_history (
+    id               bigserial PRIMARY KEY,
+    debt_id          uuid         NOT NULL REFERENCES debts (id) ON DELETE CASCADE,
+    previous_user_id bigint       NULL,
+    new_user_id      bigint       NULL,
+    import_record_id varchar(64)  NULL,
+    reason           varchar(255) NULL,
+    assigned_at      timestamp    NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS debt_assignment_history_debt_idx
+    ON debt_assignment_history (debt_id, assigned_at);
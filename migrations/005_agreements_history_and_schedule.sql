@@ -0,0 +1,28 @@
+-- Несколько соглашений на долг: номер соглашения как идентификатор,
+-- статус и отметка о замене новым соглашением; график платежей.
+
+ALTER TABLE agreements
+    ADD COLUMN IF NOT EXISTS number        varchar(255) NULL,
+    ADD COLUMN IF NOT EXISTS status        varchar(32)  NOT NULL DEFAULT 'active',
+    ADD COLUMN IF NOT EXISTS superseded_at timestamp    NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS agreements_debt_number_uniq
+    ON agreements (debt_id, number)
+    WHERE number IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS agreements_debt_status_idx
+    ON agreements (debt_id, status);
+
+CREATE TABLE IF NOT EXISTS agreement_schedule (
+    id             uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    agreement_id   uuid          NOT NULL REFERENCES agreements (id) ON DELETE CASCADE,
+    installment_no integer       NOT NULL,
+    due_date       date          NOT NULL,
+    amount         numeric(18,2) NOT NULL,
+    paid_amount    numeric(18,2) NOT NULL DEFAULT 0,
+    status         varchar(16)   NOT NULL DEFAULT 'pending',
+    paid_at        date          NULL,
+    created_at     timestamp     NOT NULL DEFAULT NOW(),
+    updated_at     timestamp     NOT NULL DEFAULT NOW(),
+    UNIQUE (agreement_id, installment_no)
+);
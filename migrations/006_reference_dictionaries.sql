@@ -0,0 +1,36 @@
+-- Справочники, которые заполняются импортом: договор с контрагентом,
+-- типы телефонов и адресов (id 1..3 совпадают с прежними константами импорта).
+
+ALTER TABLE counterparties
+    ADD COLUMN IF NOT EXISTS contract_number varchar(255) NULL,
+    ADD COLUMN IF NOT EXISTS contract_date   date         NULL;
+
+CREATE TABLE IF NOT EXISTS phone_types (
+    id         bigserial PRIMARY KEY,
+    name       varchar(255) NOT NULL,
+    created_at timestamp    NULL,
+    updated_at timestamp    NULL
+);
+
+INSERT INTO phone_types (id, name, created_at, updated_at) VALUES
+    (1, 'Мобильный', NOW(), NOW()),
+    (2, 'Рабочий',   NOW(), NOW()),
+    (3, 'Домашний',  NOW(), NOW())
+ON CONFLICT (id) DO NOTHING;
+
+SELECT setval(pg_get_serial_sequence('phone_types', 'id'), GREATEST((SELECT MAX(id) FROM phone_types), 1));
+
+CREATE TABLE IF NOT EXISTS address_types (
+    id         bigserial PRIMARY KEY,
+    name       varchar(255) NOT NULL,
+    created_at timestamp    NULL,
+    updated_at timestamp    NULL
+);
+
+INSERT INTO address_types (id, name, created_at, updated_at) VALUES
+    (1, 'Регистрация', NOW(), NOW()),
+    (2, 'Фактический', NOW(), NOW()),
+    (3, 'Рабочий',     NOW(), NOW())
+ON CONFLICT (id) DO NOTHING;
+
+SELECT setval(pg_get_serial_sequence('address_types', 'id'), GREATEST((SELECT MAX(id) FROM address_types), 1));
@@ -0,0 +1,9 @@
+-- Закрытие долгов (close_debts): дата и причина закрытия.
+
+ALTER TABLE debts
+    ADD COLUMN IF NOT EXISTS closed_at    date        NULL,
+    ADD COLUMN IF NOT EXISTS close_reason varchar(32) NULL;
+
+CREATE INDEX IF NOT EXISTS debts_close_reason_idx
+    ON debts (close_reason)
+    WHERE close_reason IS NOT NULL;
@@ -0,0 +1,48 @@
+-- executive_documents.cancellation_date хранился строкой из файла (varchar);
+-- импорт пишет и сравнивает его как date. Строки переводятся в date по
+-- известным форматам (ГГГГ-ММ-ДД, ДД.ММ.ГГГГ, ДД/ММ/ГГГГ, серийный номер Excel);
+-- нераспознанные значения сохраняются в cancellation_date_raw.
+
+CREATE OR REPLACE FUNCTION pg_temp.parse_cancellation_date(s text) RETURNS date
+LANGUAGE plpgsql IMMUTABLE AS $$
+BEGIN
+    s := btrim(s);
+    IF s IS NULL OR s = '' THEN
+        RETURN NULL;
+    ELSIF s ~ '^\d{4}-\d{2}-\d{2}' THEN
+        RETURN to_date(left(s, 10), 'YYYY-MM-DD');
+    ELSIF s ~ '^\d{2}\.\d{2}\.\d{4}$' THEN
+        RETURN to_date(s, 'DD.MM.YYYY');
+    ELSIF s ~ '^\d{2}/\d{2}/\d{4}$' THEN
+        RETURN to_date(s, 'DD/MM/YYYY');
+    ELSIF s ~ '^\d{5}$' THEN
+        RETURN DATE '1899-12-30' + s::int;
+    END IF;
+    RETURN NULL;
+EXCEPTION WHEN others THEN
+    RETURN NULL;
+END
+$$;
+
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'executive_documents'
+          AND column_name = 'cancellation_date'
+          AND data_type IN ('character varying', 'text')
+    ) THEN
+        ALTER TABLE executive_documents
+            ADD COLUMN IF NOT EXISTS cancellation_date_raw varchar(255) NULL;
+
+        UPDATE executive_documents
+        SET cancellation_date_raw = cancellation_date
+        WHERE btrim(cancellation_date) <> ''
+          AND pg_temp.parse_cancellation_date(cancellation_date) IS NULL;
+
+        ALTER TABLE executive_documents
+            ALTER COLUMN cancellation_date TYPE date
+            USING pg_temp.parse_cancellation_date(cancellation_date);
+    END IF;
+END
+$$;
@@ -0,0 +1,64 @@
+-- Номера долгов приводятся к виду validation.NormalizeDebtNumber: без пробелов
+-- любого вида и невидимых символов. Импорт ищет и создаёт долги только по
+-- нормализованному номеру, поэтому старые номера с пробелами иначе не находятся,
+-- а повторный импорт создал бы рядом второй долг.
+--
+-- Номера, которые после нормализации совпадут с другим долгом, не меняются:
+-- они попадают в debt_number_collisions для ручного разбора.
+
+CREATE OR REPLACE FUNCTION pg_temp.normalize_debt_number(s text) RETURNS text
+LANGUAGE sql IMMUTABLE AS $$
+    SELECT regexp_replace(
+        s,
+        '[[:space:]\u0085\u00a0\u1680\u2000-\u200d\u2028\u2029\u202f\u205f\u2060\u3000\ufeff]',
+        '', 'g')
+$$;
+
+CREATE TABLE IF NOT EXISTS debt_number_collisions (
+    debt_id     uuid         PRIMARY KEY,
+    number      varchar(255) NOT NULL,
+    normalized  varchar(255) NOT NULL,
+    detected_at timestamp    NOT NULL DEFAULT NOW()
+);
+
+CREATE TEMP TABLE tmp_debt_numbers AS
+SELECT id, number, pg_temp.normalize_debt_number(number) AS normalized
+FROM debts
+WHERE number IS NOT NULL;
+
+CREATE TEMP TABLE tmp_debt_number_groups AS
+SELECT normalized
+FROM tmp_debt_numbers
+GROUP BY normalized
+HAVING COUNT(*) > 1 AND bool_or(number <> normalized);
+
+-- 1. Отчёт о коллизиях
+INSERT INTO debt_number_collisions (debt_id, number, normalized)
+SELECT n.id, n.number, n.normalized
+FROM tmp_debt_numbers n
+JOIN tmp_debt_number_groups g ON g.normalized = n.normalized
+ON CONFLICT (debt_id) DO UPDATE
+SET number = EXCLUDED.number, normalized = EXCLUDED.normalized, detected_at = NOW();
+
+DO $$
+DECLARE
+    collisions integer;
+BEGIN
+    SELECT COUNT(*) INTO collisions FROM tmp_debt_number_groups;
+    IF collisions > 0 THEN
+        RAISE NOTICE 'debts.number: % normalized numbers collide, see debt_number_collisions', collisions;
+    END IF;
+END
+$$;
+
+-- 2. Нормализация номеров без коллизий
+UPDATE debts d
+SET number = n.normalized, updated_at = NOW()
+FROM tmp_debt_numbers n
+WHERE d.id = n.id
+  AND n.number <> n.normalized
+  AND n.normalized <> ''
+  AND NOT EXISTS (SELECT 1 FROM tmp_debt_number_groups g WHERE g.normalized = n.normalized);
+
+DROP TABLE tmp_debt_number_groups;
+DROP TABLE tmp_debt_numbers;
@@ -0,0 +1,10 @@
+-- Фактически применённая к остаткам долга разбивка платежа.
+--
+-- Остатки debts.amount_* не уходят ниже нуля, поэтому при переплате
+-- составляющей долг уменьшается меньше, чем указано в платеже. Сторно
+-- возвращает ровно то, что записано здесь ({"main_debt": 100.5, ...,
+-- "actual_debt": 120}). У платежей, применённых до миграции, колонка пуста —
+-- для них сторно возвращает разбивку платежа, как раньше.
+
+ALTER TABLE payments
+    ADD COLUMN IF NOT EXISTS balance_applied jsonb NULL;
@@ -0,0 +1,50 @@
+-- Мягкое удаление телефонов и адресов (deleted_at) и уникальность активных
+-- записей субъекта: параллельные импорты больше не вставляют один и тот же
+-- номер или адрес дважды (PhoneRepo.AddPhones и AddressesRepo.AddAddress
+-- вставляют через ON CONFLICT DO NOTHING).
+--
+-- Уже существующие повторы перед созданием индексов деактивируются:
+-- остаётся самая ранняя запись.
+
+ALTER TABLE phones
+    ADD COLUMN IF NOT EXISTS deleted_at timestamp NULL,
+    ADD COLUMN IF NOT EXISTS updated_at timestamp NULL;
+
+ALTER TABLE addresses
+    ADD COLUMN IF NOT EXISTS deleted_at timestamp NULL,
+    ADD COLUMN IF NOT EXISTS updated_at timestamp NULL;
+
+UPDATE phones p
+SET deleted_at = NOW(), updated_at = NOW()
+FROM (
+    SELECT id,
+           row_number() OVER (
+               PARTITION BY subject_type, subject_id, phone
+               ORDER BY created_at NULLS LAST, id
+           ) AS rn
+    FROM phones
+    WHERE deleted_at IS NULL
+) d
+WHERE p.id = d.id AND d.rn > 1;
+
+CREATE UNIQUE INDEX IF NOT EXISTS phones_subject_phone_active_uniq
+    ON phones (subject_type, subject_id, phone)
+    WHERE deleted_at IS NULL;
+
+UPDATE addresses a
+SET deleted_at = NOW(), updated_at = NOW()
+FROM (
+    SELECT id,
+           row_number() OVER (
+               PARTITION BY subject_type, subject_id, type_id,
+                            LOWER(REGEXP_REPLACE(BTRIM(address), '\s+', ' ', 'g'))
+               ORDER BY created_at NULLS LAST, id
+           ) AS rn
+    FROM addresses
+    WHERE deleted_at IS NULL
+) d
+WHERE a.id = d.id AND d.rn > 1;
+
+CREATE UNIQUE INDEX IF NOT EXISTS addresses_subject_address_active_uniq
+    ON addresses (subject_type, subject_id, type_id, (LOWER(REGEXP_REPLACE(BTRIM(address), '\s+', ' ', 'g'))))
+    WHERE deleted_at IS NULL;
@@ -0,0 +1,65 @@
+-- Натуральный ключ исполнительного документа: (debt_id, type, serial_number).
+-- Документы без долга (долг не найден при импорте) и без серии тоже
+-- сопоставляются — NULL в ключе сравнивается как пустое значение, поэтому
+-- повторная загрузка файла не плодит копии. Импорт пишет документы через
+-- INSERT … ON CONFLICT по индексу executive_documents_natural_key_uniq.
+--
+-- Уже существующие повторы схлопываются в самый ранний документ: ссылки на
+-- остальные (внешние ключи на executive_documents) переводятся на него,
+-- а удалённые строки сохраняются в executive_document_duplicates.
+
+CREATE TABLE IF NOT EXISTS executive_document_duplicates (
+    id          uuid        PRIMARY KEY,
+    kept_id     uuid        NOT NULL,
+    document    jsonb       NOT NULL,
+    detected_at timestamp   NOT NULL DEFAULT NOW()
+);
+
+CREATE TEMP TABLE tmp_exec_doc_duplicates AS
+SELECT id, kept_id
+FROM (
+    SELECT id,
+           first_value(id) OVER w AS kept_id,
+           row_number() OVER w    AS rn
+    FROM executive_documents
+    WINDOW w AS (
+        PARTITION BY COALESCE(debt_id::text, ''), type, COALESCE(serial_number, '')
+        ORDER BY created_at NULLS LAST, id
+    )
+) d
+WHERE rn > 1;
+
+DO $$
+DECLARE
+    fk record;
+BEGIN
+    FOR fk IN
+        SELECT c.conrelid::regclass AS tbl, a.attname AS col
+        FROM pg_constraint c
+        JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = c.conkey[1]
+        WHERE c.contype = 'f'
+          AND c.confrelid = 'executive_documents'::regclass
+          AND array_length(c.conkey, 1) = 1
+    LOOP
+        EXECUTE format(
+            'UPDATE %s t SET %I = d.kept_id FROM tmp_exec_doc_duplicates d WHERE t.%I = d.id',
+            fk.tbl, fk.col, fk.col
+        );
+    END LOOP;
+END
+$$;
+
+INSERT INTO executive_document_duplicates (id, kept_id, document)
+SELECT e.id, d.kept_id, to_jsonb(e)
+FROM executive_documents e
+JOIN tmp_exec_doc_duplicates d ON d.id = e.id
+ON CONFLICT (id) DO NOTHING;
+
+DELETE FROM executive_documents e
+USING tmp_exec_doc_duplicates d
+WHERE e.id = d.id;
+
+DROP TABLE tmp_exec_doc_duplicates;
+
+CREATE UNIQUE INDEX IF NOT EXISTS executive_documents_natural_key_uniq
+    ON executive_documents ((COALESCE(debt_id::text, '')), type, (COALESCE(serial_number, '')));
@@ -0,0 +1,25 @@
+-- Импорт контактных лиц (import_contact_persons): комментарий к контакту
+-- и справочник типов связи, по которому тип ищется по названию
+-- (id 1 совпадает с прежним типом по умолчанию импорта).
+
+ALTER TABLE contact_persons
+    ADD COLUMN IF NOT EXISTS comment text NULL;
+
+CREATE TABLE IF NOT EXISTS contact_person_types (
+    id         bigserial PRIMARY KEY,
+    name       varchar(255) NOT NULL,
+    created_at timestamp    NULL,
+    updated_at timestamp    NULL
+);
+
+INSERT INTO contact_person_types (id, name, created_at, updated_at) VALUES
+    (1, 'Родственник', NOW(), NOW()),
+    (2, 'Супруг(а)',   NOW(), NOW()),
+    (3, 'Коллега',     NOW(), NOW())
+ON CONFLICT (id) DO NOTHING;
+
+SELECT setval(pg_get_serial_sequence('contact_person_types', 'id'), GREATEST((SELECT MAX(id) FROM contact_person_types), 1));
+
+-- Поиск типа по названию: LOWER(BTRIM(name)) = $1.
+CREATE INDEX IF NOT EXISTS contact_person_types_name_idx
+    ON contact_person_types ((LOWER(BTRIM(name))));